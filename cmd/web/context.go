@@ -3,3 +3,11 @@ package main
 type contextKey string
 
 const isAuthenticatedContextKey = contextKey("isAuthenticated")
+
+const formTooLargeContextKey = contextKey("formTooLarge")
+
+const apiTokenContextKey = contextKey("apiToken")
+
+const currentUserContextKey = contextKey("currentUser")
+
+const impersonatorContextKey = contextKey("impersonator")
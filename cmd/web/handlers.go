@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"snipit.bikraj.net/internal/models"
@@ -14,18 +16,33 @@ import (
 type snippetCreateForm struct {
 	Title               string `form:"title"`
 	Content             string `form:"content"`
+	Language            string `form:"language"`
+	Visibility          string `form:"visibility"`
 	Expires             int    `form:"expires"`
+	OrgID               int    `form:"org_id"`
+	AllowDuplicate      bool   `form:"allow_duplicate"`
 	Validator.Validator `form:"-"`
 }
 type userSignForm struct {
 	Name                string `form:"name"`
+	Username            string `form:"username"`
 	Email               string `form:"email"`
 	Password            string `form:"password"`
+	InviteCode          string `form:"invite_code"`
 	Validator.Validator `form:"-"`
 }
+
+// userLoginForm takes either a password or, from the passkey button, a
+// WebAuthn assertion.
 type userLoginForm struct {
 	Email               string `form:"email"`
 	Password            string `form:"password"`
+	Remember            bool   `form:"remember"`
+	CredentialID        string `form:"credential_id"`
+	ClientDataJSON      string `form:"client_data_json"`
+	AuthenticatorData   string `form:"authenticator_data"`
+	Signature           string `form:"signature"`
+	UserHandle          string `form:"user_handle"`
 	Validator.Validator `form:"-"`
 }
 type userPasswordChangeForm struct {
@@ -35,6 +52,12 @@ type userPasswordChangeForm struct {
 	Validator.Validator `form:"-"`
 }
 
+// Snippets longer than this are truncated on the view page.
+const (
+	previewMaxBytes = 64 * 1024
+	previewMaxLines = 1000
+)
+
 func ping(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK"))
 }
@@ -72,17 +95,96 @@ func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if ok, err := app.canView(r, snippet); err != nil {
+		app.serverError(w, err)
+		return
+	} else if !ok {
+		app.notFound(w)
+		return
+	}
+
 	data := app.newTemplateData(r)
 	data.Snippet = snippet
+	// Very long snippets are cut down unless the full version is asked for;
+	// the raw view always has everything.
+	if r.URL.Query().Get("full") == "" {
+		content, truncated := truncateContent(snippet.Content, previewMaxBytes, previewMaxLines)
+		if truncated {
+			preview := *snippet
+			preview.Content = content
+			data.Snippet = &preview
+			data.Truncated = true
+		}
+	}
 
 	app.render(w, http.StatusOK, "view.tmpl.html", data)
 }
 
+func (app *application) snippetRaw(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	if ok, err := app.canView(r, snippet); err != nil {
+		app.serverError(w, err)
+		return
+	} else if !ok {
+		app.notFound(w)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(snippet.Content))
+}
+
 func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
-	data.Form = snippetCreateForm{
-		Expires: 365,
+	userID := app.authenticatedUserID(r)
+	templates, err := app.snippetTemplates.ForUser(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	form := snippetCreateForm{
+		Expires:    365,
+		Visibility: models.VisibilityPublic,
+	}
+	if r.URL.Query().Has("template") {
+		tmpl, err := app.snippetTemplateForUser(r.URL.Query().Get("template"), userID)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.notFound(w)
+			} else {
+				app.serverError(w, err)
+			}
+			return
+		}
+		form = snippetCreateForm{
+			Title:      tmpl.Title(time.Now()),
+			Content:    tmpl.Content,
+			Language:   tmpl.Language,
+			Visibility: tmpl.Visibility,
+			Expires:    tmpl.Expires,
+		}
 	}
+	if id, err := strconv.Atoi(r.URL.Query().Get("org")); err == nil {
+		form.OrgID = id
+	}
+	data, err := app.snippetFormData(r, form)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	data.SnippetTemplates = templates
 	app.render(w, http.StatusOK, "create.tmpl.html", data)
 }
 
@@ -99,20 +201,44 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 		"title",
 		"This field cannot be more than 100 characters long",
 	)
+	app.checkContentSize(&form.Validator, r, form.Content)
 	form.CheckField(Validator.NotBlank(form.Content), "content", "This field cannot be blank")
-	form.CheckField(
-		Validator.PermittedValue(form.Expires, 1, 7, 365),
-		"expires",
-		"This field must equal 1, 7 or 365",
-	)
+	checkSnippetDefaults(&form.Validator, form.Language, form.Visibility, form.Expires)
+	userID := app.authenticatedUserID(r)
+	err = app.checkSnippetOrg(&form.Validator, userID, form.OrgID, form.Visibility)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
 
 	if !form.Valid() {
-		data := app.newTemplateData(r)
-		data.Form = form
+		data, err := app.snippetFormData(r, form)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
 		app.render(w, http.StatusUnprocessableEntity, "create.tmpl.html", data)
 		return
 	}
-	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires)
+	// Offer the user's existing copy of the same content before storing
+	// another one, unless they have already confirmed the duplicate.
+	if !form.AllowDuplicate {
+		duplicate, err := app.snippets.FindDuplicate(userID, form.Content)
+		if err == nil {
+			data, err := app.snippetFormData(r, form)
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+			data.Snippet = duplicate
+			app.render(w, http.StatusConflict, "create.tmpl.html", data)
+			return
+		} else if !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, err)
+			return
+		}
+	}
+	id, err := app.snippets.Insert(userID, form.OrgID, form.Title, form.Content, form.Language, form.Visibility, form.Expires)
 	if err != nil {
 		app.serverError(w, err)
 		return
@@ -121,10 +247,16 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
 }
 
-func (app *application) userSignUp(w http.ResponseWriter, r *http.Request) {
+func (app *application) renderSignup(w http.ResponseWriter, r *http.Request, status int, form userSignForm) {
 	data := app.newTemplateData(r)
-	data.Form = userSignForm{}
-	app.render(w, http.StatusOK, "signup.tmpl.html", data)
+	data.Form = form
+	data.Signup = app.signup
+	app.render(w, status, "signup.tmpl.html", data)
+}
+
+// userSignUp fills in the invite code from links like /user/signup?invite=...
+func (app *application) userSignUp(w http.ResponseWriter, r *http.Request) {
+	app.renderSignup(w, r, http.StatusOK, userSignForm{InviteCode: r.URL.Query().Get("invite")})
 }
 
 func (app *application) userSignUpPost(w http.ResponseWriter, r *http.Request) {
@@ -134,29 +266,76 @@ func (app *application) userSignUpPost(w http.ResponseWriter, r *http.Request) {
 		app.serverError(w, err)
 		return
 	}
+	form.Username = strings.ToLower(strings.TrimSpace(form.Username))
 	form.CheckField(Validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckUsername("username", form.Username)
 	form.CheckField(Validator.NotBlank(form.Email), "email", "This field cannot be blank")
 	form.CheckField(Validator.Matches(form.Email, Validator.EmailRX), "email", "This field must be a valid email address")
 	form.CheckField(Validator.NotBlank(form.Password), "password", "This field cannot be blank")
 	form.CheckField(Validator.MinChars(form.Password, 8), "password", "This field must be at least 8 characters long")
+	form.CheckField(Validator.MaxChars(form.Password, Validator.MaxPasswordChars), "password", "This field cannot be more than 128 characters long")
+	if form.FieldErrors["password"] == "" {
+		form.CheckPassword(app.passwordPolicy, "password", form.Password, form.Name, form.Username, form.Email)
+	}
+	if form.FieldErrors["email"] == "" {
+		form.CheckField(app.signup.AllowsEmail(form.Email), "email", "Use an address at "+app.signup.DomainList())
+	}
+	if app.signup.NeedsInvite() {
+		form.CheckField(Validator.NotBlank(form.InviteCode), "invite_code", "Enter the invite code you were given")
+	}
 	if !form.Valid() {
-		data := app.newTemplateData(r)
-		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "signup.tmpl.html", data)
+		app.renderSignup(w, r, http.StatusUnprocessableEntity, form)
 		return
 	}
-	err = app.users.Insert(form.Name, form.Email, form.Password)
+	// The invite is used up before the account is created, so that two
+	// signups can't share its last use, and given back if creation fails.
+	inviteID := 0
+	if app.signup.NeedsInvite() {
+		inviteID, err = app.invites.Redeem(form.InviteCode)
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidInvite) {
+				form.AddField("invite_code", "That invite code is invalid, used up or expired")
+				app.renderSignup(w, r, http.StatusUnprocessableEntity, form)
+			} else {
+				app.serverError(w, err)
+			}
+			return
+		}
+	}
+	id, err := app.users.Insert(form.Name, form.Username, form.Email, form.Password)
 
 	if err != nil {
-		if errors.Is(err, models.ErrDuplicateEmail) {
-			form.CheckField(true, "email", "Email address already in use")
-			data := app.newTemplateData(r)
-			app.render(w, http.StatusUnprocessableEntity, "signup.tmpl.html", data)
-		} else {
+		if inviteID != 0 {
+			if releaseErr := app.invites.Release(inviteID); releaseErr != nil {
+				app.errorLog.Println(releaseErr)
+			}
+		}
+		switch {
+		case errors.Is(err, models.ErrDuplicateEmail):
+			form.AddField("email", "Email address already in use")
+		case errors.Is(err, models.ErrDuplicateUsername):
+			form.AddField("username", "That username is already taken")
+		default:
 			app.serverError(w, err)
+			return
 		}
+		app.renderSignup(w, r, http.StatusUnprocessableEntity, form)
 		return
 	}
+	if inviteID != 0 {
+		err = app.recordAudit(r, id, "user.signup", models.AuditTargetUser, id, map[string]string{"invite": strconv.Itoa(inviteID)})
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+	// The account exists either way; a failed send can be retried from
+	// the verification page after logging in.
+	err = app.sendVerificationEmail(id, form.Name, form.Email)
+	if err != nil {
+		app.errorLog.Println(err)
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful. Please check your email to verify your address.")
 	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 }
 func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
@@ -172,6 +351,10 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
+	if form.CredentialID != "" {
+		app.passkeyLogin(w, r, form)
+		return
+	}
 	form.CheckField(Validator.NotBlank(form.Email), "email", "This field cannot be blank")
 	form.CheckField(Validator.Matches(form.Email, Validator.EmailRX), "email", "This field must be a valid email address")
 	form.CheckField(Validator.NotBlank(form.Password), "password", "This field cannot be blank")
@@ -181,37 +364,173 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 		app.render(w, http.StatusUnprocessableEntity, "login.tmpl.html", data)
 		return
 	}
+	// Failed logins are throttled per account and per client IP. Both
+	// attempts are counted before the password is checked and taken back
+	// unless it turns out wrong, so parallel guesses can't dodge the limit.
+	email := strings.ToLower(strings.TrimSpace(form.Email))
+	ip := clientIP(r)
+	ipAttempt, err := app.loginIPGuard.Attempt(ip)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if !ipAttempt.Allowed {
+		app.lockedOut(w, r, form, ipAttempt.Wait)
+		return
+	}
+	attempt, err := app.loginAccountGuard.Attempt(email)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if !attempt.Allowed {
+		err = app.loginIPGuard.Forgive(ip, ipAttempt)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		app.lockedOut(w, r, form, attempt.Wait)
+		return
+	}
 	id, err := app.users.Authenticate(form.Email, form.Password)
+	if err == nil || errors.Is(err, models.ErrAccountDisabled) {
+		forgiveErr := app.loginIPGuard.Forgive(ip, ipAttempt)
+		if forgiveErr != nil {
+			app.serverError(w, forgiveErr)
+			return
+		}
+	}
 	if err != nil {
 		if errors.Is(err, models.ErrInvalidCredentials) {
+			err = app.recordLoginFailure(r, email, "password")
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+			// Looking the account up and mailing it would make this
+			// response slower only for addresses that have one.
+			if attempt.Failures == app.loginAccountGuard.Threshold {
+				app.background(func() error {
+					return app.sendLockoutNotice(email, ip)
+				})
+			}
 			form.AddNonFieldError("Email or password is incorrect")
 			data := app.newTemplateData(r)
 			data.Form = form
 			app.render(w, http.StatusUnprocessableEntity, "login.tmpl.html", data)
+		} else if errors.Is(err, models.ErrAccountDisabled) {
+			err = app.recordLoginFailure(r, email, "disabled")
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+			form.AddNonFieldError("This account has been disabled")
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, http.StatusForbidden, "login.tmpl.html", data)
 		} else {
 			app.serverError(w, err)
 		}
 		return
 	}
-	err = app.sessionManager.RenewToken(r.Context())
+	err = app.loginAccountGuard.Reset(email)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
-	path := app.sessionManager.PopString(r.Context(), "redirectedPathAfterLogin")
-	if path != "" {
-		http.Redirect(w, r, path, http.StatusSeeOther)
+	// Held until the last login step, which may be on another page.
+	app.sessionManager.Put(r.Context(), "rememberMe", form.Remember)
+	app.continueLogin(w, r, id, "password")
+}
+
+// continueLogin moves on from a successful first factor, whether a password
+// or an SSO provider, to the second factor when the user has one set up.
+// method names the first factor for the security log.
+func (app *application) continueLogin(w http.ResponseWriter, r *http.Request, id int, method string) {
+	app.sessionManager.Put(r.Context(), "loginMethod", method)
+	secret, err := app.twoFactor.Secret(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if secret != "" {
+		app.beginTwoFactor(w, r, id)
+		return
+	}
+	app.completeLogin(w, r, id)
+}
+
+// completeLogin starts an authenticated session for the user once every
+// login step has passed, and sends them back where they were heading.
+func (app *application) completeLogin(w http.ResponseWriter, r *http.Request, id int) {
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	sessionID, err := app.userSessions.Create(id, clientIP(r), r.UserAgent())
+	if err != nil {
+		app.serverError(w, err)
+		return
 	}
 	app.sessionManager.Put(r.Context(), "authenticatedUserID", id)
-	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+	app.sessionManager.Remove(r.Context(), "impersonatorID")
+	app.sessionManager.Put(r.Context(), "sessionID", sessionID)
+	err = app.recordAudit(r, id, "login.success", models.AuditTargetUser, id, map[string]string{
+		"method": app.sessionManager.PopString(r.Context(), "loginMethod"),
+	})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if app.sessionManager.PopBool(r.Context(), "rememberMe") {
+		err = app.remember(w, id)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+	path := app.sessionManager.PopString(r.Context(), "redirectPathAfterLogin")
+	if path == "" {
+		path = "/snippet/create"
+	}
+	http.Redirect(w, r, path, http.StatusSeeOther)
 }
 
 func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
-	err := app.sessionManager.RenewToken(r.Context())
+	id := app.authenticatedUserID(r)
+	err := app.recordAudit(r, id, "logout", models.AuditTargetUser, id, nil)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	// An admin logging out mid-impersonation ends their own session.
+	owner := id
+	if impersonator := app.impersonator(r); impersonator != nil {
+		owner = impersonator.ID
+	}
+	if sessionID := app.sessionManager.GetString(r.Context(), "sessionID"); sessionID != "" {
+		err := app.userSessions.Revoke(sessionID, owner)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, err)
+			return
+		}
+	}
+	if token := rememberToken(r); token != "" {
+		err := app.rememberTokens.Revoke(token)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		app.clearRememberCookie(w)
+	}
+	err = app.sessionManager.RenewToken(r.Context())
 	if err != nil {
 		app.serverError(w, err)
 	}
 	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+	app.sessionManager.Remove(r.Context(), "impersonatorID")
+	app.sessionManager.Remove(r.Context(), "sessionID")
 	app.sessionManager.Put(r.Context(), "flash", "You have been logged out Successfully")
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
@@ -255,7 +574,11 @@ func (app *application) userChangePasswordPost(w http.ResponseWriter, r *http.Re
 	form.CheckField(Validator.NotBlank(form.OldPassword), "OldPassword", "Old Password cannot be blank")
 	// Validations
 	form.CheckField(Validator.MinChars(form.NewPassword, 8), "NewPassword", "Password Length must be at least 8 characters")
-	fmt.Println(form.NewPassword, form.ConfirmPassword)
+	form.CheckField(Validator.MaxChars(form.NewPassword, Validator.MaxPasswordChars), "NewPassword", "Password cannot be more than 128 characters long")
+	user := app.currentUser(r)
+	if form.FieldErrors["NewPassword"] == "" {
+		form.CheckPassword(app.passwordPolicy, "NewPassword", form.NewPassword, user.Name, user.Username, user.Email)
+	}
 	form.CheckField(Validator.Same(form.NewPassword, form.ConfirmPassword), "NewPassword", "Password Must be Same")
 	form.CheckField(!Validator.Same(form.OldPassword, form.NewPassword), "NewPassword", "New Password Cannot be same as the new Password")
 
@@ -269,12 +592,11 @@ func (app *application) userChangePasswordPost(w http.ResponseWriter, r *http.Re
 	_, err = app.users.ChangePassword(id, form.OldPassword, form.NewPassword)
 	if err != nil {
 		if errors.Is(err, models.ErrInvalidCredentials) {
+			form.AddNonFieldError("The password you have entered is incorrect")
 			data := app.newTemplateData(r)
 			data.Form = form
-
-			form.AddNonFieldError("The password you have entered is incorrect")
-			fmt.Println(form)
 			app.render(w, http.StatusUnprocessableEntity, "changePassword.tmpl.html", data)
+			return
 		} else if errors.Is(err, models.ErrNoRecord) {
 			form.AddNonFieldError("Please Login Again")
 			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
@@ -284,5 +606,21 @@ func (app *application) userChangePasswordPost(w http.ResponseWriter, r *http.Re
 			return
 		}
 	}
+	// Anyone else holding a session for this account is logged out.
+	err = app.userSessions.RevokeAll(id, app.sessionManager.GetString(r.Context(), "sessionID"))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.rememberTokens.RevokeAll(id, rememberToken(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.recordAudit(r, id, "password.change", models.AuditTargetUser, id, nil)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
@@ -0,0 +1,622 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"snipit.bikraj.net/internal/mailer"
+	"snipit.bikraj.net/internal/models"
+	Validator "snipit.bikraj.net/internal/validator"
+)
+
+// purgeInterval is how often deleted accounts past their grace period, and
+// audit entries past retention, are looked for.
+const purgeInterval = time.Hour
+
+const (
+	changeEmailPurpose = "change-email"
+	changeEmailTTL     = 24 * time.Hour
+
+	deleteAccountPurpose = "delete-account"
+	deleteAccountTTL     = time.Hour
+)
+
+type accountEditForm struct {
+	Name                string `form:"name"`
+	Email               string `form:"email"`
+	Validator.Validator `form:"-"`
+}
+
+// accountDeleteForm is confirmed with the password or, for users who sign
+// in through a provider and never chose one, with a link emailed to them.
+// Token holds that link's token on the page it opens.
+type accountDeleteForm struct {
+	Password            string `form:"password"`
+	Confirm             string `form:"confirm"`
+	Snippets            string `form:"snippets"`
+	OrgID               int    `form:"org_id"`
+	Token               string `form:"-"`
+	Validator.Validator `form:"-"`
+}
+
+// The export is meant to be read by people as much as by programs, so the
+// JSON uses plain field names and is indented.
+type exportProfile struct {
+	ID            int                  `json:"id"`
+	Name          string               `json:"name"`
+	Email         string               `json:"email"`
+	Created       time.Time            `json:"created"`
+	Verified      bool                 `json:"verified"`
+	Role          string               `json:"role"`
+	Organizations []exportOrganization `json:"organizations"`
+	Sessions      []exportSession      `json:"sessions"`
+	APITokens     []exportAPIToken     `json:"api_tokens"`
+	SSHKeys       []exportSSHKey       `json:"ssh_keys"`
+	Passkeys      []exportPasskey      `json:"passkeys"`
+}
+
+type exportOrganization struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+type exportSession struct {
+	Created   time.Time `json:"created"`
+	LastSeen  time.Time `json:"last_seen"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+}
+
+type exportAPIToken struct {
+	Name     string    `json:"name"`
+	Scopes   []string  `json:"scopes"`
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+type exportSSHKey struct {
+	Name      string    `json:"name"`
+	PublicKey string    `json:"public_key"`
+	Created   time.Time `json:"created"`
+	LastUsed  time.Time `json:"last_used"`
+}
+
+type exportPasskey struct {
+	Name     string    `json:"name"`
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+type exportSnippet struct {
+	apiSnippet
+	// File is the path of the snippet's raw content within the archive.
+	File string `json:"file"`
+}
+
+type exportTemplate struct {
+	Name         string    `json:"name"`
+	TitlePattern string    `json:"title_pattern"`
+	Language     string    `json:"language"`
+	Content      string    `json:"content"`
+	Expires      int       `json:"expires"`
+	Visibility   string    `json:"visibility"`
+	Created      time.Time `json:"created"`
+}
+
+// buildExport writes everything stored about the user to a ZIP archive.
+func (app *application) buildExport(user *models.User) ([]byte, error) {
+	orgs, err := app.orgs.ForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := app.userSessions.ForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := app.apiTokens.ForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := app.sshKeys.ForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	passkeys, err := app.passkeys.ForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	snippets, err := app.snippets.ForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	templates, err := app.snippetTemplates.ForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := exportProfile{
+		ID:            user.ID,
+		Name:          user.Name,
+		Email:         user.Email,
+		Created:       user.Created,
+		Verified:      user.Verified,
+		Role:          user.Role,
+		Organizations: []exportOrganization{},
+		Sessions:      []exportSession{},
+		APITokens:     []exportAPIToken{},
+		SSHKeys:       []exportSSHKey{},
+		Passkeys:      []exportPasskey{},
+	}
+	for _, o := range orgs {
+		profile.Organizations = append(profile.Organizations, exportOrganization{Slug: o.Slug, Name: o.Name, Role: o.Role})
+	}
+	for _, s := range sessions {
+		profile.Sessions = append(profile.Sessions, exportSession{Created: s.Created, LastSeen: s.LastSeen, IP: s.IP, UserAgent: s.UserAgent})
+	}
+	for _, t := range tokens {
+		profile.APITokens = append(profile.APITokens, exportAPIToken{Name: t.Name, Scopes: t.Scopes, Created: t.Created, Expires: t.Expires, LastUsed: t.LastUsed})
+	}
+	for _, k := range keys {
+		profile.SSHKeys = append(profile.SSHKeys, exportSSHKey{Name: k.Name, PublicKey: k.PublicKey, Created: k.Created, LastUsed: k.LastUsed})
+	}
+	for _, p := range passkeys {
+		profile.Passkeys = append(profile.Passkeys, exportPasskey{Name: p.Name, Created: p.Created, LastUsed: p.LastUsed})
+	}
+
+	exported := []exportSnippet{}
+	for _, s := range snippets {
+		exported = append(exported, exportSnippet{apiSnippet: newAPISnippet(s), File: fmt.Sprintf("snippets/%d.txt", s.ID)})
+	}
+	ownTemplates := []exportTemplate{}
+	for _, t := range templates {
+		if t.SiteWide() {
+			continue
+		}
+		ownTemplates = append(ownTemplates, exportTemplate{
+			Name:         t.Name,
+			TitlePattern: t.TitlePattern,
+			Language:     t.Language,
+			Content:      t.Content,
+			Expires:      t.Expires,
+			Visibility:   t.Visibility,
+			Created:      t.Created,
+		})
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	now := time.Now()
+	add := func(name string, content []byte) error {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(content)
+		return err
+	}
+	addJSON := func(name string, v any) error {
+		content, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		return add(name, append(content, '\n'))
+	}
+
+	if err := addJSON("profile.json", profile); err != nil {
+		return nil, err
+	}
+	if err := addJSON("snippets.json", exported); err != nil {
+		return nil, err
+	}
+	if err := addJSON("templates.json", ownTemplates); err != nil {
+		return nil, err
+	}
+	for i, s := range snippets {
+		if err := add(exported[i].File, []byte(s.Content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (app *application) accountExport(w http.ResponseWriter, r *http.Request) {
+	archive, err := app.buildExport(app.currentUser(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="snippetbox-export-%s.zip"`, time.Now().UTC().Format("20060102")))
+	w.Write(archive)
+}
+
+func (app *application) renderAccountEdit(w http.ResponseWriter, r *http.Request, status int, form accountEditForm) {
+	data := app.newTemplateData(r)
+	data.Form = form
+	app.render(w, status, "accountEdit.tmpl.html", data)
+}
+
+func (app *application) accountEdit(w http.ResponseWriter, r *http.Request) {
+	user := app.currentUser(r)
+	app.renderAccountEdit(w, r, http.StatusOK, accountEditForm{Name: user.Name, Email: user.Email})
+}
+
+// sendEmailChange asks the new address to confirm the change and warns the
+// old one, in case someone else has got into the account. Both addresses are
+// part of the token, so the link stops working once the email changes by
+// any other route.
+func (app *application) sendEmailChange(user *models.User, email string) error {
+	payload := fmt.Sprintf("%d|%s|%s", user.ID, user.Email, email)
+	token := app.signer.Sign(changeEmailPurpose, payload, time.Now().Add(changeEmailTTL))
+	err := app.mailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Confirm your new Snippetbox email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm that you want to use this address for your Snippetbox account "+
+			"by opening the link below. It is valid for %d hours.\n\n%s/account/email/confirm/%s\n",
+			user.Name, int(changeEmailTTL.Hours()), app.baseURL, token),
+	})
+	if err != nil {
+		return err
+	}
+	return app.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your Snippetbox email address is being changed",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to change the email address of your Snippetbox account to %s. "+
+			"Nothing changes unless the link we sent there is opened.\n\n"+
+			"If this wasn't you, change your password straight away at %s/account/password/update\n",
+			user.Name, email, app.baseURL),
+	})
+}
+
+func (app *application) accountEditPost(w http.ResponseWriter, r *http.Request) {
+	var form accountEditForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	user := app.currentUser(r)
+	form.Name = strings.TrimSpace(form.Name)
+	form.Email = strings.TrimSpace(form.Email)
+	form.CheckField(Validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(Validator.MaxChars(form.Name, 255), "name", "This field cannot be more than 255 characters long")
+	form.CheckField(Validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(Validator.Matches(form.Email, Validator.EmailRX), "email", "This field must be a valid email address")
+	emailChanged := !strings.EqualFold(form.Email, user.Email)
+	// A changed address has to pass the same signup policy as a new one,
+	// or domain-restricted signup could be sidestepped afterwards.
+	if form.FieldErrors["email"] == "" && emailChanged {
+		form.CheckField(app.signup.AllowsEmail(form.Email), "email", "Use an address at "+app.signup.DomainList())
+	}
+	if form.Valid() && emailChanged {
+		_, err = app.users.GetByEmail(form.Email)
+		if err == nil {
+			form.AddField("email", "Email address already in use")
+		} else if !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, err)
+			return
+		}
+	}
+	if !form.Valid() {
+		app.renderAccountEdit(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	if form.Name != user.Name {
+		err = app.users.SetName(user.ID, form.Name)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+	if !emailChanged {
+		app.sessionManager.Put(r.Context(), "flash", "Your account has been updated.")
+		http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+		return
+	}
+	user.Name = form.Name
+	err = app.sendEmailChange(user, form.Email)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash",
+		fmt.Sprintf("We have sent a confirmation link to %s. Your email address will change once you open it.", form.Email))
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+func (app *application) accountEmailConfirm(w http.ResponseWriter, r *http.Request) {
+	invalid := func() {
+		app.sessionManager.Put(r.Context(), "flash", "That confirmation link is invalid or has expired.")
+		http.Redirect(w, r, "/account/edit", http.StatusSeeOther)
+	}
+	payload, err := app.signer.Verify(changeEmailPurpose, httprouter.ParamsFromContext(r.Context()).ByName("token"), time.Now())
+	if err != nil {
+		invalid()
+		return
+	}
+	parts := strings.SplitN(payload, "|", 3)
+	if len(parts) != 3 {
+		invalid()
+		return
+	}
+	id, err := strconv.Atoi(parts[0])
+	if err != nil || id != app.authenticatedUserID(r) {
+		invalid()
+		return
+	}
+	user := app.currentUser(r)
+	if user.Email != parts[1] {
+		invalid()
+		return
+	}
+	// The policy may have changed since the link was sent.
+	if !app.signup.AllowsEmail(parts[2]) {
+		app.sessionManager.Put(r.Context(), "flash", "Use an address at "+app.signup.DomainList()+".")
+		http.Redirect(w, r, "/account/edit", http.StatusSeeOther)
+		return
+	}
+
+	err = app.users.ChangeEmail(id, parts[2])
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateEmail) {
+			app.sessionManager.Put(r.Context(), "flash", "That email address is already in use.")
+			http.Redirect(w, r, "/account/edit", http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	err = app.recordAudit(r, id, "user.email", models.AuditTargetUser, id, map[string]string{"from": parts[1], "to": parts[2]})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Your email address has been changed.")
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+func (app *application) renderAccountDelete(w http.ResponseWriter, r *http.Request, status int, form accountDeleteForm) {
+	orgs, err := app.orgs.ForUser(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.Form = form
+	data.Organizations = orgs
+	app.render(w, status, "accountDelete.tmpl.html", data)
+}
+
+func (app *application) accountDelete(w http.ResponseWriter, r *http.Request) {
+	app.renderAccountDelete(w, r, http.StatusOK, accountDeleteForm{Snippets: models.SnippetPolicyDelete, Confirm: "password"})
+}
+
+// checkSoleOwner stops users deleting their account while they are the
+// only owner of an organization that has other members, which would leave
+// it without anyone able to manage it.
+func (app *application) checkSoleOwner(v *Validator.Validator, userID int) error {
+	orgs, err := app.orgs.ForUser(userID)
+	if err != nil {
+		return err
+	}
+	for _, org := range orgs {
+		if org.Role != models.OrgRoleOwner {
+			continue
+		}
+		members, err := app.orgs.Members(org.ID)
+		if err != nil {
+			return err
+		}
+		owners := 0
+		for _, m := range members {
+			if m.Role == models.OrgRoleOwner {
+				owners++
+			}
+		}
+		if owners == 1 && len(members) > 1 {
+			v.AddNonFieldError(fmt.Sprintf("You are the only owner of %s. Make someone else an owner first.", org.Name))
+		}
+	}
+	return nil
+}
+
+// checkAccountDelete validates what is to happen to the user's snippets.
+func (app *application) checkAccountDelete(form *accountDeleteForm, userID int) error {
+	form.CheckField(
+		Validator.PermittedValue(form.Snippets, models.SnippetPolicyDelete, models.SnippetPolicyAnonymous, models.SnippetPolicyOrganization),
+		"snippets",
+		"This field must equal delete, anonymous or organization",
+	)
+	if form.Snippets == models.SnippetPolicyOrganization {
+		err := app.checkSnippetOrg(&form.Validator, userID, form.OrgID, models.VisibilityOrganization)
+		if err != nil {
+			return err
+		}
+	}
+	return app.checkSoleOwner(&form.Validator, userID)
+}
+
+func (app *application) accountDeletePost(w http.ResponseWriter, r *http.Request) {
+	var form accountDeleteForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	user := app.currentUser(r)
+	if form.Confirm == "" {
+		form.Confirm = "password"
+	}
+	form.CheckField(Validator.PermittedValue(form.Confirm, "password", "email"), "confirm", "This field must equal password or email")
+	if form.Confirm != "email" {
+		form.CheckField(Validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	}
+	err = app.checkAccountDelete(&form, user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if form.Valid() && form.Confirm == "password" {
+		_, err = app.users.Authenticate(user.Email, form.Password)
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			form.AddField("password", "Password is incorrect")
+		} else if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+	if !form.Valid() {
+		form.Password = ""
+		app.renderAccountDelete(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	if form.Confirm == "email" {
+		err = app.sendAccountDeleteLink(user, form)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		app.sessionManager.Put(r.Context(), "flash",
+			fmt.Sprintf("We have sent a link to %s. Your account will be deleted once you open it and confirm.", user.Email))
+		http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+		return
+	}
+	app.deleteAccount(w, r, user, form)
+}
+
+// sendAccountDeleteLink emails the user a link to confirm deleting their
+// account with the options they chose. Their email address is part of the
+// token, so the link stops working if it changes.
+func (app *application) sendAccountDeleteLink(user *models.User, form accountDeleteForm) error {
+	payload := fmt.Sprintf("%d|%s|%s|%d", user.ID, user.Email, form.Snippets, form.OrgID)
+	token := app.signer.Sign(deleteAccountPurpose, payload, time.Now().Add(deleteAccountTTL))
+	return app.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm deleting your Snippetbox account",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to delete your Snippetbox account. If it was you, open the link "+
+			"below within %d minutes and confirm. Otherwise you can ignore this email.\n\n%s/account/delete/confirm/%s\n",
+			user.Name, int(deleteAccountTTL.Minutes()), app.baseURL, token),
+	})
+}
+
+// accountDeleteToken checks the token from an emailed deletion link and
+// returns the options it carries, or false when it isn't the current
+// user's or has expired.
+func (app *application) accountDeleteToken(r *http.Request, user *models.User) (accountDeleteForm, bool) {
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+	payload, err := app.signer.Verify(deleteAccountPurpose, token, time.Now())
+	if err != nil {
+		return accountDeleteForm{}, false
+	}
+	parts := strings.SplitN(payload, "|", 4)
+	if len(parts) != 4 || parts[0] != strconv.Itoa(user.ID) || parts[1] != user.Email {
+		return accountDeleteForm{}, false
+	}
+	orgID, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return accountDeleteForm{}, false
+	}
+	return accountDeleteForm{Confirm: "email", Snippets: parts[2], OrgID: orgID, Token: token}, true
+}
+
+// accountDeleteConfirm shows what opening the emailed link will do. Only
+// posting the page deletes the account, so a mail scanner following the
+// link can't.
+func (app *application) accountDeleteConfirm(w http.ResponseWriter, r *http.Request) {
+	form, ok := app.accountDeleteToken(r, app.currentUser(r))
+	if !ok {
+		app.sessionManager.Put(r.Context(), "flash", "That confirmation link is invalid or has expired.")
+		http.Redirect(w, r, "/account/delete", http.StatusSeeOther)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.Form = form
+	app.render(w, http.StatusOK, "accountDeleteConfirm.tmpl.html", data)
+}
+
+func (app *application) accountDeleteConfirmPost(w http.ResponseWriter, r *http.Request) {
+	user := app.currentUser(r)
+	form, ok := app.accountDeleteToken(r, user)
+	if !ok {
+		app.sessionManager.Put(r.Context(), "flash", "That confirmation link is invalid or has expired.")
+		http.Redirect(w, r, "/account/delete", http.StatusSeeOther)
+		return
+	}
+	// Organizations may have changed since the link was sent.
+	err := app.checkAccountDelete(&form, user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if !form.Valid() {
+		app.renderAccountDelete(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+	app.deleteAccount(w, r, user, form)
+}
+
+// deleteAccount locks the account once deleting it has been confirmed and
+// logs the user out.
+func (app *application) deleteAccount(w http.ResponseWriter, r *http.Request, user *models.User, form accountDeleteForm) {
+	err := app.users.SoftDelete(user.ID, app.deletionGrace)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.snippets.Disown(user.ID, form.Snippets, form.OrgID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.userSessions.RevokeAll(user.ID, "")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.recordAudit(r, user.ID, "user.delete", models.AuditTargetUser, user.ID, map[string]string{"snippets": form.Snippets})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+	app.sessionManager.Remove(r.Context(), "sessionID")
+	app.clearRememberCookie(w)
+	app.sessionManager.Put(r.Context(), "flash", "Your account has been deleted.")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// purgeDeletedAccounts removes accounts whose grace period is over, every
+// interval until the process exits.
+func (app *application) purgeDeletedAccounts(interval time.Duration) {
+	for {
+		n, err := app.users.Purge()
+		if err != nil {
+			app.errorLog.Println(err)
+		} else if n > 0 {
+			app.infoLog.Printf("Purged %d deleted accounts", n)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"snipit.bikraj.net/internal/models"
+	Validator "snipit.bikraj.net/internal/validator"
+)
+
+const (
+	adminSnippetLimit = 100
+	adminAuditLimit   = 50
+	auditSearchLimit  = 200
+)
+
+// moderationActions are what staff do to other users and their content,
+// as opposed to the login and account events that make up most of the log.
+var moderationActions = []string{"user.disable", "user.enable", "user.role", "snippet.delete", "invite.", "impersonate.", "template."}
+
+type adminRoleForm struct {
+	Role                string `form:"role"`
+	Validator.Validator `form:"-"`
+}
+
+// auditSearchForm is submitted with GET so that searches can be linked to.
+// Dates are whole days in UTC; Until includes the day it names.
+type auditSearchForm struct {
+	Email               string `form:"email"`
+	Action              string `form:"action"`
+	IP                  string `form:"ip"`
+	Since               string `form:"since"`
+	Until               string `form:"until"`
+	Validator.Validator `form:"-"`
+}
+
+func (app *application) adminDashboard(w http.ResponseWriter, r *http.Request) {
+	entries, err := app.audit.Search(models.AuditFilter{Actions: moderationActions, Limit: adminAuditLimit})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.User = app.currentUser(r)
+	data.AuditEntries = entries
+	app.render(w, http.StatusOK, "admin.tmpl.html", data)
+}
+
+func (app *application) adminUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := app.users.List()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.User = app.currentUser(r)
+	data.Users = users
+	app.render(w, http.StatusOK, "adminUsers.tmpl.html", data)
+}
+
+func (app *application) adminSnippets(w http.ResponseWriter, r *http.Request) {
+	snippets, err := app.snippets.Recent(adminSnippetLimit)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+	app.render(w, http.StatusOK, "adminSnippets.tmpl.html", data)
+}
+
+// adminTargetUser loads the user named by the :id parameter, answering 404
+// itself when there isn't one.
+func (app *application) adminTargetUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	id, err := strconv.Atoi(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return nil, false
+	}
+	user, err := app.users.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return nil, false
+	}
+	return user, true
+}
+
+// canManage reports whether actor may act on target's account: nobody acts
+// on themselves, and only admins act on other staff.
+func canManage(actor, target *models.User) bool {
+	if actor.ID == target.ID {
+		return false
+	}
+	return actor.HasRole(models.RoleAdmin) || !target.HasRole(models.RoleModerator)
+}
+
+func (app *application) adminUserDisablePost(w http.ResponseWriter, r *http.Request) {
+	app.adminSetDisabled(w, r, true)
+}
+
+func (app *application) adminUserEnablePost(w http.ResponseWriter, r *http.Request) {
+	app.adminSetDisabled(w, r, false)
+}
+
+func (app *application) adminSetDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	target, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+	actor := app.currentUser(r)
+	if !canManage(actor, target) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+	err := app.users.SetDisabled(target.ID, disabled)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	action, flash := "user.enable", "Account enabled."
+	if disabled {
+		action, flash = "user.disable", "Account disabled."
+		// Log them out everywhere now rather than on their next request.
+		err = app.userSessions.RevokeAll(target.ID, "")
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		err = app.rememberTokens.RevokeAll(target.ID, "")
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+	err = app.recordAudit(r, actor.ID, action, models.AuditTargetUser, target.ID, map[string]string{"email": target.Email})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", flash)
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+func (app *application) adminUserRolePost(w http.ResponseWriter, r *http.Request) {
+	target, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+	var form adminRoleForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form.CheckField(
+		Validator.PermittedValue(form.Role, models.RoleUser, models.RoleModerator, models.RoleAdmin),
+		"role",
+		"This field must equal user, moderator or admin",
+	)
+	if !form.Valid() {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	actor := app.currentUser(r)
+	// Admins can't demote themselves, so there is always one left.
+	if !canManage(actor, target) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+	err = app.users.SetRole(target.ID, form.Role)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.recordAudit(r, actor.ID, "user.role", models.AuditTargetUser, target.ID, map[string]string{
+		"email": target.Email,
+		"from":  target.Role,
+		"to":    form.Role,
+	})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Role updated.")
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+func (app *application) adminSnippetDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	err = app.snippets.DeleteAny(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.recordAudit(r, app.currentUser(r).ID, "snippet.delete", models.AuditTargetSnippet, id, map[string]string{
+		"title": snippet.Title,
+		"owner": strconv.Itoa(snippet.UserID),
+	})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Snippet deleted.")
+	http.Redirect(w, r, "/admin/snippets", http.StatusSeeOther)
+}
+
+// adminAudit searches the whole security log.
+func (app *application) adminAudit(w http.ResponseWriter, r *http.Request) {
+	var form auditSearchForm
+	err := app.formDecoder.Decode(&form, r.URL.Query())
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	filter := models.AuditFilter{IP: strings.TrimSpace(form.IP), Limit: auditSearchLimit}
+	if action := strings.TrimSpace(form.Action); action != "" {
+		filter.Actions = []string{action}
+	}
+	if form.Email != "" {
+		user, err := app.users.GetByEmail(strings.TrimSpace(form.Email))
+		if err == nil {
+			filter.UserID = user.ID
+		} else if errors.Is(err, models.ErrNoRecord) {
+			form.AddField("email", "No account has that email address")
+		} else {
+			app.serverError(w, err)
+			return
+		}
+	}
+	if form.Since != "" {
+		filter.Since, err = time.Parse("2006-01-02", form.Since)
+		form.CheckField(err == nil, "since", "Use a date like 2024-01-31")
+	}
+	if form.Until != "" {
+		filter.Until, err = time.Parse("2006-01-02", form.Until)
+		form.CheckField(err == nil, "until", "Use a date like 2024-01-31")
+		filter.Until = filter.Until.AddDate(0, 0, 1)
+	}
+
+	data := app.newTemplateData(r)
+	data.User = app.currentUser(r)
+	data.Form = form
+	if !form.Valid() {
+		data.AuditEntries = []*models.AuditEntry{}
+		app.render(w, http.StatusUnprocessableEntity, "adminAudit.tmpl.html", data)
+		return
+	}
+	data.AuditEntries, err = app.audit.Search(filter)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.render(w, http.StatusOK, "adminAudit.tmpl.html", data)
+}
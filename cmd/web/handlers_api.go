@@ -0,0 +1,413 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"snipit.bikraj.net/internal/models"
+	Validator "snipit.bikraj.net/internal/validator"
+	"snipit.bikraj.net/ui"
+)
+
+// apiSnippet is the JSON form of a snippet.
+type apiSnippet struct {
+	ID         int       `json:"id"`
+	OrgID      int       `json:"org_id,omitempty"`
+	Title      string    `json:"title"`
+	Content    string    `json:"content"`
+	Language   string    `json:"language"`
+	Visibility string    `json:"visibility"`
+	Created    time.Time `json:"created"`
+	Expires    time.Time `json:"expires"`
+}
+
+func newAPISnippet(s *models.Snippet) apiSnippet {
+	return apiSnippet{
+		ID:         s.ID,
+		OrgID:      s.OrgID,
+		Title:      s.Title,
+		Content:    s.Content,
+		Language:   s.Language,
+		Visibility: s.Visibility,
+		Created:    s.Created,
+		Expires:    s.Expires,
+	}
+}
+
+// apiSnippetList is a page of snippets. NextPage is left out on the last
+// page.
+type apiSnippetList struct {
+	Snippets []apiSnippet `json:"snippets"`
+	Page     int          `json:"page"`
+	PerPage  int          `json:"per_page"`
+	NextPage int          `json:"next_page,omitempty"`
+}
+
+type apiSnippetCreateRequest struct {
+	Title               string `json:"title"`
+	Content             string `json:"content"`
+	Language            string `json:"language"`
+	Visibility          string `json:"visibility"`
+	Expires             int    `json:"expires"`
+	OrgID               int    `json:"org_id"`
+	Validator.Validator `json:"-"`
+}
+
+// apiSnippetUpdateRequest holds the fields a PATCH changes; those left out
+// stay as they are. Expires, when given, restarts the snippet's clock.
+type apiSnippetUpdateRequest struct {
+	Title      *string `json:"title"`
+	Content    *string `json:"content"`
+	Language   *string `json:"language"`
+	Visibility *string `json:"visibility"`
+	Expires    *int    `json:"expires"`
+}
+
+const (
+	apiDefaultPerPage = 20
+	apiMaxPerPage     = 100
+)
+
+// Every API error carries one of these codes, so clients can branch on the
+// code instead of parsing messages. All but apiCodeValidation follow from
+// the status.
+const (
+	apiCodeBadRequest       = "bad_request"
+	apiCodeUnauthorized     = "unauthorized"
+	apiCodeForbidden        = "forbidden"
+	apiCodeNotFound         = "not_found"
+	apiCodeMethodNotAllowed = "method_not_allowed"
+	apiCodeTooLarge         = "too_large"
+	apiCodeValidation       = "validation_failed"
+	apiCodeInternal         = "internal_error"
+)
+
+var apiStatusCodes = map[int]string{
+	http.StatusBadRequest:            apiCodeBadRequest,
+	http.StatusUnauthorized:          apiCodeUnauthorized,
+	http.StatusForbidden:             apiCodeForbidden,
+	http.StatusNotFound:              apiCodeNotFound,
+	http.StatusMethodNotAllowed:      apiCodeMethodNotAllowed,
+	http.StatusRequestEntityTooLarge: apiCodeTooLarge,
+	http.StatusUnprocessableEntity:   apiCodeValidation,
+	http.StatusInternalServerError:   apiCodeInternal,
+}
+
+// apiErrorDocument is the body of every API error response. Fields maps
+// request fields, or query parameters, to what is wrong with them.
+type apiErrorDocument struct {
+	Error apiErrorDetail `json:"error"`
+}
+
+type apiErrorDetail struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+func (app *application) writeJSON(w http.ResponseWriter, status int, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(body, '\n'))
+}
+
+func (app *application) apiError(w http.ResponseWriter, status int, message string) {
+	app.apiFieldError(w, status, message, nil)
+}
+
+// apiFieldError reports problems with individual fields, as collected by a
+// Validator.
+func (app *application) apiFieldError(w http.ResponseWriter, status int, message string, fields map[string]string) {
+	code, ok := apiStatusCodes[status]
+	if !ok {
+		code = apiCodeBadRequest
+	}
+	app.writeJSON(w, status, apiErrorDocument{Error: apiErrorDetail{Code: code, Message: message, Fields: fields}})
+}
+
+func (app *application) apiServerError(w http.ResponseWriter, err error) {
+	app.errorLog.Output(2, err.Error())
+	app.apiError(w, http.StatusInternalServerError, "the server encountered a problem")
+}
+
+func (app *application) apiUnauthorized(w http.ResponseWriter, challenge string) {
+	w.Header().Set("WWW-Authenticate", challenge)
+	app.apiError(w, http.StatusUnauthorized, "a valid API token is required")
+}
+
+// apiNotFound and apiMethodNotAllowed answer for the router, so that
+// mistakes under /api get the same error document as everything else.
+func (app *application) apiNotFound(w http.ResponseWriter, r *http.Request) {
+	app.apiError(w, http.StatusNotFound, "no such API route")
+}
+
+func (app *application) apiMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	app.apiError(w, http.StatusMethodNotAllowed, fmt.Sprintf("%s is not allowed here; use %s", r.Method, w.Header().Get("Allow")))
+}
+
+// apiSpec serves the OpenAPI document describing the routes in apiRoutes.
+func (app *application) apiSpec(w http.ResponseWriter, r *http.Request) {
+	app.serveUIFile(w, "api/openapi.json", "application/json")
+}
+
+// apiDocs serves a page that lays out the OpenAPI document for people.
+func (app *application) apiDocs(w http.ResponseWriter, r *http.Request) {
+	app.serveUIFile(w, "api/docs.html", "text/html; charset=utf-8")
+}
+
+func (app *application) apiDocsScript(w http.ResponseWriter, r *http.Request) {
+	app.serveUIFile(w, "api/docs.js", "text/javascript; charset=utf-8")
+}
+
+func (app *application) serveUIFile(w http.ResponseWriter, name, contentType string) {
+	b, err := fs.ReadFile(ui.Files, name)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(b)
+}
+
+// decodeJSONBody reads a JSON object from the request into dst, answering
+// for itself and returning false when it can't.
+func (app *application) decodeJSONBody(w http.ResponseWriter, r *http.Request, dst any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, app.maxFormBytes())
+	err := json.NewDecoder(r.Body).Decode(dst)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			app.apiError(w, http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("content cannot be more than %d KB", app.maxContentBytes/1024))
+		} else {
+			app.apiError(w, http.StatusBadRequest, "the request body must be a JSON object")
+		}
+		return false
+	}
+	return true
+}
+
+// checkAPISnippet applies the snippet form's rules for title and content.
+func (app *application) checkAPISnippet(v *Validator.Validator, r *http.Request, title, content string) {
+	v.CheckField(Validator.NotBlank(title), "title", "This field cannot be blank")
+	v.CheckField(Validator.MaxChars(title, 100), "title", "This field cannot be more than 100 characters long")
+	app.checkContentSize(v, r, content)
+	v.CheckField(Validator.NotBlank(content), "content", "This field cannot be blank")
+}
+
+// apiSnippetID parses the :id parameter, returning 0 when it isn't valid.
+func apiSnippetID(r *http.Request) int {
+	id, err := strconv.Atoi(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+	if err != nil || id < 1 {
+		return 0
+	}
+	return id
+}
+
+func (app *application) apiSnippetGet(w http.ResponseWriter, r *http.Request) {
+	id := apiSnippetID(r)
+	if id == 0 {
+		app.apiError(w, http.StatusNotFound, "snippet not found")
+		return
+	}
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiError(w, http.StatusNotFound, "snippet not found")
+		} else {
+			app.apiServerError(w, err)
+		}
+		return
+	}
+	if ok, err := app.canView(r, snippet); err != nil {
+		app.apiServerError(w, err)
+		return
+	} else if !ok {
+		app.apiError(w, http.StatusNotFound, "snippet not found")
+		return
+	}
+	app.writeJSON(w, http.StatusOK, newAPISnippet(snippet))
+}
+
+// apiSnippetList lists the token owner's unexpired snippets, newest first.
+func (app *application) apiSnippetList(w http.ResponseWriter, r *http.Request) {
+	var v Validator.Validator
+	page, perPage := 1, apiDefaultPerPage
+	query := r.URL.Query()
+	if s := query.Get("page"); s != "" {
+		n, err := strconv.Atoi(s)
+		v.CheckField(err == nil && n >= 1, "page", "This parameter must be a whole number of at least 1")
+		page = n
+	}
+	if s := query.Get("per_page"); s != "" {
+		n, err := strconv.Atoi(s)
+		v.CheckField(err == nil && n >= 1 && n <= apiMaxPerPage, "per_page",
+			fmt.Sprintf("This parameter must be a whole number from 1 to %d", apiMaxPerPage))
+		perPage = n
+	}
+	if !v.Valid() {
+		app.apiFieldError(w, http.StatusBadRequest, "the query is not valid", v.FieldErrors)
+		return
+	}
+
+	// One extra row says whether there is another page.
+	snippets, err := app.snippets.PageForUser(app.authenticatedUserID(r), perPage+1, (page-1)*perPage)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+	list := apiSnippetList{Snippets: []apiSnippet{}, Page: page, PerPage: perPage}
+	if len(snippets) > perPage {
+		snippets = snippets[:perPage]
+		list.NextPage = page + 1
+	}
+	for _, s := range snippets {
+		list.Snippets = append(list.Snippets, newAPISnippet(s))
+	}
+	app.writeJSON(w, http.StatusOK, list)
+}
+
+func (app *application) apiSnippetCreate(w http.ResponseWriter, r *http.Request) {
+	req := apiSnippetCreateRequest{
+		Visibility: models.VisibilityPublic,
+		Expires:    365,
+	}
+	if !app.decodeJSONBody(w, r, &req) {
+		return
+	}
+	app.checkAPISnippet(&req.Validator, r, req.Title, req.Content)
+	checkSnippetDefaults(&req.Validator, req.Language, req.Visibility, req.Expires)
+	userID := app.authenticatedUserID(r)
+	err := app.checkSnippetOrg(&req.Validator, userID, req.OrgID, req.Visibility)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+	if !req.Valid() {
+		app.apiFieldError(w, http.StatusUnprocessableEntity, "the snippet is not valid", req.FieldErrors)
+		return
+	}
+
+	id, err := app.snippets.Insert(userID, req.OrgID, req.Title, req.Content, req.Language, req.Visibility, req.Expires)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/snippets/%d", id))
+	app.writeJSON(w, http.StatusCreated, apiSnippet{
+		ID:         id,
+		OrgID:      req.OrgID,
+		Title:      req.Title,
+		Content:    req.Content,
+		Language:   req.Language,
+		Visibility: req.Visibility,
+		Created:    now,
+		Expires:    now.AddDate(0, 0, req.Expires),
+	})
+}
+
+// apiSnippetUpdate changes the fields given in the body of a snippet the
+// token's owner created. Snippets they can only read are as good as
+// missing.
+func (app *application) apiSnippetUpdate(w http.ResponseWriter, r *http.Request) {
+	id := apiSnippetID(r)
+	if id == 0 {
+		app.apiError(w, http.StatusNotFound, "snippet not found")
+		return
+	}
+	userID := app.authenticatedUserID(r)
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiError(w, http.StatusNotFound, "snippet not found")
+		} else {
+			app.apiServerError(w, err)
+		}
+		return
+	}
+	if snippet.UserID != userID {
+		app.apiError(w, http.StatusNotFound, "snippet not found")
+		return
+	}
+	var req apiSnippetUpdateRequest
+	if !app.decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	updated := *snippet
+	for _, f := range []struct {
+		dst *string
+		src *string
+	}{
+		{&updated.Title, req.Title},
+		{&updated.Content, req.Content},
+		{&updated.Language, req.Language},
+		{&updated.Visibility, req.Visibility},
+	} {
+		if f.src != nil {
+			*f.dst = *f.src
+		}
+	}
+	// An expiry of 0 leaves the current one alone; a year stands in for it
+	// while checking the rest.
+	expires, checkExpires := 0, 365
+	if req.Expires != nil {
+		expires, checkExpires = *req.Expires, *req.Expires
+	}
+	var v Validator.Validator
+	app.checkAPISnippet(&v, r, updated.Title, updated.Content)
+	checkSnippetDefaults(&v, updated.Language, updated.Visibility, checkExpires)
+	err = app.checkSnippetOrg(&v, userID, updated.OrgID, updated.Visibility)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+	if !v.Valid() {
+		app.apiFieldError(w, http.StatusUnprocessableEntity, "the snippet is not valid", v.FieldErrors)
+		return
+	}
+
+	err = app.snippets.Update(id, userID, updated.Title, updated.Content, updated.Language, updated.Visibility, expires)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiError(w, http.StatusNotFound, "snippet not found")
+		} else {
+			app.apiServerError(w, err)
+		}
+		return
+	}
+	if expires != 0 {
+		updated.Expires = time.Now().UTC().Truncate(time.Second).AddDate(0, 0, expires)
+	}
+	app.writeJSON(w, http.StatusOK, newAPISnippet(&updated))
+}
+
+func (app *application) apiSnippetDelete(w http.ResponseWriter, r *http.Request) {
+	id := apiSnippetID(r)
+	if id == 0 {
+		app.apiError(w, http.StatusNotFound, "snippet not found")
+		return
+	}
+	err := app.snippets.Delete(id, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiError(w, http.StatusNotFound, "snippet not found")
+		} else {
+			app.apiServerError(w, err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"snipit.bikraj.net/internal/models"
+)
+
+// Impersonation lets an admin see the site as a user does, to follow up on
+// a report. The session's authenticatedUserID becomes the user's while
+// impersonatorID holds the admin's, so everything that reads the current
+// user sees the user; the session record and remember token stay the
+// admin's. Routes wrapped in forbidImpersonation stay out of reach.
+
+// adminImpersonatePost starts impersonating the user named in the URL.
+// Other staff can't be impersonated, so nothing done this way turns up in
+// the moderation log under someone else's name.
+func (app *application) adminImpersonatePost(w http.ResponseWriter, r *http.Request) {
+	target, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+	actor := app.currentUser(r)
+	if actor.ID == target.ID || target.HasRole(models.RoleModerator) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+	if target.Disabled {
+		app.sessionManager.Put(r.Context(), "flash", "Disabled accounts can't be impersonated.")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+	err := app.recordAudit(r, actor.ID, "impersonate.start", models.AuditTargetUser, target.ID, map[string]string{"email": target.Email})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "impersonatorID", actor.ID)
+	app.sessionManager.Put(r.Context(), "authenticatedUserID", target.ID)
+	app.sessionManager.Put(r.Context(), "flash", "You are now viewing Snippetbox as "+target.Name+".")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// impersonateStopPost returns the admin to their own account. It can't sit
+// behind requireRole, because the current user is the one impersonated.
+func (app *application) impersonateStopPost(w http.ResponseWriter, r *http.Request) {
+	impersonator := app.impersonator(r)
+	if impersonator == nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	err := app.endImpersonation(r, impersonator.ID, app.authenticatedUserID(r), nil)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "You are back to your own account.")
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// endImpersonation switches the session back to the admin and logs it.
+func (app *application) endImpersonation(r *http.Request, impersonatorID, userID int, details map[string]string) error {
+	err := app.recordAudit(r, impersonatorID, "impersonate.stop", models.AuditTargetUser, userID, details)
+	if err != nil {
+		return err
+	}
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		return err
+	}
+	app.sessionManager.Put(r.Context(), "authenticatedUserID", impersonatorID)
+	app.sessionManager.Remove(r.Context(), "impersonatorID")
+	return nil
+}
+
+// checkImpersonator loads the admin behind an impersonation for
+// authenticate. If they are no longer an active admin the impersonation
+// is ended and nil is returned.
+func (app *application) checkImpersonator(r *http.Request, impersonatorID, userID int) (*models.User, error) {
+	admin, err := app.users.Get(impersonatorID)
+	if err == nil && !admin.Disabled && admin.HasRole(models.RoleAdmin) {
+		return admin, nil
+	}
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		return nil, err
+	}
+	return nil, app.endImpersonation(r, impersonatorID, userID, map[string]string{"reason": "revoked"})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"snipit.bikraj.net/internal/models"
+	Validator "snipit.bikraj.net/internal/validator"
+)
+
+type inviteForm struct {
+	Note                string `form:"note"`
+	MaxUses             int    `form:"max_uses"`
+	Expires             int    `form:"expires"`
+	Validator.Validator `form:"-"`
+}
+
+func (app *application) renderInvites(w http.ResponseWriter, r *http.Request, status int, form inviteForm, newCode string) {
+	invites, err := app.invites.All()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.Form = form
+	data.Invites = invites
+	data.NewInviteCode = newCode
+	if newCode != "" {
+		data.InviteLink = app.baseURL + "/user/signup?invite=" + url.QueryEscape(newCode)
+	}
+	data.Signup = app.signup
+	app.render(w, status, "adminInvites.tmpl.html", data)
+}
+
+func (app *application) adminInvites(w http.ResponseWriter, r *http.Request) {
+	app.renderInvites(w, r, http.StatusOK, inviteForm{MaxUses: 1, Expires: 7}, "")
+}
+
+func (app *application) adminInviteCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form inviteForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form.CheckField(Validator.MaxChars(form.Note, 100), "note", "This field cannot be more than 100 characters long")
+	form.CheckField(form.MaxUses >= 1 && form.MaxUses <= 1000, "max_uses", "This field must be between 1 and 1000")
+	form.CheckField(Validator.PermittedValue(form.Expires, 1, 7, 30, 90), "expires", "This field must equal 1, 7, 30 or 90")
+	if !form.Valid() {
+		app.renderInvites(w, r, http.StatusUnprocessableEntity, form, "")
+		return
+	}
+
+	actorID := app.authenticatedUserID(r)
+	expires := time.Now().AddDate(0, 0, form.Expires)
+	code, err := app.invites.Insert(actorID, form.Note, form.MaxUses, expires)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.recordAudit(r, actorID, "invite.create", models.AuditTargetUser, actorID, map[string]string{
+		"note":     form.Note,
+		"max_uses": strconv.Itoa(form.MaxUses),
+		"expires":  expires.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.renderInvites(w, r, http.StatusOK, inviteForm{MaxUses: 1, Expires: 7}, code)
+}
+
+func (app *application) adminInviteRevokePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+	err = app.invites.Revoke(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	actorID := app.authenticatedUserID(r)
+	err = app.recordAudit(r, actorID, "invite.revoke", models.AuditTargetUser, actorID, map[string]string{"invite": strconv.Itoa(id)})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Invite revoked.")
+	http.Redirect(w, r, "/admin/invites", http.StatusSeeOther)
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"snipit.bikraj.net/internal/models"
+	"snipit.bikraj.net/internal/oidc"
+	Validator "snipit.bikraj.net/internal/validator"
+)
+
+// oidcFlowTTL is how long a user has to finish logging in at the provider.
+const oidcFlowTTL = 10 * time.Minute
+
+var (
+	errOIDCEmailUnverified   = errors.New("oidc: provider did not verify the email address")
+	errOIDCAccountUnverified = errors.New("oidc: matching account has not verified its email address")
+	errOIDCSignupInvite      = errors.New("oidc: new accounts need an invite code")
+	errOIDCSignupDomain      = errors.New("oidc: email domain may not sign up")
+)
+
+func (app *application) oidcProvider(r *http.Request) *oidc.Provider {
+	name := httprouter.ParamsFromContext(r.Context()).ByName("provider")
+	for _, p := range app.oidcProviders {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// oidcLoginFailed sends the user back to the login page with msg.
+func (app *application) oidcLoginFailed(w http.ResponseWriter, r *http.Request, msg string) {
+	app.sessionManager.Put(r.Context(), "flash", msg)
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// oidcLogin starts the authorization code flow. The state, nonce and PKCE
+// verifier stay in the session until the provider sends the user back.
+func (app *application) oidcLogin(w http.ResponseWriter, r *http.Request) {
+	p := app.oidcProvider(r)
+	if p == nil {
+		app.notFound(w)
+		return
+	}
+	var values [3]string
+	for i := range values {
+		v, err := oidc.RandomString()
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		values[i] = v
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+	authURL, err := p.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		app.errorLog.Println(err)
+		app.oidcLoginFailed(w, r, fmt.Sprintf("Logging in with %s is unavailable right now.", p.DisplayLabel()))
+		return
+	}
+	app.sessionManager.Put(r.Context(), "oidcProvider", p.Name)
+	app.sessionManager.Put(r.Context(), "oidcState", state)
+	app.sessionManager.Put(r.Context(), "oidcNonce", nonce)
+	app.sessionManager.Put(r.Context(), "oidcVerifier", verifier)
+	app.sessionManager.Put(r.Context(), "oidcStarted", time.Now().Unix())
+	http.Redirect(w, r, authURL, http.StatusSeeOther)
+}
+
+func (app *application) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	p := app.oidcProvider(r)
+	if p == nil {
+		app.notFound(w)
+		return
+	}
+	ctx := r.Context()
+	// Each flow can be completed once; everything is popped up front.
+	provider := app.sessionManager.PopString(ctx, "oidcProvider")
+	state := app.sessionManager.PopString(ctx, "oidcState")
+	nonce := app.sessionManager.PopString(ctx, "oidcNonce")
+	verifier := app.sessionManager.PopString(ctx, "oidcVerifier")
+	started := time.Unix(app.sessionManager.GetInt64(ctx, "oidcStarted"), 0)
+	app.sessionManager.Remove(ctx, "oidcStarted")
+
+	q := r.URL.Query()
+	if provider != p.Name || state == "" || time.Since(started) > oidcFlowTTL ||
+		subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(state)) != 1 {
+		app.oidcLoginFailed(w, r, "That login attempt has expired. Please try again.")
+		return
+	}
+	if q.Get("error") != "" {
+		app.oidcLoginFailed(w, r, fmt.Sprintf("Logging in with %s was cancelled.", p.DisplayLabel()))
+		return
+	}
+	claims, err := p.Exchange(ctx, q.Get("code"), verifier, nonce)
+	if err != nil {
+		app.errorLog.Println(err)
+		app.oidcLoginFailed(w, r, fmt.Sprintf("We couldn't log you in with %s.", p.DisplayLabel()))
+		return
+	}
+	id, err := app.oidcUser(p.Name, claims)
+	switch {
+	case errors.Is(err, errOIDCEmailUnverified):
+		app.oidcLoginFailed(w, r, fmt.Sprintf("%s has not verified your email address, so we can't log you in with it.", p.DisplayLabel()))
+		return
+	case errors.Is(err, models.ErrAccountDisabled):
+		app.oidcLoginFailed(w, r, "This account has been disabled.")
+		return
+	case errors.Is(err, errOIDCAccountUnverified):
+		app.oidcLoginFailed(w, r, fmt.Sprintf(
+			"An account with this email already exists. Log in with your password and verify your email before using %s.",
+			p.DisplayLabel()))
+		return
+	case errors.Is(err, errOIDCSignupInvite):
+		app.oidcLoginFailed(w, r, fmt.Sprintf(
+			"New accounts need an invite code. Sign up with yours, verify your email, and then you can log in with %s.",
+			p.DisplayLabel()))
+		return
+	case errors.Is(err, errOIDCSignupDomain):
+		app.oidcLoginFailed(w, r, fmt.Sprintf("Accounts can only be created with an address at %s.", app.signup.DomainList()))
+		return
+	case err != nil:
+		app.serverError(w, err)
+		return
+	}
+	app.continueLogin(w, r, id, "oidc:"+p.Name)
+}
+
+// oidcUser finds the account for a provider's user. A new identity is
+// linked to the account with the same email address, or to a freshly
+// provisioned one, but only when the provider vouches for the address.
+// Accounts that never verified their address aren't linked, since whoever
+// registered them may not own it and would keep their password.
+func (app *application) oidcUser(provider string, claims *oidc.Claims) (int, error) {
+	id, err := app.identities.UserID(provider, claims.Subject)
+	if err == nil {
+		user, err := app.users.Get(id)
+		if err != nil {
+			return 0, err
+		}
+		if user.Disabled {
+			return 0, models.ErrAccountDisabled
+		}
+		return id, nil
+	} else if !errors.Is(err, models.ErrNoRecord) {
+		return 0, err
+	}
+	if claims.Email == "" || !claims.EmailVerified {
+		return 0, errOIDCEmailUnverified
+	}
+
+	user, err := app.users.GetByEmail(claims.Email)
+	switch {
+	case err == nil:
+		if !user.Verified {
+			return 0, errOIDCAccountUnverified
+		}
+		if user.Disabled {
+			return 0, models.ErrAccountDisabled
+		}
+		id = user.ID
+	case errors.Is(err, models.ErrNoRecord):
+		// New accounts follow the signup policy like the signup form.
+		if app.signup.NeedsInvite() {
+			return 0, errOIDCSignupInvite
+		}
+		if !app.signup.AllowsEmail(claims.Email) {
+			return 0, errOIDCSignupDomain
+		}
+		id, err = app.provisionOIDCUser(claims)
+		if err != nil {
+			return 0, err
+		}
+	default:
+		return 0, err
+	}
+	err = app.identities.Link(id, provider, claims.Subject)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// provisionOIDCUser creates an account for a first-time SSO user. It gets a
+// random password nobody knows; a real one can be set through the password
+// reset flow.
+func (app *application) provisionOIDCUser(claims *oidc.Claims) (int, error) {
+	name := claims.Name
+	if name == "" {
+		name = claims.PreferredUsername
+	}
+	if name == "" {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return 0, err
+	}
+	password := base64.RawURLEncoding.EncodeToString(b)
+	base := claims.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	username := suggestUsername(base)
+	for attempt := 0; ; attempt++ {
+		id, err := app.users.Insert(name, username, claims.Email, password)
+		if errors.Is(err, models.ErrDuplicateUsername) && attempt < 5 {
+			username, err = numberedUsername(base)
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		return id, app.users.SetVerified(id)
+	}
+}
+
+// suggestUsername turns s into something that passes the username checks,
+// for accounts created without a signup form. Users can change it later.
+func suggestUsername(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-':
+			b.WriteRune(r)
+		case r == '.' || r == ' ' || r == '+':
+			b.WriteRune('-')
+		}
+	}
+	username := b.String()
+	if len(username) > 24 {
+		username = username[:24]
+	}
+	username = strings.Trim(username, "_-")
+	if !Validator.Matches(username, Validator.UsernameRX) || !Validator.NotReserved(username) {
+		username = "coder-" + username
+		username = strings.Trim(username[:min(len(username), 24)], "_-")
+	}
+	return username
+}
+
+// numberedUsername adds a random number to the suggestion for s, for when
+// the plain one is taken.
+func numberedUsername(s string) (string, error) {
+	b := make([]byte, 2)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%d", suggestUsername(s), int(b[0])<<8|int(b[1])), nil
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"snipit.bikraj.net/internal/mailer"
+	"snipit.bikraj.net/internal/models"
+	Validator "snipit.bikraj.net/internal/validator"
+)
+
+const (
+	orgInvitationTTL = 7 * 24 * time.Hour
+	orgSnippetLimit  = 50
+)
+
+// orgSlugRX matches the short names used in /org/:slug URLs.
+var orgSlugRX = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9-]{0,38}[a-z0-9])?$`)
+
+type orgCreateForm struct {
+	Name                string `form:"name"`
+	Slug                string `form:"slug"`
+	Validator.Validator `form:"-"`
+}
+
+type orgInviteForm struct {
+	Email               string `form:"email"`
+	Role                string `form:"role"`
+	Validator.Validator `form:"-"`
+}
+
+// snippetFormData prepares the create page, which offers the user's
+// organizations as owners.
+func (app *application) snippetFormData(r *http.Request, form snippetCreateForm) (*templateData, error) {
+	orgs, err := app.orgs.ForUser(app.authenticatedUserID(r))
+	if err != nil {
+		return nil, err
+	}
+	data := app.newTemplateData(r)
+	data.Form = form
+	data.Organizations = orgs
+	return data, nil
+}
+
+// checkSnippetOrg makes sure a snippet is only filed under an organization
+// the user belongs to, that organization visibility has one to refer to and
+// that nothing else is filed under one, where other members would see it
+// listed.
+func (app *application) checkSnippetOrg(v *Validator.Validator, userID, orgID int, visibility string) error {
+	if orgID == 0 {
+		v.CheckField(visibility != models.VisibilityOrganization, "org_id", "Choose an organization for organization snippets")
+		return nil
+	}
+	if visibility != models.VisibilityOrganization {
+		v.AddField("org_id", "Only organization snippets can belong to an organization")
+		return nil
+	}
+	_, err := app.orgs.Role(orgID, userID)
+	if errors.Is(err, models.ErrNoRecord) {
+		v.AddField("org_id", "You are not a member of that organization")
+		return nil
+	}
+	return err
+}
+
+// orgMembership loads the organization named in the URL together with the
+// current user's role in it. Non-members get ErrNoRecord so that private
+// organizations don't show up as existing.
+func (app *application) orgMembership(r *http.Request) (*models.Organization, string, error) {
+	org, err := app.orgs.GetBySlug(httprouter.ParamsFromContext(r.Context()).ByName("slug"))
+	if err != nil {
+		return nil, "", err
+	}
+	role, err := app.orgs.Role(org.ID, app.authenticatedUserID(r))
+	if err != nil {
+		return nil, "", err
+	}
+	org.Role = role
+	return org, role, nil
+}
+
+func (app *application) renderOrgs(w http.ResponseWriter, r *http.Request, status int, form orgCreateForm) {
+	orgs, err := app.orgs.ForUser(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.Form = form
+	data.Organizations = orgs
+	app.render(w, status, "orgs.tmpl.html", data)
+}
+
+func (app *application) orgList(w http.ResponseWriter, r *http.Request) {
+	app.renderOrgs(w, r, http.StatusOK, orgCreateForm{})
+}
+
+func (app *application) orgCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form orgCreateForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form.Slug = strings.ToLower(strings.TrimSpace(form.Slug))
+	form.CheckField(Validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(Validator.MaxChars(form.Name, 100), "name", "This field cannot be more than 100 characters long")
+	form.CheckField(Validator.NoControlChars(form.Name), "name", "This field cannot contain line breaks or control characters")
+	form.CheckField(
+		Validator.Matches(form.Slug, orgSlugRX),
+		"slug",
+		"Use up to 40 lowercase letters, digits and dashes",
+	)
+	if !form.Valid() {
+		app.renderOrgs(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	_, err = app.orgs.Insert(form.Name, form.Slug, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateSlug) {
+			form.AddField("slug", "That name is already taken")
+			app.renderOrgs(w, r, http.StatusUnprocessableEntity, form)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Your organization has been created.")
+	http.Redirect(w, r, "/org/"+form.Slug, http.StatusSeeOther)
+}
+
+func (app *application) renderOrg(w http.ResponseWriter, r *http.Request, status int, org *models.Organization, form orgInviteForm) {
+	members, err := app.orgs.Members(org.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	all, err := app.snippets.ForOrg(org.ID, orgSnippetLimit)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	// Snippets filed under the organization before they were made private
+	// stay with their owner.
+	snippets := []*models.Snippet{}
+	for _, s := range all {
+		ok, err := app.canView(r, s)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		if ok {
+			snippets = append(snippets, s)
+		}
+	}
+	data := app.newTemplateData(r)
+	data.User = app.currentUser(r)
+	data.Organization = org
+	data.OrgMembers = members
+	data.Snippets = snippets
+	data.Form = form
+	app.render(w, status, "org.tmpl.html", data)
+}
+
+func (app *application) orgView(w http.ResponseWriter, r *http.Request) {
+	org, _, err := app.orgMembership(r)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	app.renderOrg(w, r, http.StatusOK, org, orgInviteForm{Role: models.OrgRoleMember})
+}
+
+// sendOrgInvitation mails the link that lets email join org.
+func (app *application) sendOrgInvitation(org *models.Organization, inviter *models.User, email, token string) error {
+	return app.mailer.Send(mailer.Message{
+		To:      email,
+		Subject: fmt.Sprintf("Join %s on Snippetbox", org.Name),
+		Body: fmt.Sprintf("Hi,\n\n%s has invited you to join %s on Snippetbox. "+
+			"Open the link below to accept. It is valid for %d days.\n\n%s/org/%s/invite/%s\n",
+			inviter.Name, org.Name, int(orgInvitationTTL.Hours()/24), app.baseURL, org.Slug, token),
+	})
+}
+
+func (app *application) orgInvitePost(w http.ResponseWriter, r *http.Request) {
+	org, role, err := app.orgMembership(r)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	if role != models.OrgRoleOwner {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+	var form orgInviteForm
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form.CheckField(Validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(Validator.Matches(form.Email, Validator.EmailRX), "email", "This field must be a valid email address")
+	form.CheckField(
+		Validator.PermittedValue(form.Role, models.OrgRoleOwner, models.OrgRoleMember),
+		"role",
+		"This field must equal owner or member",
+	)
+	if !form.Valid() {
+		app.renderOrg(w, r, http.StatusUnprocessableEntity, org, form)
+		return
+	}
+
+	token, err := app.orgs.Invite(org.ID, form.Email, form.Role, app.authenticatedUserID(r), orgInvitationTTL)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.sendOrgInvitation(org, app.currentUser(r), form.Email, token)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("An invitation has been sent to %s.", form.Email))
+	http.Redirect(w, r, "/org/"+org.Slug, http.StatusSeeOther)
+}
+
+// orgInvitation loads the invitation in the URL. Anything that doesn't
+// match a live invitation reads as ErrNoRecord.
+func (app *application) orgInvitation(r *http.Request) (*models.Organization, *models.OrgInvitation, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+	org, err := app.orgs.GetBySlug(params.ByName("slug"))
+	if err != nil {
+		return nil, nil, err
+	}
+	inv, err := app.orgs.Invitation(org.ID, params.ByName("token"))
+	if err != nil {
+		return nil, nil, err
+	}
+	return org, inv, nil
+}
+
+func (app *application) orgInviteView(w http.ResponseWriter, r *http.Request) {
+	org, inv, err := app.orgInvitation(r)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.sessionManager.Put(r.Context(), "flash", "That invitation is invalid or has expired.")
+			http.Redirect(w, r, "/account/orgs", http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	data := app.newTemplateData(r)
+	data.Organization = org
+	data.Invitation = inv
+	data.User = app.currentUser(r)
+	app.render(w, http.StatusOK, "orgInvite.tmpl.html", data)
+}
+
+func (app *application) orgInviteAcceptPost(w http.ResponseWriter, r *http.Request) {
+	org, inv, err := app.orgInvitation(r)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.sessionManager.Put(r.Context(), "flash", "That invitation is invalid or has expired.")
+			http.Redirect(w, r, "/account/orgs", http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	// The link is only good for the account the invitation was sent to.
+	user := app.currentUser(r)
+	if !strings.EqualFold(user.Email, inv.Email) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+	err = app.orgs.AcceptInvitation(org.ID, httprouter.ParamsFromContext(r.Context()).ByName("token"), user.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.sessionManager.Put(r.Context(), "flash", "That invitation is invalid or has expired.")
+			http.Redirect(w, r, "/account/orgs", http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Welcome to %s!", org.Name))
+	http.Redirect(w, r, "/org/"+org.Slug, http.StatusSeeOther)
+}
+
+// orgMemberRemovePost lets owners remove members and members leave. An
+// organization always keeps at least one owner.
+func (app *application) orgMemberRemovePost(w http.ResponseWriter, r *http.Request) {
+	org, role, err := app.orgMembership(r)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	id, err := strconv.Atoi(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+	userID := app.authenticatedUserID(r)
+	if id != userID && role != models.OrgRoleOwner {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	members, err := app.orgs.Members(org.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	var target *models.OrgMember
+	owners := 0
+	for _, m := range members {
+		if m.UserID == id {
+			target = m
+		}
+		if m.Role == models.OrgRoleOwner {
+			owners++
+		}
+	}
+	if target == nil {
+		app.notFound(w)
+		return
+	}
+	if target.Role == models.OrgRoleOwner && owners == 1 {
+		app.sessionManager.Put(r.Context(), "flash", "An organization needs at least one owner.")
+		http.Redirect(w, r, "/org/"+org.Slug, http.StatusSeeOther)
+		return
+	}
+
+	err = app.orgs.RemoveMember(org.ID, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	if id == userID {
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("You have left %s.", org.Name))
+		http.Redirect(w, r, "/account/orgs", http.StatusSeeOther)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("%s has been removed.", target.Name))
+	http.Redirect(w, r, "/org/"+org.Slug, http.StatusSeeOther)
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"snipit.bikraj.net/internal/models"
+	Validator "snipit.bikraj.net/internal/validator"
+	"snipit.bikraj.net/internal/webauthn"
+)
+
+// The browser posts WebAuthn's binary values base64url encoded, the same
+// way the options are sent to it.
+var passkeyEncoding = base64.RawURLEncoding
+
+type passkeyForm struct {
+	Name                string `form:"name"`
+	ClientDataJSON      string `form:"client_data_json"`
+	AttestationObject   string `form:"attestation_object"`
+	Validator.Validator `form:"-"`
+}
+
+func (app *application) renderPasskeys(w http.ResponseWriter, r *http.Request, status int, form passkeyForm) {
+	passkeys, err := app.passkeys.ForUser(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.Form = form
+	data.Passkeys = passkeys
+	app.render(w, status, "passkeys.tmpl.html", data)
+}
+
+func (app *application) passkeyList(w http.ResponseWriter, r *http.Request) {
+	app.renderPasskeys(w, r, http.StatusOK, passkeyForm{})
+}
+
+// passkeyCreateOptions starts registering a passkey. The page's script
+// passes the options to navigator.credentials.create and posts the result
+// to passkeyCreatePost; the challenge waits in the session until then.
+func (app *application) passkeyCreateOptions(w http.ResponseWriter, r *http.Request) {
+	user := app.currentUser(r)
+	passkeys, err := app.passkeys.ForUser(user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	exclude := make([][]byte, 0, len(passkeys))
+	for _, p := range passkeys {
+		exclude = append(exclude, p.CredentialID)
+	}
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "passkeyCreateChallenge", challenge)
+	userHandle := []byte(strconv.Itoa(user.ID))
+	app.writeJSON(w, http.StatusOK, app.relyingParty.CreationOptions(challenge, userHandle, user.Email, user.Name, exclude))
+}
+
+func (app *application) passkeyCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form passkeyForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	// Each challenge is good for one attempt.
+	challenge := app.sessionManager.PopBytes(r.Context(), "passkeyCreateChallenge")
+	form.Name = strings.TrimSpace(form.Name)
+	if form.Name == "" {
+		form.Name = "Passkey"
+	}
+	form.CheckField(Validator.MaxChars(form.Name, 100), "name", "This field cannot be more than 100 characters long")
+	var cred *webauthn.Credential
+	clientData, err1 := passkeyEncoding.DecodeString(form.ClientDataJSON)
+	attestation, err2 := passkeyEncoding.DecodeString(form.AttestationObject)
+	if err1 == nil && err2 == nil {
+		cred, err = app.relyingParty.VerifyRegistration(clientData, attestation, challenge)
+		if err != nil && !errors.Is(err, webauthn.ErrInvalidResponse) {
+			app.serverError(w, err)
+			return
+		}
+	}
+	form.CheckField(cred != nil, "passkey", "Your passkey couldn't be verified. Please try again.")
+	if !form.Valid() {
+		app.renderPasskeys(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+	_, err = app.passkeys.Insert(userID, form.Name, cred.ID, cred.PublicKey, cred.SignCount)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateCredential) {
+			form.AddField("passkey", "This passkey has already been added")
+			app.renderPasskeys(w, r, http.StatusUnprocessableEntity, form)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	err = app.recordAudit(r, userID, "passkey.add", models.AuditTargetUser, userID, map[string]string{"name": form.Name})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Your passkey has been added. You can now use it to log in.")
+	http.Redirect(w, r, "/account/passkeys", http.StatusSeeOther)
+}
+
+func (app *application) passkeyDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+	userID := app.authenticatedUserID(r)
+	err = app.passkeys.Delete(id, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	err = app.recordAudit(r, userID, "passkey.delete", models.AuditTargetUser, userID, map[string]string{"id": strconv.Itoa(id)})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Your passkey has been removed.")
+	http.Redirect(w, r, "/account/passkeys", http.StatusSeeOther)
+}
+
+// passkeyLoginOptions starts a passkey login. No account is named, so the
+// browser offers whichever passkeys it holds for the site and the posted
+// assertion says which one was used.
+func (app *application) passkeyLoginOptions(w http.ResponseWriter, r *http.Request) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "passkeyLoginChallenge", challenge)
+	app.writeJSON(w, http.StatusOK, app.relyingParty.RequestOptions(challenge))
+}
+
+// passkeyLogin finishes a login posted to userLoginPost with a passkey
+// assertion instead of a password. Passkeys are only created with user
+// verification, so the device's PIN or biometric stands in for a second
+// factor and the TOTP step is skipped.
+func (app *application) passkeyLogin(w http.ResponseWriter, r *http.Request, form userLoginForm) {
+	challenge := app.sessionManager.PopBytes(r.Context(), "passkeyLoginChallenge")
+	ip := clientIP(r)
+	ipAttempt, err := app.loginIPGuard.Attempt(ip)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if !ipAttempt.Allowed {
+		app.lockedOut(w, r, form, ipAttempt.Wait)
+		return
+	}
+
+	passkey, reason, err := app.checkPasskeyAssertion(form, challenge)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if reason == "" {
+		err = app.loginIPGuard.Forgive(ip, ipAttempt)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	} else {
+		targetID := 0
+		if passkey != nil {
+			targetID = passkey.UserID
+		}
+		app.passkeyLoginFailed(w, r, form, targetID, reason, http.StatusUnprocessableEntity, "That passkey couldn't be used to log in")
+		return
+	}
+	user, err := app.users.Get(passkey.UserID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.passkeyLoginFailed(w, r, form, 0, "passkey", http.StatusUnprocessableEntity, "That passkey couldn't be used to log in")
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	if user.Disabled {
+		app.passkeyLoginFailed(w, r, form, user.ID, "disabled", http.StatusForbidden, "This account has been disabled")
+		return
+	}
+	app.sessionManager.Put(r.Context(), "rememberMe", form.Remember)
+	app.sessionManager.Put(r.Context(), "loginMethod", "passkey")
+	app.completeLogin(w, r, user.ID)
+}
+
+// checkPasskeyAssertion verifies the posted assertion and saves the new
+// signature counter. A rejected assertion gives the reason for the
+// security log, and the passkey if it was found.
+func (app *application) checkPasskeyAssertion(form userLoginForm, challenge []byte) (*models.Passkey, string, error) {
+	var values [][]byte
+	for _, s := range []string{form.CredentialID, form.ClientDataJSON, form.AuthenticatorData, form.Signature, form.UserHandle} {
+		b, err := passkeyEncoding.DecodeString(s)
+		if err != nil {
+			return nil, "passkey", nil
+		}
+		values = append(values, b)
+	}
+	credentialID, clientData, authData, signature, userHandle := values[0], values[1], values[2], values[3], values[4]
+	passkey, err := app.passkeys.Get(credentialID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil, "passkey", nil
+		}
+		return nil, "", err
+	}
+	if string(userHandle) != strconv.Itoa(passkey.UserID) {
+		return passkey, "passkey", nil
+	}
+	cred := &webauthn.Credential{ID: passkey.CredentialID, PublicKey: passkey.PublicKey, SignCount: passkey.SignCount}
+	count, err := app.relyingParty.VerifyAssertion(clientData, authData, signature, challenge, cred)
+	switch {
+	case errors.Is(err, webauthn.ErrSignCount):
+		// The counter going backwards means another copy of the key has
+		// been used since, so neither copy can be trusted.
+		return passkey, "passkey_cloned", nil
+	case errors.Is(err, webauthn.ErrInvalidResponse):
+		return passkey, "passkey", nil
+	case err != nil:
+		return nil, "", err
+	}
+	err = app.passkeys.UpdateSignCount(passkey.ID, count)
+	if errors.Is(err, models.ErrSignCount) {
+		// Another login with the same counter, or a higher one, was saved
+		// after the passkey was read.
+		return passkey, "passkey_cloned", nil
+	} else if err != nil {
+		return nil, "", err
+	}
+	return passkey, "", nil
+}
+
+func (app *application) passkeyLoginFailed(w http.ResponseWriter, r *http.Request, form userLoginForm, userID int, reason string, status int, message string) {
+	err := app.recordAudit(r, 0, "login.failure", models.AuditTargetUser, userID, map[string]string{"reason": reason})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	form.AddNonFieldError(message)
+	data := app.newTemplateData(r)
+	data.Form = form
+	app.render(w, status, "login.tmpl.html", data)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"snipit.bikraj.net/internal/mailer"
+	"snipit.bikraj.net/internal/models"
+	Validator "snipit.bikraj.net/internal/validator"
+)
+
+const passwordResetTTL = time.Hour
+
+type passwordForgotForm struct {
+	Email               string `form:"email"`
+	Validator.Validator `form:"-"`
+}
+
+type passwordResetForm struct {
+	NewPassword         string `form:"NewPassword"`
+	ConfirmPassword     string `form:"ConfirmPassword"`
+	Token               string `form:"-"`
+	Validator.Validator `form:"-"`
+}
+
+func (app *application) passwordForgot(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = passwordForgotForm{}
+	app.render(w, http.StatusOK, "passwordForgot.tmpl.html", data)
+}
+
+// passwordForgotPost answers the same way whether or not the address
+// belongs to an account, so it can't be used to find out who is registered.
+// Looking the account up, making the token and sending the mail all happen
+// in the background, so neither the response time nor a mail failure gives
+// the answer away.
+func (app *application) passwordForgotPost(w http.ResponseWriter, r *http.Request) {
+	var form passwordForgotForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form.CheckField(Validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(Validator.Matches(form.Email, Validator.EmailRX), "email", "This field must be a valid email address")
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "passwordForgot.tmpl.html", data)
+		return
+	}
+
+	app.background(func() error {
+		user, err := app.users.GetByEmail(form.Email)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				return nil
+			}
+			return err
+		}
+		return app.sendPasswordResetEmail(user)
+	})
+	app.sessionManager.Put(r.Context(), "flash",
+		"If an account exists for that address, we have emailed it a link to reset the password.")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+func (app *application) sendPasswordResetEmail(user *models.User) error {
+	token, err := app.passwordResets.New(user.ID, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+	return app.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Snippetbox password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your account. "+
+			"If it was you, open the link below within %d minutes. Otherwise you can ignore this email.\n\n"+
+			"%s/user/password/reset/%s\n",
+			user.Name, int(passwordResetTTL.Minutes()), app.baseURL, token),
+	})
+}
+
+func (app *application) passwordReset(w http.ResponseWriter, r *http.Request) {
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+	_, err := app.passwordResets.UserID(token)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.sessionManager.Put(r.Context(), "flash", "That reset link is invalid or has expired.")
+			http.Redirect(w, r, "/user/password/forgot", http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	data := app.newTemplateData(r)
+	data.Form = passwordResetForm{Token: token}
+	app.render(w, http.StatusOK, "passwordReset.tmpl.html", data)
+}
+
+func (app *application) passwordResetPost(w http.ResponseWriter, r *http.Request) {
+	var form passwordResetForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form.Token = httprouter.ParamsFromContext(r.Context()).ByName("token")
+	// The token is only used up once the new password is accepted, but the
+	// user is needed now for the password policy.
+	id, err := app.passwordResets.UserID(form.Token)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.sessionManager.Put(r.Context(), "flash", "That reset link is invalid or has expired.")
+			http.Redirect(w, r, "/user/password/forgot", http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	user, err := app.users.Get(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	form.CheckField(Validator.NotBlank(form.NewPassword), "NewPassword", "New Password cannot be blank")
+	form.CheckField(Validator.MinChars(form.NewPassword, 8), "NewPassword", "Password Length must be at least 8 characters")
+	form.CheckField(Validator.MaxChars(form.NewPassword, Validator.MaxPasswordChars), "NewPassword", "Password cannot be more than 128 characters long")
+	if form.FieldErrors["NewPassword"] == "" {
+		form.CheckPassword(app.passwordPolicy, "NewPassword", form.NewPassword, user.Name, user.Username, user.Email)
+	}
+	form.CheckField(Validator.Same(form.NewPassword, form.ConfirmPassword), "ConfirmPassword", "Password Must be Same")
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "passwordReset.tmpl.html", data)
+		return
+	}
+
+	id, err = app.passwordResets.Consume(form.Token)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.sessionManager.Put(r.Context(), "flash", "That reset link is invalid or has expired.")
+			http.Redirect(w, r, "/user/password/forgot", http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	err = app.users.SetPassword(id, form.NewPassword)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.userSessions.RevokeAll(id, "")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.rememberTokens.RevokeAll(id, "")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.recordAudit(r, id, "password.reset", models.AuditTargetUser, id, nil)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	// The request's own session is written back after the handler returns,
+	// so it has to be logged out here rather than through the store.
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+	app.sessionManager.Remove(r.Context(), "sessionID")
+	app.sessionManager.Put(r.Context(), "flash", "Your password has been reset. Please log in.")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"snipit.bikraj.net/internal/identicon"
+	"snipit.bikraj.net/internal/models"
+	Validator "snipit.bikraj.net/internal/validator"
+)
+
+// profilePageSize is how many snippets a profile lists per page.
+const profilePageSize = 20
+
+type profileForm struct {
+	Username            string `form:"username"`
+	Bio                 string `form:"bio"`
+	Validator.Validator `form:"-"`
+}
+
+// profileUser loads the owner of the profile in the URL. Disabled accounts
+// have no public profile.
+func (app *application) profileUser(r *http.Request) (*models.User, error) {
+	user, err := app.users.GetByUsername(httprouter.ParamsFromContext(r.Context()).ByName("username"))
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, models.ErrNoRecord
+	}
+	return user, nil
+}
+
+func (app *application) userProfile(w http.ResponseWriter, r *http.Request) {
+	user, err := app.profileUser(r)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	page := 1
+	if s := r.URL.Query().Get("page"); s != "" {
+		page, err = strconv.Atoi(s)
+		if err != nil || page < 1 {
+			app.notFound(w)
+			return
+		}
+	}
+
+	// One extra snippet tells us whether there is another page.
+	snippets, err := app.snippets.PublicForUser(user.ID, profilePageSize+1, (page-1)*profilePageSize)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.User = user
+	if len(snippets) > profilePageSize {
+		snippets = snippets[:profilePageSize]
+		data.NextPage = page + 1
+	}
+	data.Snippets = snippets
+	data.PrevPage = page - 1
+	app.render(w, http.StatusOK, "profile.tmpl.html", data)
+}
+
+func (app *application) userAvatar(w http.ResponseWriter, r *http.Request) {
+	user, err := app.profileUser(r)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	// The picture follows the account rather than the username, so it
+	// survives a rename.
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(identicon.SVG(strconv.Itoa(user.ID)))
+}
+
+func (app *application) renderAccountProfile(w http.ResponseWriter, r *http.Request, status int, form profileForm) {
+	data := app.newTemplateData(r)
+	data.Form = form
+	data.User = app.currentUser(r)
+	app.render(w, status, "accountProfile.tmpl.html", data)
+}
+
+func (app *application) accountProfile(w http.ResponseWriter, r *http.Request) {
+	user := app.currentUser(r)
+	app.renderAccountProfile(w, r, http.StatusOK, profileForm{Username: user.Username, Bio: user.Bio})
+}
+
+func (app *application) accountProfilePost(w http.ResponseWriter, r *http.Request) {
+	var form profileForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	user := app.currentUser(r)
+	form.Username = strings.ToLower(strings.TrimSpace(form.Username))
+	form.Bio = strings.TrimSpace(form.Bio)
+	// Accounts from before usernames keep their placeholder until they
+	// choose something else.
+	if form.Username != user.Username {
+		form.CheckUsername("username", form.Username)
+	}
+	form.CheckField(Validator.MaxChars(form.Bio, 500), "bio", "This field cannot be more than 500 characters long")
+	if !form.Valid() {
+		app.renderAccountProfile(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	err = app.users.SetProfile(user.ID, form.Username, form.Bio)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateUsername) {
+			form.AddField("username", "That username is already taken")
+			app.renderAccountProfile(w, r, http.StatusUnprocessableEntity, form)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Your profile has been updated.")
+	http.Redirect(w, r, "/u/"+form.Username, http.StatusSeeOther)
+}
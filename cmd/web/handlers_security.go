@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// securityLogLimit is how many of their own security events users see.
+const securityLogLimit = 100
+
+func (app *application) accountSecurity(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+	entries, err := app.audit.ForUser(userID, securityLogLimit)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	// Where staff acted on the account is none of the user's business.
+	// Failed logins are the exception: where they came from is the point.
+	for i, e := range entries {
+		if (e.ActorID != userID || e.Details["impersonator"] != "") && e.Action != "login.failure" {
+			hidden := *e
+			hidden.IP, hidden.UserAgent = "", ""
+			entries[i] = &hidden
+		}
+	}
+	data := app.newTemplateData(r)
+	data.AuditEntries = entries
+	app.render(w, http.StatusOK, "security.tmpl.html", data)
+}
+
+// pruneAuditLog removes audit entries older than the retention period, every
+// interval until the process exits. A zero retention keeps them forever.
+func (app *application) pruneAuditLog(interval time.Duration) {
+	if app.auditRetention <= 0 {
+		return
+	}
+	for {
+		n, err := app.audit.Prune(app.auditRetention)
+		if err != nil {
+			app.errorLog.Println(err)
+		} else if n > 0 {
+			app.infoLog.Printf("Pruned %d audit log entries", n)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"snipit.bikraj.net/internal/models"
+)
+
+// sessionTouchInterval limits how often authenticate writes a session's
+// last seen time, so browsing doesn't cost a write per request.
+const sessionTouchInterval = time.Minute
+
+func (app *application) userSessionList(w http.ResponseWriter, r *http.Request) {
+	sessions, err := app.userSessions.ForUser(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.UserSessions = sessions
+	data.CurrentSession = app.sessionManager.GetString(r.Context(), "sessionID")
+	app.render(w, http.StatusOK, "sessions.tmpl.html", data)
+}
+
+func (app *application) userSessionRevokePost(w http.ResponseWriter, r *http.Request) {
+	id := httprouter.ParamsFromContext(r.Context()).ByName("id")
+	if id == app.sessionManager.GetString(r.Context(), "sessionID") {
+		// Ending the current session is what logging out is for.
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	err := app.userSessions.Revoke(id, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "That session has been logged out.")
+	http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+}
+
+func (app *application) userSessionRevokeOthersPost(w http.ResponseWriter, r *http.Request) {
+	err := app.userSessions.RevokeAll(app.authenticatedUserID(r), app.sessionManager.GetString(r.Context(), "sessionID"))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.rememberTokens.RevokeAll(app.authenticatedUserID(r), rememberToken(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "All your other sessions have been logged out.")
+	http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+}
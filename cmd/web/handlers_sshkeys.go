@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/crypto/ssh"
+	"snipit.bikraj.net/internal/models"
+	Validator "snipit.bikraj.net/internal/validator"
+)
+
+// minRSABits is the smallest RSA key accepted; anything shorter is
+// considered breakable.
+const minRSABits = 2048
+
+type sshKeyForm struct {
+	Name                string `form:"name"`
+	Key                 string `form:"key"`
+	Validator.Validator `form:"-"`
+}
+
+// parseSSHKey reads a key in the authorized_keys format that ssh-keygen
+// writes to .pub files. The comment becomes the default name.
+func parseSSHKey(s string) (ssh.PublicKey, string, error) {
+	key, comment, _, rest, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(s)))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(strings.TrimSpace(string(rest))) > 0 {
+		return nil, "", errors.New("ssh: more than one key")
+	}
+	return key, comment, nil
+}
+
+// checkSSHKey adds a field error for keys that can't be parsed or are too
+// weak to trust.
+func checkSSHKey(v *Validator.Validator, key ssh.PublicKey, err error) {
+	if err != nil {
+		v.AddField("key", "Paste a single public key, like the contents of ~/.ssh/id_ed25519.pub")
+		return
+	}
+	switch key.Type() {
+	case ssh.KeyAlgoED25519, ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+		ssh.KeyAlgoSKED25519, ssh.KeyAlgoSKECDSA256:
+	case ssh.KeyAlgoRSA:
+		if ck, ok := key.(ssh.CryptoPublicKey); ok {
+			if pub, ok := ck.CryptoPublicKey().(*rsa.PublicKey); ok && pub.N.BitLen() < minRSABits {
+				v.AddField("key", "RSA keys must be at least 2048 bits")
+			}
+		}
+	default:
+		v.AddField("key", "Use an Ed25519, ECDSA or RSA key")
+	}
+}
+
+func (app *application) renderSSHKeys(w http.ResponseWriter, r *http.Request, status int, form sshKeyForm) {
+	keys, err := app.sshKeys.ForUser(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.Form = form
+	data.SSHKeys = keys
+	data.SSHHost = app.sshHost
+	app.render(w, status, "sshKeys.tmpl.html", data)
+}
+
+func (app *application) sshKeyList(w http.ResponseWriter, r *http.Request) {
+	app.renderSSHKeys(w, r, http.StatusOK, sshKeyForm{})
+}
+
+func (app *application) sshKeyCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form sshKeyForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	key, comment, err := parseSSHKey(form.Key)
+	checkSSHKey(&form.Validator, key, err)
+	form.Name = strings.TrimSpace(form.Name)
+	if form.Name == "" {
+		form.Name = comment
+	}
+	form.CheckField(Validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(Validator.MaxChars(form.Name, 100), "name", "This field cannot be more than 100 characters long")
+	if !form.Valid() {
+		app.renderSSHKeys(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+	fingerprint := ssh.FingerprintSHA256(key)
+	publicKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	_, err = app.sshKeys.Insert(userID, form.Name, fingerprint, publicKey)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateKey) {
+			form.AddField("key", "This key has already been added to an account")
+			app.renderSSHKeys(w, r, http.StatusUnprocessableEntity, form)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	err = app.recordAudit(r, userID, "sshkey.add", models.AuditTargetUser, userID, map[string]string{
+		"name":        form.Name,
+		"fingerprint": fingerprint,
+	})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Your SSH key has been added.")
+	http.Redirect(w, r, "/account/keys", http.StatusSeeOther)
+}
+
+func (app *application) sshKeyDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+	userID := app.authenticatedUserID(r)
+	err = app.sshKeys.Delete(id, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	err = app.recordAudit(r, userID, "sshkey.delete", models.AuditTargetUser, userID, map[string]string{"id": strconv.Itoa(id)})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Your SSH key has been removed.")
+	http.Redirect(w, r, "/account/keys", http.StatusSeeOther)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"snipit.bikraj.net/internal/models"
+	Validator "snipit.bikraj.net/internal/validator"
+)
+
+type snippetTemplateForm struct {
+	Name                string `form:"name"`
+	TitlePattern        string `form:"title_pattern"`
+	Language            string `form:"language"`
+	Content             string `form:"content"`
+	Visibility          string `form:"visibility"`
+	Expires             int    `form:"expires"`
+	SiteWide            bool   `form:"-"`
+	Validator.Validator `form:"-"`
+}
+
+// checkSnippetDefaults validates the fields shared by snippets and the
+// templates they can be created from.
+func checkSnippetDefaults(v *Validator.Validator, language, visibility string, expires int) {
+	v.CheckField(
+		Validator.MaxChars(language, 30),
+		"language",
+		"This field cannot be more than 30 characters long",
+	)
+	v.CheckField(
+		Validator.PermittedValue(visibility, models.VisibilityPublic, models.VisibilityUnlisted, models.VisibilityPrivate, models.VisibilityOrganization),
+		"visibility",
+		"This field must equal public, unlisted, private or organization",
+	)
+	v.CheckField(
+		Validator.PermittedValue(expires, 1, 7, 365),
+		"expires",
+		"This field must equal 1, 7 or 365",
+	)
+}
+
+// snippetTemplateForUser looks up a template by its raw ID and hides
+// templates that belong to somebody else behind ErrNoRecord.
+func (app *application) snippetTemplateForUser(rawID string, userID int) (*models.SnippetTemplate, error) {
+	id, err := strconv.Atoi(rawID)
+	if err != nil || id < 1 {
+		return nil, models.ErrNoRecord
+	}
+	tmpl, err := app.snippetTemplates.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !tmpl.SiteWide() && tmpl.UserID != userID {
+		return nil, models.ErrNoRecord
+	}
+	return tmpl, nil
+}
+
+func (app *application) snippetTemplateList(w http.ResponseWriter, r *http.Request) {
+	templates, err := app.snippetTemplates.ForUser(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.User = app.currentUser(r)
+	data.SnippetTemplates = templates
+	app.render(w, http.StatusOK, "templates.tmpl.html", data)
+}
+
+func (app *application) snippetTemplateCreate(w http.ResponseWriter, r *http.Request) {
+	form := snippetTemplateForm{
+		Expires:    365,
+		Visibility: models.VisibilityPublic,
+	}
+	// Saving an existing snippet as a template prefills the form from it.
+	if raw := r.URL.Query().Get("snippet"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil || id < 1 {
+			app.notFound(w)
+			return
+		}
+		snippet, err := app.snippets.Get(id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.notFound(w)
+			} else {
+				app.serverError(w, err)
+			}
+			return
+		}
+		if ok, err := app.canView(r, snippet); err != nil {
+			app.serverError(w, err)
+			return
+		} else if !ok {
+			app.notFound(w)
+			return
+		}
+		form = snippetTemplateForm{
+			Name:         snippet.Title,
+			TitlePattern: snippet.Title,
+			Language:     snippet.Language,
+			Content:      snippet.Content,
+			Visibility:   snippet.Visibility,
+			Expires:      365,
+		}
+	}
+	data := app.newTemplateData(r)
+	data.Form = form
+	app.render(w, http.StatusOK, "templateCreate.tmpl.html", data)
+}
+
+func (app *application) snippetTemplateCreatePost(w http.ResponseWriter, r *http.Request) {
+	app.saveSnippetTemplate(w, r, snippetTemplateForm{})
+}
+
+// saveSnippetTemplate validates a posted template and stores it, as a
+// site-wide template when the form says so.
+func (app *application) saveSnippetTemplate(w http.ResponseWriter, r *http.Request, form snippetTemplateForm) {
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form.CheckField(Validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(Validator.MaxChars(form.Name, 100), "name", "This field cannot be more than 100 characters long")
+	form.CheckField(
+		Validator.MaxChars(form.TitlePattern, 100),
+		"title_pattern",
+		"This field cannot be more than 100 characters long",
+	)
+	app.checkContentSize(&form.Validator, r, form.Content)
+	checkSnippetDefaults(&form.Validator, form.Language, form.Visibility, form.Expires)
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "templateCreate.tmpl.html", data)
+		return
+	}
+	userID := app.authenticatedUserID(r)
+	ownerID := userID
+	if form.SiteWide {
+		ownerID = 0
+	}
+	id, err := app.snippetTemplates.Insert(ownerID, form.Name, form.TitlePattern,
+		form.Language, form.Content, form.Visibility, form.Expires)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if form.SiteWide {
+		err = app.recordAudit(r, userID, "template.create", models.AuditTargetTemplate, id,
+			map[string]string{"name": form.Name})
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Template saved.")
+	http.Redirect(w, r, "/snippet/templates", http.StatusSeeOther)
+}
+
+func (app *application) snippetTemplateDeletePost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+	err = app.snippetTemplates.Delete(id, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Template deleted.")
+	http.Redirect(w, r, "/snippet/templates", http.StatusSeeOther)
+}
+
+// Site-wide templates are offered to every user, so only admins create and
+// delete them, and both are logged.
+
+func (app *application) adminTemplateCreate(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = snippetTemplateForm{
+		Expires:    365,
+		Visibility: models.VisibilityPublic,
+		SiteWide:   true,
+	}
+	app.render(w, http.StatusOK, "templateCreate.tmpl.html", data)
+}
+
+func (app *application) adminTemplateCreatePost(w http.ResponseWriter, r *http.Request) {
+	app.saveSnippetTemplate(w, r, snippetTemplateForm{SiteWide: true})
+}
+
+func (app *application) adminTemplateDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+	err = app.snippetTemplates.Delete(id, 0)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	err = app.recordAudit(r, app.authenticatedUserID(r), "template.delete", models.AuditTargetTemplate, id, nil)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Site-wide template deleted.")
+	http.Redirect(w, r, "/snippet/templates", http.StatusSeeOther)
+}
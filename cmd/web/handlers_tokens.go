@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"snipit.bikraj.net/internal/models"
+	Validator "snipit.bikraj.net/internal/validator"
+)
+
+type apiTokenForm struct {
+	Name                string   `form:"name"`
+	Scopes              []string `form:"scopes"`
+	Expires             int      `form:"expires"`
+	Validator.Validator `form:"-"`
+}
+
+// HasScope tells the template which scope boxes to tick.
+func (f apiTokenForm) HasScope(scope string) bool {
+	for _, s := range f.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (app *application) renderAPITokens(w http.ResponseWriter, r *http.Request, status int, form apiTokenForm, newToken string) {
+	tokens, err := app.apiTokens.ForUser(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.Form = form
+	data.APITokens = tokens
+	data.NewAPIToken = newToken
+	app.render(w, status, "tokens.tmpl.html", data)
+}
+
+func (app *application) apiTokenList(w http.ResponseWriter, r *http.Request) {
+	app.renderAPITokens(w, r, http.StatusOK, apiTokenForm{
+		Scopes:  []string{models.ScopeRead},
+		Expires: 30,
+	}, "")
+}
+
+func (app *application) apiTokenCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form apiTokenForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form.CheckField(Validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(Validator.MaxChars(form.Name, 100), "name", "This field cannot be more than 100 characters long")
+	form.CheckField(len(form.Scopes) > 0, "scopes", "Choose at least one scope")
+	for _, scope := range form.Scopes {
+		form.CheckField(
+			Validator.PermittedValue(scope, models.ScopeRead, models.ScopeWrite, models.ScopeDelete),
+			"scopes",
+			"Scopes must be read, write or delete",
+		)
+	}
+	form.CheckField(Validator.PermittedValue(form.Expires, 7, 30, 90, 365), "expires", "This field must equal 7, 30, 90 or 365")
+	if !form.Valid() {
+		app.renderAPITokens(w, r, http.StatusUnprocessableEntity, form, "")
+		return
+	}
+
+	expires := time.Now().AddDate(0, 0, form.Expires)
+	userID := app.authenticatedUserID(r)
+	token, err := app.apiTokens.Insert(userID, form.Name, form.Scopes, expires)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.recordAudit(r, userID, "token.create", models.AuditTargetUser, userID, map[string]string{
+		"name":    form.Name,
+		"scopes":  strings.Join(form.Scopes, ","),
+		"expires": expires.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	// The plain token is only ever shown on this response.
+	app.renderAPITokens(w, r, http.StatusOK, apiTokenForm{
+		Scopes:  []string{models.ScopeRead},
+		Expires: 30,
+	}, token)
+}
+
+func (app *application) apiTokenRevokePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+	userID := app.authenticatedUserID(r)
+	err = app.apiTokens.Revoke(id, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	err = app.recordAudit(r, userID, "token.revoke", models.AuditTargetUser, userID, map[string]string{"id": strconv.Itoa(id)})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Token revoked.")
+	http.Redirect(w, r, "/account/tokens", http.StatusSeeOther)
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"rsc.io/qr"
+	"snipit.bikraj.net/internal/models"
+	"snipit.bikraj.net/internal/totp"
+	Validator "snipit.bikraj.net/internal/validator"
+)
+
+const (
+	// twoFactorPendingTTL is how long a user has to enter their code after
+	// the password step before they have to start again.
+	twoFactorPendingTTL = 5 * time.Minute
+	// twoFactorMaxAttempts bounds code guesses per password login.
+	twoFactorMaxAttempts = 5
+	recoveryCodeCount    = 10
+	totpIssuer           = "Snippetbox"
+)
+
+type twoFactorForm struct {
+	Code                string `form:"code"`
+	Validator.Validator `form:"-"`
+}
+
+// beginTwoFactor records that the password was right but the second factor
+// is still outstanding. No authenticatedUserID is set, so until
+// twoFactorLoginPost succeeds every protected route treats the session as
+// anonymous.
+func (app *application) beginTwoFactor(w http.ResponseWriter, r *http.Request, id int) {
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "twoFactorPendingUserID", id)
+	app.sessionManager.Put(r.Context(), "twoFactorPendingSince", time.Now().Unix())
+	app.sessionManager.Put(r.Context(), "twoFactorAttempts", 0)
+	http.Redirect(w, r, "/user/login/2fa", http.StatusSeeOther)
+}
+
+// twoFactorPendingUserID returns the user waiting on their second factor, or
+// 0 if there is none or they took too long.
+func (app *application) twoFactorPendingUserID(r *http.Request) int {
+	id := app.sessionManager.GetInt(r.Context(), "twoFactorPendingUserID")
+	since := time.Unix(app.sessionManager.GetInt64(r.Context(), "twoFactorPendingSince"), 0)
+	if id == 0 || time.Since(since) > twoFactorPendingTTL {
+		return 0
+	}
+	return id
+}
+
+func (app *application) clearTwoFactorPending(r *http.Request) {
+	app.sessionManager.Remove(r.Context(), "twoFactorPendingUserID")
+	app.sessionManager.Remove(r.Context(), "twoFactorPendingSince")
+	app.sessionManager.Remove(r.Context(), "twoFactorAttempts")
+}
+
+// checkSecondFactor accepts either a current TOTP code or one of the user's
+// unused recovery codes.
+func (app *application) checkSecondFactor(userID int, code string) (bool, error) {
+	secret, err := app.twoFactor.Secret(userID)
+	if err != nil {
+		return false, err
+	}
+	if secret == "" {
+		return false, nil
+	}
+	if step, ok := totp.Validate(secret, code, time.Now()); ok {
+		return app.twoFactor.RecordStep(userID, step)
+	}
+	err = app.twoFactor.UseRecoveryCode(userID, code)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (app *application) twoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	if app.twoFactorPendingUserID(r) == 0 {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.Form = twoFactorForm{}
+	app.render(w, http.StatusOK, "twoFactorLogin.tmpl.html", data)
+}
+
+func (app *application) twoFactorLoginPost(w http.ResponseWriter, r *http.Request) {
+	id := app.twoFactorPendingUserID(r)
+	if id == 0 {
+		app.clearTwoFactorPending(r)
+		app.sessionManager.Put(r.Context(), "flash", "Your login timed out. Please log in again.")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+	var form twoFactorForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form.CheckField(Validator.NotBlank(form.Code), "code", "This field cannot be blank")
+	if form.Valid() {
+		ok, err := app.checkSecondFactor(id, form.Code)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		if ok {
+			app.clearTwoFactorPending(r)
+			app.completeLogin(w, r, id)
+			return
+		}
+		// Wrong codes count against the account like wrong passwords, so
+		// logging in again doesn't buy an unlimited supply of guesses.
+		user, err := app.users.Get(id)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		_, err = app.loginAccountGuard.Fail(strings.ToLower(user.Email))
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		err = app.recordAudit(r, 0, "login.failure", models.AuditTargetUser, id, map[string]string{
+			"email":  user.Email,
+			"reason": "two_factor",
+		})
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		attempts := app.sessionManager.GetInt(r.Context(), "twoFactorAttempts") + 1
+		if attempts >= twoFactorMaxAttempts {
+			app.clearTwoFactorPending(r)
+			app.sessionManager.Put(r.Context(), "flash", "Too many incorrect codes. Please log in again.")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		}
+		app.sessionManager.Put(r.Context(), "twoFactorAttempts", attempts)
+		form.AddNonFieldError("That code is not valid")
+	}
+	data := app.newTemplateData(r)
+	data.Form = form
+	app.render(w, http.StatusUnprocessableEntity, "twoFactorLogin.tmpl.html", data)
+}
+
+// twoFactorSettings shows the enrolment page, or the disable form once 2FA
+// is on. The secret being enrolled lives in the session until it has been
+// confirmed with a valid code.
+func (app *application) twoFactorSettings(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+	secret, err := app.twoFactor.Secret(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.Form = twoFactorForm{}
+	data.TwoFactorEnabled = secret != ""
+	if !data.TwoFactorEnabled {
+		pending := app.sessionManager.GetString(r.Context(), "totpEnrolSecret")
+		if pending == "" {
+			pending, err = totp.GenerateSecret()
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+			app.sessionManager.Put(r.Context(), "totpEnrolSecret", pending)
+		}
+		data.TOTPSecret = pending
+	}
+	app.render(w, http.StatusOK, "twoFactor.tmpl.html", data)
+}
+
+// twoFactorQRCode renders the otpauth:// URI for the pending secret as a PNG.
+// It is served from our own origin because the CSP forbids data: images.
+func (app *application) twoFactorQRCode(w http.ResponseWriter, r *http.Request) {
+	pending := app.sessionManager.GetString(r.Context(), "totpEnrolSecret")
+	if pending == "" {
+		app.notFound(w)
+		return
+	}
+	user, err := app.users.Get(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	code, err := qr.Encode(totp.URL(totpIssuer, user.Email, pending), qr.M)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	code.Scale = 5
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(code.PNG())
+}
+
+func (app *application) twoFactorEnablePost(w http.ResponseWriter, r *http.Request) {
+	pending := app.sessionManager.GetString(r.Context(), "totpEnrolSecret")
+	if pending == "" {
+		http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+		return
+	}
+	var form twoFactorForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	step, ok := totp.Validate(pending, form.Code, time.Now())
+	form.CheckField(ok, "code", "That code is not valid; check your device's clock and try again")
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		data.TOTPSecret = pending
+		app.render(w, http.StatusUnprocessableEntity, "twoFactor.tmpl.html", data)
+		return
+	}
+
+	codes, err := generateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	userID := app.authenticatedUserID(r)
+	err = app.twoFactor.Enable(userID, pending, codes)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	_, err = app.twoFactor.RecordStep(userID, step)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Remove(r.Context(), "totpEnrolSecret")
+	err = app.recordAudit(r, userID, "2fa.enable", models.AuditTargetUser, userID, nil)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Recovery codes are only ever shown on this response.
+	data := app.newTemplateData(r)
+	data.Form = twoFactorForm{}
+	data.TwoFactorEnabled = true
+	data.RecoveryCodes = codes
+	app.render(w, http.StatusOK, "twoFactor.tmpl.html", data)
+}
+
+func (app *application) twoFactorDisablePost(w http.ResponseWriter, r *http.Request) {
+	var form twoFactorForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	userID := app.authenticatedUserID(r)
+	ok, err := app.checkSecondFactor(userID, form.Code)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	form.CheckField(ok, "code", "That code is not valid")
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		data.TwoFactorEnabled = true
+		app.render(w, http.StatusUnprocessableEntity, "twoFactor.tmpl.html", data)
+		return
+	}
+	err = app.twoFactor.Disable(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.recordAudit(r, userID, "2fa.disable", models.AuditTargetUser, userID, nil)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Two-factor authentication has been turned off.")
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+// recoveryCodeBytes is the entropy in each recovery code. The codes are
+// stored as plain SHA-256 hashes, so there must be far too many of them to
+// try every one against a copy of the database.
+const recoveryCodeBytes = 10
+
+// generateRecoveryCodes returns n random codes formatted as
+// xxxx-xxxx-xxxx-xxxx in lower-case base32.
+func generateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+		groups := make([]string, 0, len(code)/4)
+		for len(code) > 0 {
+			groups = append(groups, code[:4])
+			code = code[4:]
+		}
+		codes[i] = strings.Join(groups, "-")
+	}
+	return codes, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"snipit.bikraj.net/internal/mailer"
+	"snipit.bikraj.net/internal/models"
+)
+
+const (
+	verifyEmailPurpose = "verify-email"
+	verifyEmailTTL     = 48 * time.Hour
+)
+
+// sendVerificationEmail mails a signed link that confirms email belongs to
+// the user. The address is part of the token so the link stops working if
+// the account's email changes in the meantime.
+func (app *application) sendVerificationEmail(id int, name, email string) error {
+	payload := fmt.Sprintf("%d|%s", id, email)
+	token := app.signer.Sign(verifyEmailPurpose, payload, time.Now().Add(verifyEmailTTL))
+	return app.mailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Confirm your Snippetbox account",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below. "+
+			"It is valid for %d hours.\n\n%s/user/verify/%s\n",
+			name, int(verifyEmailTTL.Hours()), app.baseURL, token),
+	})
+}
+
+func (app *application) userVerify(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	payload, err := app.signer.Verify(verifyEmailPurpose, params.ByName("token"), time.Now())
+	if err != nil {
+		app.sessionManager.Put(r.Context(), "flash", "That verification link is invalid or has expired.")
+		http.Redirect(w, r, "/user/verify", http.StatusSeeOther)
+		return
+	}
+	rawID, email, _ := strings.Cut(payload, "|")
+	id, err := strconv.Atoi(rawID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	user, err := app.users.Get(id)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+	if err != nil || user.Email != email {
+		app.sessionManager.Put(r.Context(), "flash", "That verification link is invalid or has expired.")
+		http.Redirect(w, r, "/user/verify", http.StatusSeeOther)
+		return
+	}
+	err = app.users.SetVerified(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Thanks, your email address has been verified.")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// userVerifyStatus tells a logged in user whether they still need to verify.
+func (app *application) userVerifyStatus(w http.ResponseWriter, r *http.Request) {
+	user, err := app.users.Get(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.User = user
+	app.render(w, http.StatusOK, "verify.tmpl.html", data)
+}
+
+func (app *application) userVerifyResendPost(w http.ResponseWriter, r *http.Request) {
+	user, err := app.users.Get(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if !user.Verified {
+		err = app.sendVerificationEmail(user.ID, user.Name, user.Email)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		app.sessionManager.Put(r.Context(), "flash", "We have sent you a new verification link.")
+	}
+	http.Redirect(w, r, "/user/verify", http.StatusSeeOther)
+}
@@ -4,12 +4,17 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"runtime/debug"
+	"strconv"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-playground/form/v4"
 	"github.com/justinas/nosurf"
+	"snipit.bikraj.net/internal/models"
+	Validator "snipit.bikraj.net/internal/validator"
 )
 
 func (app *application) serverError(w http.ResponseWriter, err error) {
@@ -58,11 +63,19 @@ func (app *application) render(w http.ResponseWriter, status int, page string, d
 }
 
 func (app *application) newTemplateData(r *http.Request) *templateData {
+	// Shown in the banner on every page while an admin is impersonating.
+	var impersonating *models.User
+	if app.impersonator(r) != nil {
+		impersonating = app.currentUser(r)
+	}
 	return &templateData{
 		CurrentYear: time.Now().Year(),
     Flash: app.sessionManager.PopString(r.Context(),"flash"),
     IsAuthenticated: app.isAuthenticated(r),
     CSRFToken: nosurf.Token(r),
+    LoginProviders: app.oidcProviders,
+    Impersonator: app.impersonator(r),
+    Impersonating: impersonating,
 	}
 }
 
@@ -92,3 +105,175 @@ func (app * application) isAuthenticated(r *http.Request) bool {
   }
   return isAuthenticated
 }
+
+// authenticatedUserID returns the ID of the logged in user, or of the API
+// token's owner, or 0 when the request is anonymous.
+func (app *application) authenticatedUserID(r *http.Request) int {
+	if token := app.apiToken(r); token != nil {
+		return token.UserID
+	}
+	return app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+}
+
+// currentUser returns the logged in user as loaded by authenticate, or nil.
+func (app *application) currentUser(r *http.Request) *models.User {
+	user, _ := r.Context().Value(currentUserContextKey).(*models.User)
+	return user
+}
+
+// impersonator returns the admin impersonating the current user, or nil.
+func (app *application) impersonator(r *http.Request) *models.User {
+	user, _ := r.Context().Value(impersonatorContextKey).(*models.User)
+	return user
+}
+
+// apiToken returns the bearer token the request was authenticated with.
+func (app *application) apiToken(r *http.Request) *models.APIToken {
+	token, _ := r.Context().Value(apiTokenContextKey).(*models.APIToken)
+	return token
+}
+
+// maxFormBytes is the request body cap applied by limitFormSize. It leaves
+// room for URL encoding to triple the content plus the form's other fields;
+// the exact content size is checked after decoding.
+func (app *application) maxFormBytes() int64 {
+	return int64(app.maxContentBytes)*3 + 16*1024
+}
+
+// formTooLarge reports whether limitFormSize had to cut the request body.
+func (app *application) formTooLarge(r *http.Request) bool {
+	tooLarge, ok := r.Context().Value(formTooLargeContextKey).(bool)
+	return ok && tooLarge
+}
+
+// checkContentSize records a field error when content is over the
+// configured limit, including when it was dropped by limitFormSize.
+func (app *application) checkContentSize(v *Validator.Validator, r *http.Request, content string) {
+	v.CheckField(
+		!app.formTooLarge(r) && Validator.MaxBytes(content, app.maxContentBytes),
+		"content",
+		fmt.Sprintf("This field cannot be more than %d KB", app.maxContentBytes/1024),
+	)
+}
+
+// truncateContent shortens content to at most maxBytes bytes and maxLines
+// lines, cutting on a line or rune boundary, and reports whether it did.
+func truncateContent(content string, maxBytes, maxLines int) (string, bool) {
+	cut := len(content)
+	if cut > maxBytes {
+		cut = maxBytes
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+	}
+	if i := indexNth(content[:cut], '\n', maxLines); i >= 0 {
+		cut = i + 1
+	}
+	if cut == len(content) {
+		return content, false
+	}
+	return content[:cut], true
+}
+
+// indexNth returns the index of the nth occurrence of c in s, or -1.
+func indexNth(s string, c byte, n int) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == c {
+			n--
+			if n == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// canView reports whether the current user may see snippet. Staff can see
+// everything, private snippets are for their owner and organization
+// snippets for the organization's members.
+func (app *application) canView(r *http.Request, snippet *models.Snippet) (bool, error) {
+	if user := app.currentUser(r); user != nil && user.HasRole(models.RoleModerator) {
+		return true, nil
+	}
+	userID := app.authenticatedUserID(r)
+	switch snippet.Visibility {
+	case models.VisibilityPrivate:
+		return userID != 0 && snippet.UserID == userID, nil
+	case models.VisibilityOrganization:
+		if userID == 0 {
+			return false, nil
+		}
+		_, err := app.orgs.Role(snippet.OrgID, userID)
+		if errors.Is(err, models.ErrNoRecord) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	return true, nil
+}
+
+// clientIP returns the address of the peer that sent the request. Proxy
+// headers are deliberately ignored since anyone can set them.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// recordAudit adds an event to the security log, noting where the request
+// came from and, for what a user seems to do while being impersonated,
+// which admin really did it.
+func (app *application) recordAudit(r *http.Request, actorID int, action, targetType string, targetID int, details map[string]string) error {
+	if impersonator := app.impersonator(r); impersonator != nil && actorID != impersonator.ID {
+		withImpersonator := map[string]string{"impersonator": strconv.Itoa(impersonator.ID)}
+		for k, v := range details {
+			withImpersonator[k] = v
+		}
+		details = withImpersonator
+	}
+	return app.audit.Record(&models.AuditEntry{
+		ActorID:    actorID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Details:    details,
+		IP:         clientIP(r),
+		UserAgent:  r.UserAgent(),
+	})
+}
+
+// recordLoginFailure logs a failed login for email against the account it
+// belongs to, if any, so the owner sees it among their security events.
+func (app *application) recordLoginFailure(r *http.Request, email, reason string) error {
+	targetID := 0
+	user, err := app.users.GetByEmail(email)
+	if err == nil {
+		targetID = user.ID
+	} else if !errors.Is(err, models.ErrNoRecord) {
+		return err
+	}
+	return app.recordAudit(r, 0, "login.failure", models.AuditTargetUser, targetID, map[string]string{
+		"email":  email,
+		"reason": reason,
+	})
+}
+
+// background runs fn after the response has been sent, for slow work whose
+// outcome the client mustn't be able to see, such as sending mail. Errors
+// and panics are logged; wg lets tests wait for it to finish.
+func (app *application) background(fn func() error) {
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		defer func() {
+			if err := recover(); err != nil {
+				app.errorLog.Output(2, fmt.Sprintf("%s\n%s", err, debug.Stack()))
+			}
+		}()
+		if err := fn(); err != nil {
+			app.errorLog.Output(2, err.Error())
+		}
+	}()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"snipit.bikraj.net/internal/assert"
+)
+
+func TestTruncateContent(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		maxBytes      int
+		maxLines      int
+		want          string
+		wantTruncated bool
+	}{
+		{
+			name:     "Short",
+			content:  "one\ntwo\n",
+			maxBytes: 100,
+			maxLines: 10,
+			want:     "one\ntwo\n",
+		},
+		{
+			name:          "Too many lines",
+			content:       "one\ntwo\nthree\n",
+			maxBytes:      100,
+			maxLines:      2,
+			want:          "one\ntwo\n",
+			wantTruncated: true,
+		},
+		{
+			name:          "Too many bytes",
+			content:       strings.Repeat("a", 10),
+			maxBytes:      4,
+			maxLines:      10,
+			want:          "aaaa",
+			wantTruncated: true,
+		},
+		{
+			name:          "Multi-byte rune on the boundary",
+			content:       "abcédef",
+			maxBytes:      4,
+			maxLines:      10,
+			want:          "abc",
+			wantTruncated: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, truncated := truncateContent(tt.content, tt.maxBytes, tt.maxLines)
+			assert.Equal(t, got, tt.want)
+			assert.Equal(t, truncated, tt.wantTruncated)
+		})
+	}
+}
@@ -1,21 +1,33 @@
 package main
 
 import (
+	"crypto/rand"
 	"crypto/tls"
 	"database/sql"
 	"flag"
 	"html/template"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/alexedwards/scs/mysqlstore"
 "github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
   _ "github.com/go-sql-driver/mysql"
+	"golang.org/x/crypto/ssh"
+	"snipit.bikraj.net/internal/mailer"
 	"snipit.bikraj.net/internal/models"
+	"snipit.bikraj.net/internal/oidc"
+	"snipit.bikraj.net/internal/passhash"
+	"snipit.bikraj.net/internal/signer"
+	"snipit.bikraj.net/internal/throttle"
+	Validator "snipit.bikraj.net/internal/validator"
+	"snipit.bikraj.net/internal/webauthn"
 )
 
 type application struct {
@@ -23,15 +35,62 @@ type application struct {
 	infoLog       *log.Logger
 	snippets       models.SnippetModelInterface 
   users          models.UserModelInterface
+  snippetTemplates models.SnippetTemplateModelInterface
+  passwordResets models.PasswordResetModelInterface
+  twoFactor      models.TwoFactorModelInterface
+  userSessions   models.UserSessionModelInterface
+  apiTokens      models.APITokenModelInterface
+  identities     models.IdentityModelInterface
+  audit          models.AuditModelInterface
+  orgs           models.OrganizationModelInterface
+  rememberTokens models.RememberTokenModelInterface
+  invites        models.InviteModelInterface
+  sshKeys        models.SSHKeyModelInterface
+  passkeys       models.PasskeyModelInterface
 	templateCache map[string]*template.Template
 	formDecoder   *form.Decoder
   sessionManager *scs.SessionManager
   debug  bool
+  maxContentBytes int
+  mailer         mailer.Mailer
+  signer         *signer.Signer
+  baseURL        string
+  loginAccountGuard *throttle.Guard
+  loginIPGuard   *throttle.Guard
+  oidcProviders  []*oidc.Provider
+  deletionGrace  time.Duration
+  passwordPolicy *Validator.PasswordPolicy
+  rememberTTL    time.Duration
+  auditRetention time.Duration
+  signup         signupPolicy
+  sshHost        string
+  relyingParty   *webauthn.RelyingParty
+  wg             sync.WaitGroup
 }
 
 func main() {
 	addr := flag.String("addr", ":4000", "Http Network Address")
   debug := flag.Bool("debug", false,  "Run the applicaiton in Debug Mode")
+  maxContentBytes := flag.Int("max-content-bytes", 512*1024, "Maximum size of a snippet's content in bytes")
+  baseURL := flag.String("base-url", "https://localhost:4000", "Public URL used in links sent by email")
+  secret := flag.String("secret", "", "Key used to sign links sent by email")
+  smtpAddr := flag.String("smtp-addr", "", "SMTP server host:port; when empty mail is written to -outbox-dir")
+  smtpUsername := flag.String("smtp-username", "", "SMTP username")
+  smtpPassword := flag.String("smtp-password", "", "SMTP password")
+  smtpFrom := flag.String("smtp-from", "Snippetbox <no-reply@snipit.bikraj.net>", "Sender address for outgoing mail")
+  throttleStore := flag.String("throttle-store", "memory", "Where failed login counters are kept: memory (single instance) or mysql (shared by replicas)")
+  oidcConfig := flag.String("oidc-config", "", "JSON file listing OpenID Connect providers users can log in with")
+  deletionGrace := flag.Duration("deletion-grace", 30*24*time.Hour, "How long deleted accounts are kept before they are purged")
+  passwordBlocklist := flag.String("password-blocklist", "", "Gzip-compressed list of common passwords to reject, one per line; the built-in list is used when empty")
+  passwordHash := flag.String("password-hash", passhash.Argon2id, "Algorithm for new password hashes: argon2id or bcrypt; older hashes are upgraded at login")
+  bcryptCost := flag.Int("bcrypt-cost", 12, "bcrypt cost used when -password-hash is bcrypt")
+  rememberFor := flag.Duration("remember-for", 30*24*time.Hour, "How long \"remember me\" keeps a browser logged in without being used")
+  auditRetention := flag.Duration("audit-retention", 365*24*time.Hour, "How long security audit log entries are kept; 0 keeps them forever")
+  signupMode := flag.String("signup-mode", signupOpen, "Who can create accounts: open (anyone), invite (with an invite code) or domain (addresses at -signup-domains)")
+  signupDomains := flag.String("signup-domains", "", "Comma-separated email domains allowed to sign up when -signup-mode is domain")
+  sshAddr := flag.String("ssh-addr", "", "Address for the SSH paste server, such as :2222; the server is off when empty")
+  sshHostKey := flag.String("ssh-host-key", "./tls/ssh_host_ed25519_key", "Private key the SSH paste server identifies itself with; created if missing")
+  outboxDir := flag.String("outbox-dir", "./tmp/outbox", "Directory outgoing mail is written to when no SMTP server is set")
 
 	dsn := flag.String(
 		"dsn",
@@ -54,6 +113,75 @@ func main() {
   panic(err)
   }
 
+	signingKey := []byte(*secret)
+	if len(signingKey) == 0 {
+		signingKey = make([]byte, 32)
+		if _, err := rand.Read(signingKey); err != nil {
+			errorLog.Fatal(err)
+		}
+		infoLog.Println("No -secret set; emailed links will stop working when the server restarts")
+	}
+	var mail mailer.Mailer = &mailer.Outbox{Dir: *outboxDir}
+	if *smtpAddr != "" {
+		mail = &mailer.SMTP{
+			Addr:     *smtpAddr,
+			Username: *smtpUsername,
+			Password: *smtpPassword,
+			From:     *smtpFrom,
+		}
+	}
+
+	var attempts throttle.Store
+	switch *throttleStore {
+	case "memory":
+		attempts = &throttle.MemoryStore{TTL: 24 * time.Hour}
+	case "mysql":
+		attempts = &throttle.MySQLStore{DB: db}
+	default:
+		errorLog.Fatalf("unknown -throttle-store %q", *throttleStore)
+	}
+	accountGuard, ipGuard := newLoginGuards(attempts)
+
+	var providers []*oidc.Provider
+	if *oidcConfig != "" {
+		configs, err := oidc.LoadConfig(*oidcConfig)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		for _, c := range configs {
+			redirectURL := strings.TrimSuffix(*baseURL, "/") + "/user/login/oidc/" + c.Name + "/callback"
+			providers = append(providers, oidc.NewProvider(c, redirectURL))
+		}
+	}
+
+	hasher, err := passhash.New(*passwordHash, *bcryptCost)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	passwordPolicy := Validator.DefaultPasswordPolicy()
+	if *passwordBlocklist != "" {
+		f, err := os.Open(*passwordBlocklist)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		passwordPolicy, err = Validator.LoadPasswordPolicy(f, Validator.DefaultMinEntropy)
+		f.Close()
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+	}
+
+	signup, err := newSignupPolicy(*signupMode, *signupDomains)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	relyingParty, err := webauthn.NewRelyingParty("Snippetbox", *baseURL)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
 	formDecoder := form.NewDecoder()
   sessionManager:=scs.New()
   sessionManager.Store = mysqlstore.New(db)
@@ -63,11 +191,54 @@ func main() {
 		errorLog:      errorLog,
 		infoLog:       infoLog,
 		snippets:      &models.SnippetModel{DB: db},
-    users:       &models.UserModel{Db: db}, 
+    users:       &models.UserModel{Db: db, Hasher: hasher},
+    snippetTemplates: &models.SnippetTemplateModel{DB: db},
+    passwordResets: &models.PasswordResetModel{DB: db},
+    twoFactor:      &models.TwoFactorModel{DB: db},
+    userSessions:   &models.UserSessionModel{DB: db},
+    apiTokens:      &models.APITokenModel{DB: db},
+    identities:     &models.IdentityModel{DB: db},
+    audit:          &models.AuditModel{DB: db},
+    orgs:           &models.OrganizationModel{DB: db},
+    rememberTokens: &models.RememberTokenModel{DB: db},
+    invites:        &models.InviteModel{DB: db},
+    sshKeys:        &models.SSHKeyModel{DB: db},
+    passkeys:       &models.PasskeyModel{DB: db},
 		templateCache: templateCache,
 		formDecoder:   formDecoder,
     sessionManager: sessionManager,
     debug : *debug,
+    maxContentBytes: *maxContentBytes,
+    mailer:         mail,
+    signer:         signer.New(signingKey),
+    baseURL:        strings.TrimSuffix(*baseURL, "/"),
+    loginAccountGuard: accountGuard,
+    loginIPGuard:   ipGuard,
+    oidcProviders:  providers,
+    deletionGrace:  *deletionGrace,
+    passwordPolicy: passwordPolicy,
+    rememberTTL:    *rememberFor,
+    auditRetention: *auditRetention,
+    signup:         signup,
+    relyingParty:   relyingParty,
+	}
+	go app.purgeDeletedAccounts(purgeInterval)
+	go app.pruneAuditLog(purgeInterval)
+
+	if *sshAddr != "" {
+		hostKey, err := loadSSHHostKey(*sshHostKey)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		l, err := net.Listen("tcp", *sshAddr)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		app.sshHost = sshCommand(*baseURL, l.Addr())
+		infoLog.Printf("Starting SSH paste server on %s with host key %s", *sshAddr, ssh.FingerprintSHA256(hostKey.PublicKey()))
+		go func() {
+			errorLog.Fatal(app.serveSSH(l, app.sshServerConfig(hostKey)))
+		}()
 	}
 
   tlsConfig := &tls.Config {
@@ -1,10 +1,18 @@
 package main
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/justinas/nosurf"
+	"snipit.bikraj.net/internal/models"
 )
 
 func secureHeader(next http.Handler) http.Handler {
@@ -67,18 +75,238 @@ func(app *application) authenticate(next http.Handler) http.Handler {
   return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
     id:=app.sessionManager.GetInt(r.Context(),  "authenticatedUserID")
     if id==0 {
-      next.ServeHTTP(w, r) 
+      // Sessions are short-lived; a remember token brings the user back.
+      restored, err := app.restoreSession(w, r)
+      if err != nil {
+        app.serverError(w, err)
+        return
+      }
+      if restored == 0 {
+        next.ServeHTTP(w, r)
+        return
+      }
+      id = restored
+    }
+    // While an admin is impersonating someone, the session record is still
+    // the admin's.
+    impersonatorID := app.sessionManager.GetInt(r.Context(), "impersonatorID")
+    owner := id
+    if impersonatorID != 0 {
+      owner = impersonatorID
+    }
+    // A session whose record has been revoked is logged out on the spot.
+    session, err := app.userSessions.Get(app.sessionManager.GetString(r.Context(), "sessionID"))
+    if err != nil && !errors.Is(err, models.ErrNoRecord) {
+      app.serverError(w, err)
       return
     }
-    exists,err :=app.users.Exists(id)
-    if err!=nil {
+    if err != nil || session.UserID != owner {
+      app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+      app.sessionManager.Remove(r.Context(), "impersonatorID")
+      app.sessionManager.Remove(r.Context(), "sessionID")
+      next.ServeHTTP(w, r)
+      return
+    }
+    if time.Since(session.LastSeen) > sessionTouchInterval {
+      err = app.userSessions.Touch(session.ID, clientIP(r))
+      if err != nil {
+        app.serverError(w, err)
+        return
+      }
+    }
+    if impersonatorID != 0 {
+      impersonator, err := app.checkImpersonator(r, impersonatorID, id)
+      if err != nil {
+        app.serverError(w, err)
+        return
+      }
+      if impersonator == nil {
+        // The admin lost the right to impersonate, so they are back to
+        // being themselves.
+        id = impersonatorID
+      } else {
+        r = r.WithContext(context.WithValue(r.Context(), impersonatorContextKey, impersonator))
+      }
+    }
+    // Deleted and disabled accounts get no further than anonymous.
+    user, err := app.users.Get(id)
+    if err != nil && !errors.Is(err, models.ErrNoRecord) {
       app.serverError(w, err)
       return
     }
-    if exists {
+    if err == nil && !user.Disabled {
       ctx :=context.WithValue(r.Context(), isAuthenticatedContextKey ,  true)
+      ctx = context.WithValue(ctx, currentUserContextKey, user)
       r=r.WithContext(ctx)
     }
     next.ServeHTTP(w, r)
   })
 }
+
+// requireRole turns away users without at least role. It goes after
+// requireAuthentication, so there is always a current user.
+func (app *application) requireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := app.currentUser(r)
+			if user == nil || !user.HasRole(role) {
+				app.clientError(w, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+
+// forbidImpersonation keeps admins who are impersonating a user away from
+// the user's credentials and anything else that changes who can get into
+// the account.
+func (app *application) forbidImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.impersonator(r) != nil {
+			app.sessionManager.Put(r.Context(), "flash", "That isn't available while you are impersonating a user.")
+			http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitFormSize caps the request body with http.MaxBytesReader. It has to run
+// ahead of noSurf, which parses the form to find the CSRF token. Form bodies
+// are read field by field, and a field over the cap (in practice the
+// content) is dropped wherever it comes in the body, so the CSRF token still
+// validates and the handler can report the oversized content as a field
+// error. Bodies past formBodyFactor times the cap are refused outright.
+func (app *application) limitFormSize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType != "application/x-www-form-urlencoded" {
+			r.Body = http.MaxBytesReader(w, r.Body, app.maxFormBytes())
+			next.ServeHTTP(w, r)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, app.maxFormBytes()*formBodyFactor)
+		values, tooLarge, err := readFormFields(r.Body, int(app.maxFormBytes()))
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				app.clientError(w, http.StatusRequestEntityTooLarge)
+			} else {
+				app.clientError(w, http.StatusBadRequest)
+			}
+			return
+		}
+		if tooLarge {
+			r = r.WithContext(context.WithValue(r.Context(), formTooLargeContextKey, true))
+		}
+		r.PostForm = values
+		next.ServeHTTP(w, r)
+	})
+}
+
+// formBodyFactor bounds how much of an oversized form limitFormSize reads
+// looking for the fields after the one it drops.
+const formBodyFactor = 4
+
+// readFormFields parses a URL-encoded body one field at a time. Fields
+// longer than limit are skipped rather than buffered, and reported.
+func readFormFields(body io.Reader, limit int) (url.Values, bool, error) {
+	values := url.Values{}
+	br := bufio.NewReader(body)
+	var field []byte
+	skipping, skipped := false, false
+	for {
+		chunk, err := br.ReadSlice('&')
+		if err != nil && err != bufio.ErrBufferFull && err != io.EOF {
+			return nil, false, err
+		}
+		if !skipping {
+			field = append(field, chunk...)
+			if len(field) > limit {
+				skipping, skipped = true, true
+				field = field[:0]
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if !skipping {
+			parsed, parseErr := url.ParseQuery(strings.TrimSuffix(string(field), "&"))
+			if parseErr != nil {
+				return nil, false, parseErr
+			}
+			for k, vs := range parsed {
+				values[k] = append(values[k], vs...)
+			}
+		}
+		field, skipping = field[:0], false
+		if err == io.EOF {
+			return values, skipped, nil
+		}
+	}
+}
+
+// requireVerified sends users who haven't confirmed their email address to
+// the verification page. It must come after requireAuthentication, which
+// guarantees authenticate has loaded the user.
+func (app *application) requireVerified(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.currentUser(r).Verified {
+			http.Redirect(w, r, "/user/verify", http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticateToken identifies API requests by their personal access token.
+// API clients send no cookies, so these routes need neither sessions nor
+// noSurf. A request without an Authorization header carries on anonymously
+// and is turned away by requireScope.
+func (app *application) authenticateToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		scheme, raw, ok := strings.Cut(header, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			app.apiUnauthorized(w, `Bearer error="invalid_request"`)
+			return
+		}
+		token, err := app.apiTokens.Authenticate(strings.TrimSpace(raw))
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidCredentials) {
+				app.apiUnauthorized(w, `Bearer error="invalid_token"`)
+			} else {
+				app.apiServerError(w, err)
+			}
+			return
+		}
+		ctx := context.WithValue(r.Context(), apiTokenContextKey, token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requireScope only lets through requests made with a token that was
+// granted scope.
+func (app *application) requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := app.apiToken(r)
+			if token == nil {
+				app.apiUnauthorized(w, "Bearer")
+				return
+			}
+			if !token.HasScope(scope) {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, scope))
+				app.apiError(w, http.StatusForbidden, fmt.Sprintf("this token does not have the %s scope", scope))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"snipit.bikraj.net/internal/models"
+)
+
+// rememberCookie holds the "remember me" token. It is separate from the
+// session cookie so it can outlive the session by weeks.
+const rememberCookie = "remember_token"
+
+func (app *application) setRememberCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     rememberCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(app.rememberTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (app *application) clearRememberCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     rememberCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// rememberToken returns the token the browser sent, if any.
+func rememberToken(r *http.Request) string {
+	c, err := r.Cookie(rememberCookie)
+	if err != nil {
+		return ""
+	}
+	return c.Value
+}
+
+// remember issues a token for a login that asked to be remembered.
+func (app *application) remember(w http.ResponseWriter, id int) error {
+	token, err := app.rememberTokens.New(id, app.rememberTTL)
+	if err != nil {
+		return err
+	}
+	app.setRememberCookie(w, token)
+	return nil
+}
+
+// restoreSession logs the browser back in from its remember token, swapping
+// the token for a new one, and returns the user's ID. It returns 0 when
+// there is no usable token. A token that turns up again after being
+// swapped has been copied: its family is gone by then, and the account is
+// logged out everywhere in case the copy was used first.
+func (app *application) restoreSession(w http.ResponseWriter, r *http.Request) (int, error) {
+	token := rememberToken(r)
+	if token == "" {
+		return 0, nil
+	}
+	id, next, err := app.rememberTokens.Rotate(token, app.rememberTTL)
+	switch {
+	case errors.Is(err, models.ErrInvalidCredentials):
+		app.clearRememberCookie(w)
+		return 0, nil
+	case errors.Is(err, models.ErrTokenReused):
+		app.clearRememberCookie(w)
+		err = app.userSessions.RevokeAll(id, "")
+		if err != nil {
+			return 0, err
+		}
+		return 0, app.recordAudit(r, id, "user.remember_reuse", models.AuditTargetUser, id, nil)
+	case err != nil:
+		return 0, err
+	}
+
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		return 0, err
+	}
+	sessionID, err := app.userSessions.Create(id, clientIP(r), r.UserAgent())
+	if err != nil {
+		return 0, err
+	}
+	app.sessionManager.Put(r.Context(), "authenticatedUserID", id)
+	app.sessionManager.Put(r.Context(), "sessionID", sessionID)
+	app.setRememberCookie(w, next)
+	return id, app.recordAudit(r, id, "login.success", models.AuditTargetUser, id, map[string]string{"method": "remember"})
+}
@@ -2,15 +2,30 @@ package main
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/alice"
+	"snipit.bikraj.net/internal/models"
 	"snipit.bikraj.net/ui"
 )
 
 func (app *application) routes() http.Handler {
 router := httprouter.New()
-router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { app.notFound(w)
+router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		app.apiNotFound(w, r)
+		return
+	}
+	app.notFound(w)
+})
+// The router has set the Allow header by the time this runs.
+router.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		app.apiMethodNotAllowed(w, r)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
 })
 // Leave the static files route unchanged.
 fileServer := http.FileServer(http.FS(ui.Files))
@@ -21,6 +36,9 @@ dynamic := alice.New(app.sessionManager.LoadAndSave,noSurf,app.authenticate)
   router.Handler(http.MethodGet, "/", dynamic.ThenFunc(app.home)) 
   router.Handler(http.MethodGet, "/about",dynamic.ThenFunc(app.about)) 
   router.Handler(http.MethodGet, "/snippet/view/:id", dynamic.ThenFunc(app.snippetView))
+  router.Handler(http.MethodGet, "/snippet/raw/:id", dynamic.ThenFunc(app.snippetRaw))
+  router.Handler(http.MethodGet, "/u/:username", dynamic.ThenFunc(app.userProfile))
+  router.Handler(http.MethodGet, "/u/:username/avatar.svg", dynamic.ThenFunc(app.userAvatar))
   // Routes for Authentication
 
  
@@ -28,15 +46,124 @@ dynamic := alice.New(app.sessionManager.LoadAndSave,noSurf,app.authenticate)
   router.Handler(http.MethodPost, "/user/signup", dynamic.ThenFunc(app.userSignUpPost)) 
   router.Handler(http.MethodGet, "/user/login", dynamic.ThenFunc(app.userLogin)) 
   router.Handler(http.MethodPost, "/user/login", dynamic.ThenFunc(app.userLoginPost)) 
-  router.Handler(http.MethodGet, "/account/password/update",dynamic.ThenFunc(app.changePassword))
-  router.Handler(http.MethodPost,"/account/password/update" , dynamic.ThenFunc(app.userChangePasswordPost))
+  router.Handler(http.MethodGet, "/user/login/passkey/options", dynamic.ThenFunc(app.passkeyLoginOptions))
+  router.Handler(http.MethodGet, "/user/login/2fa", dynamic.ThenFunc(app.twoFactorLogin))
+  router.Handler(http.MethodPost, "/user/login/2fa", dynamic.ThenFunc(app.twoFactorLoginPost))
+  router.Handler(http.MethodGet, "/user/login/oidc/:provider", dynamic.ThenFunc(app.oidcLogin))
+  router.Handler(http.MethodGet, "/user/login/oidc/:provider/callback", dynamic.ThenFunc(app.oidcCallback))
+  router.Handler(http.MethodGet, "/user/verify/:token", dynamic.ThenFunc(app.userVerify))
+  router.Handler(http.MethodGet, "/user/password/forgot", dynamic.ThenFunc(app.passwordForgot))
+  router.Handler(http.MethodPost, "/user/password/forgot", dynamic.ThenFunc(app.passwordForgotPost))
+  router.Handler(http.MethodGet, "/user/password/reset/:token", dynamic.ThenFunc(app.passwordReset))
+  router.Handler(http.MethodPost, "/user/password/reset/:token", dynamic.ThenFunc(app.passwordResetPost))
   protected :=dynamic.Append(app.requireAuthentication)
   // Routes for Snippets
-  router.Handler(http.MethodGet, "/snippet/create", protected.ThenFunc(app.snippetCreate)) 
-  router.Handler(http.MethodPost, "/snippet/create", protected.ThenFunc(app.snippetCreatePost))
+  verified := protected.Append(app.requireVerified)
+  // Credentials and the account itself are off limits to an admin who is
+  // impersonating its owner.
+  sensitive := protected.Append(app.forbidImpersonation)
+  router.Handler(http.MethodGet, "/snippet/create", verified.ThenFunc(app.snippetCreate)) 
+  // Snippet content can be large, so the body is capped before noSurf reads it.
+  limited := alice.New(app.limitFormSize).Extend(protected)
+  router.Handler(http.MethodPost, "/snippet/create", limited.Append(app.requireVerified).ThenFunc(app.snippetCreatePost))
+  router.Handler(http.MethodGet, "/snippet/templates", protected.ThenFunc(app.snippetTemplateList))
+  router.Handler(http.MethodGet, "/snippet/template/create", protected.ThenFunc(app.snippetTemplateCreate))
+  router.Handler(http.MethodPost, "/snippet/template/create", limited.ThenFunc(app.snippetTemplateCreatePost))
+  router.Handler(http.MethodPost, "/snippet/template/delete/:id", protected.ThenFunc(app.snippetTemplateDeletePost))
   router.Handler(http.MethodPost, "/user/logout", protected.ThenFunc(app.userLogoutPost))
+  router.Handler(http.MethodGet, "/user/verify", protected.ThenFunc(app.userVerifyStatus))
+  router.Handler(http.MethodPost, "/user/verify", protected.ThenFunc(app.userVerifyResendPost))
   // Routes for Account Viewing
   router.Handler(http.MethodGet,  "/account/view", protected.ThenFunc(app.accountView))
+  router.Handler(http.MethodGet, "/account/edit", protected.ThenFunc(app.accountEdit))
+  router.Handler(http.MethodPost, "/account/edit", sensitive.ThenFunc(app.accountEditPost))
+  router.Handler(http.MethodGet, "/account/email/confirm/:token", sensitive.ThenFunc(app.accountEmailConfirm))
+  router.Handler(http.MethodGet, "/account/profile", protected.ThenFunc(app.accountProfile))
+  router.Handler(http.MethodPost, "/account/profile", protected.ThenFunc(app.accountProfilePost))
+  router.Handler(http.MethodGet, "/account/password/update",sensitive.ThenFunc(app.changePassword))
+  router.Handler(http.MethodPost,"/account/password/update" , sensitive.ThenFunc(app.userChangePasswordPost))
+  router.Handler(http.MethodGet, "/account/2fa", sensitive.ThenFunc(app.twoFactorSettings))
+  router.Handler(http.MethodGet, "/account/2fa/qr.png", sensitive.ThenFunc(app.twoFactorQRCode))
+  router.Handler(http.MethodPost, "/account/2fa/enable", sensitive.ThenFunc(app.twoFactorEnablePost))
+  router.Handler(http.MethodPost, "/account/2fa/disable", sensitive.ThenFunc(app.twoFactorDisablePost))
+  router.Handler(http.MethodGet, "/account/security", protected.ThenFunc(app.accountSecurity))
+  router.Handler(http.MethodGet, "/account/sessions", protected.ThenFunc(app.userSessionList))
+  router.Handler(http.MethodPost, "/account/sessions/revoke/:id", sensitive.ThenFunc(app.userSessionRevokePost))
+  router.Handler(http.MethodPost, "/account/sessions/revoke-others", sensitive.ThenFunc(app.userSessionRevokeOthersPost))
+  router.Handler(http.MethodGet, "/account/tokens", protected.ThenFunc(app.apiTokenList))
+  router.Handler(http.MethodPost, "/account/tokens", verified.Append(app.forbidImpersonation).ThenFunc(app.apiTokenCreatePost))
+  router.Handler(http.MethodPost, "/account/tokens/revoke/:id", sensitive.ThenFunc(app.apiTokenRevokePost))
+  router.Handler(http.MethodGet, "/account/keys", protected.ThenFunc(app.sshKeyList))
+  router.Handler(http.MethodPost, "/account/keys", verified.Append(app.forbidImpersonation).ThenFunc(app.sshKeyCreatePost))
+  router.Handler(http.MethodPost, "/account/keys/:id/delete", sensitive.ThenFunc(app.sshKeyDeletePost))
+  router.Handler(http.MethodGet, "/account/passkeys", protected.ThenFunc(app.passkeyList))
+  router.Handler(http.MethodGet, "/account/passkeys/options", sensitive.ThenFunc(app.passkeyCreateOptions))
+  router.Handler(http.MethodPost, "/account/passkeys", sensitive.ThenFunc(app.passkeyCreatePost))
+  router.Handler(http.MethodPost, "/account/passkeys/:id/delete", sensitive.ThenFunc(app.passkeyDeletePost))
+  router.Handler(http.MethodGet, "/account/export", sensitive.ThenFunc(app.accountExport))
+  router.Handler(http.MethodGet, "/account/delete", protected.ThenFunc(app.accountDelete))
+  router.Handler(http.MethodPost, "/account/delete", sensitive.ThenFunc(app.accountDeletePost))
+  router.Handler(http.MethodGet, "/account/delete/confirm/:token", sensitive.ThenFunc(app.accountDeleteConfirm))
+  router.Handler(http.MethodPost, "/account/delete/confirm/:token", sensitive.ThenFunc(app.accountDeleteConfirmPost))
+  router.Handler(http.MethodGet, "/account/orgs", protected.ThenFunc(app.orgList))
+  router.Handler(http.MethodPost, "/account/orgs", verified.ThenFunc(app.orgCreatePost))
+  // Organization pages are for members only.
+  router.Handler(http.MethodGet, "/org/:slug", protected.ThenFunc(app.orgView))
+  router.Handler(http.MethodPost, "/org/:slug/invite", protected.ThenFunc(app.orgInvitePost))
+  router.Handler(http.MethodGet, "/org/:slug/invite/:token", protected.ThenFunc(app.orgInviteView))
+  router.Handler(http.MethodPost, "/org/:slug/invite/:token", protected.ThenFunc(app.orgInviteAcceptPost))
+  router.Handler(http.MethodPost, "/org/:slug/members/:id/remove", protected.ThenFunc(app.orgMemberRemovePost))
+  // Moderation. Staff are moderators and admins; only admins change roles.
+  staff := protected.Append(app.requireRole(models.RoleModerator))
+  admins := protected.Append(app.requireRole(models.RoleAdmin))
+  router.Handler(http.MethodGet, "/admin", staff.ThenFunc(app.adminDashboard))
+  router.Handler(http.MethodGet, "/admin/audit", admins.ThenFunc(app.adminAudit))
+  router.Handler(http.MethodGet, "/admin/invites", admins.ThenFunc(app.adminInvites))
+  router.Handler(http.MethodPost, "/admin/invites", admins.ThenFunc(app.adminInviteCreatePost))
+  router.Handler(http.MethodPost, "/admin/invites/:id/revoke", admins.ThenFunc(app.adminInviteRevokePost))
+  router.Handler(http.MethodGet, "/admin/templates/create", admins.ThenFunc(app.adminTemplateCreate))
+  router.Handler(http.MethodPost, "/admin/templates", admins.ThenFunc(app.adminTemplateCreatePost))
+  router.Handler(http.MethodPost, "/admin/templates/:id/delete", admins.ThenFunc(app.adminTemplateDeletePost))
+  router.Handler(http.MethodGet, "/admin/users", staff.ThenFunc(app.adminUsers))
+  router.Handler(http.MethodPost, "/admin/users/:id/impersonate", admins.ThenFunc(app.adminImpersonatePost))
+  // Whoever is impersonating is, as far as requireRole can tell, the user.
+  router.Handler(http.MethodPost, "/admin/impersonation/stop", protected.ThenFunc(app.impersonateStopPost))
+  router.Handler(http.MethodPost, "/admin/users/:id/disable", staff.ThenFunc(app.adminUserDisablePost))
+  router.Handler(http.MethodPost, "/admin/users/:id/enable", staff.ThenFunc(app.adminUserEnablePost))
+  router.Handler(http.MethodPost, "/admin/users/:id/role", admins.ThenFunc(app.adminUserRolePost))
+  router.Handler(http.MethodGet, "/admin/snippets", staff.ThenFunc(app.adminSnippets))
+  router.Handler(http.MethodPost, "/admin/snippets/:id/delete", staff.ThenFunc(app.adminSnippetDeletePost))
+  for _, route := range app.apiRoutes() {
+    router.Handler(route.method, route.path, route.handler)
+  }
 standard := alice.New(app.recoverPanic, app.logRequest, secureHeader )
 return standard.Then(router)
 }
+
+// apiRoute is a route under /api. Every one of them must be described in
+// ui/api/openapi.json.
+type apiRoute struct {
+	method  string
+	path    string
+	handler http.Handler
+}
+
+// apiRoutes lists the API's routes. The API authenticates with bearer
+// tokens instead of cookies, so it skips the session and CSRF middleware
+// altogether.
+func (app *application) apiRoutes() []apiRoute {
+	api := alice.New(app.authenticateToken)
+	read := api.Append(app.requireScope(models.ScopeRead))
+	write := api.Append(app.requireScope(models.ScopeWrite))
+	remove := api.Append(app.requireScope(models.ScopeDelete))
+	return []apiRoute{
+		{http.MethodGet, "/api/openapi.json", http.HandlerFunc(app.apiSpec)},
+		{http.MethodGet, "/api/docs", http.HandlerFunc(app.apiDocs)},
+		{http.MethodGet, "/api/docs.js", http.HandlerFunc(app.apiDocsScript)},
+		{http.MethodGet, "/api/v1/snippets", read.ThenFunc(app.apiSnippetList)},
+		{http.MethodPost, "/api/v1/snippets", write.ThenFunc(app.apiSnippetCreate)},
+		{http.MethodGet, "/api/v1/snippets/:id", read.ThenFunc(app.apiSnippetGet)},
+		{http.MethodPatch, "/api/v1/snippets/:id", write.ThenFunc(app.apiSnippetUpdate)},
+		{http.MethodDelete, "/api/v1/snippets/:id", remove.ThenFunc(app.apiSnippetDelete)},
+	}
+}
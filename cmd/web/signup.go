@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Signup modes. Open lets anyone register, invite needs a code from an
+// admin, and domain only accepts addresses at the listed email domains.
+const (
+	signupOpen   = "open"
+	signupInvite = "invite"
+	signupDomain = "domain"
+)
+
+// signupPolicy decides who may create an account, whether through the
+// signup form or by logging in with an SSO provider for the first time.
+type signupPolicy struct {
+	Mode    string
+	Domains []string
+}
+
+// newSignupPolicy checks the -signup-mode and -signup-domains flags.
+func newSignupPolicy(mode, domains string) (signupPolicy, error) {
+	p := signupPolicy{Mode: mode}
+	for _, d := range strings.Split(domains, ",") {
+		d = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "@"))
+		if d != "" {
+			p.Domains = append(p.Domains, d)
+		}
+	}
+	switch mode {
+	case signupOpen, signupInvite:
+	case signupDomain:
+		if len(p.Domains) == 0 {
+			return p, errors.New("-signup-mode domain needs at least one domain in -signup-domains")
+		}
+	default:
+		return p, fmt.Errorf("unknown -signup-mode %q", mode)
+	}
+	return p, nil
+}
+
+// NeedsInvite tells the signup form to ask for an invite code.
+func (p signupPolicy) NeedsInvite() bool {
+	return p.Mode == signupInvite
+}
+
+// AllowsEmail reports whether email may be used for a new account. Only
+// exact domains match; subdomains have to be listed themselves.
+func (p signupPolicy) AllowsEmail(email string) bool {
+	if p.Mode != signupDomain {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, d := range p.Domains {
+		if domain == d {
+			return true
+		}
+	}
+	return false
+}
+
+// DomainList is the allowed domains for showing on the signup form.
+func (p signupPolicy) DomainList() string {
+	return strings.Join(p.Domains, ", ")
+}
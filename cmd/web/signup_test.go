@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"snipit.bikraj.net/internal/assert"
+)
+
+func TestSignupPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		domains string
+		email   string
+		wantErr bool
+		want    bool
+	}{
+		{name: "Open", mode: signupOpen, email: "anyone@example.net", want: true},
+		{name: "Invite", mode: signupInvite, email: "anyone@example.net", want: true},
+		{name: "Listed domain", mode: signupDomain, domains: "example.org, @Corp.example", email: "a@corp.example", want: true},
+		{name: "Domain case", mode: signupDomain, domains: "example.org", email: "a@EXAMPLE.org", want: true},
+		{name: "Other domain", mode: signupDomain, domains: "example.org", email: "a@example.net"},
+		{name: "Subdomain", mode: signupDomain, domains: "example.org", email: "a@mail.example.org"},
+		{name: "Lookalike", mode: signupDomain, domains: "example.org", email: "a@badexample.org"},
+		{name: "No domains", mode: signupDomain, wantErr: true},
+		{name: "Unknown mode", mode: "closed", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newSignupPolicy(tt.mode, tt.domains)
+			assert.Equal(t, err != nil, tt.wantErr)
+			if err == nil {
+				assert.Equal(t, p.AllowsEmail(tt.email), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"snipit.bikraj.net/internal/models"
+	Validator "snipit.bikraj.net/internal/validator"
+)
+
+// sshPasteTimeout bounds a whole connection to the paste server, from the
+// handshake to the reply, so stalled clients don't hold it open.
+const sshPasteTimeout = time.Minute
+
+// sshPasteUsage is shown to anyone who connects without piping in a file.
+const sshPasteUsage = `Pipe a file in to create a snippet:
+
+  %[1]s [options] [title] < main.go
+
+Options:
+  -visibility public|unlisted|private   who can see it (default public)
+  -expires 1|7|365                      days until it expires (default 365)
+  -language name                        defaults to the title's extension
+`
+
+// sshCommand is what users type to reach the paste server: the web host
+// name with the port the server listens on.
+func sshCommand(baseURL string, addr net.Addr) string {
+	host := baseURL
+	if u, err := url.Parse(baseURL); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+	if tcp, ok := addr.(*net.TCPAddr); ok && tcp.Port != 22 {
+		return fmt.Sprintf("ssh -p %d %s", tcp.Port, host)
+	}
+	return "ssh " + host
+}
+
+// loadSSHHostKey reads the server's private key from file, creating an
+// Ed25519 key there on first start so the server keeps its identity.
+func loadSSHHostKey(file string) (ssh.Signer, error) {
+	b, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		block, err := ssh.MarshalPrivateKey(key, "")
+		if err != nil {
+			return nil, err
+		}
+		b = pem.EncodeToMemory(block)
+		if err := os.WriteFile(file, b, 0600); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKey(b)
+}
+
+// sshServerConfig accepts only public keys registered under /account/keys.
+// The owner's ID travels to the session in the connection's permissions.
+func (app *application) sshServerConfig(hostKey ssh.Signer) *ssh.ServerConfig {
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			userID, err := app.sshKeys.Authenticate(ssh.FingerprintSHA256(key))
+			if err != nil {
+				if !errors.Is(err, models.ErrInvalidCredentials) {
+					app.errorLog.Println(err)
+				}
+				return nil, err
+			}
+			return &ssh.Permissions{Extensions: map[string]string{"user-id": strconv.Itoa(userID)}}, nil
+		},
+		ServerVersion: "SSH-2.0-Snippetbox",
+	}
+	config.AddHostKey(hostKey)
+	return config
+}
+
+// serveSSH runs the paste server on l until the listener is closed.
+func (app *application) serveSSH(l net.Listener, config *ssh.ServerConfig) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go app.handleSSHConn(conn, config)
+	}
+}
+
+func (app *application) handleSSHConn(netConn net.Conn, config *ssh.ServerConfig) {
+	defer netConn.Close()
+	netConn.SetDeadline(time.Now().Add(sshPasteTimeout))
+	// Failed handshakes, including unknown keys, are routine on a public
+	// port and not worth logging.
+	conn, chans, reqs, err := ssh.NewServerConn(netConn, config)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	go ssh.DiscardRequests(reqs)
+	userID, err := strconv.Atoi(conn.Permissions.Extensions["user-id"])
+	if err != nil {
+		return
+	}
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		ch, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go app.handleSSHSession(userID, ch, requests)
+	}
+}
+
+// handleSSHSession waits for the client to ask for a shell or a command;
+// either way what it sends on stdin becomes the snippet, and the command,
+// if any, holds options and the title.
+func (app *application) handleSSHSession(userID int, ch ssh.Channel, requests <-chan *ssh.Request) {
+	defer ch.Close()
+	tty := false
+	for req := range requests {
+		switch req.Type {
+		case "pty-req":
+			tty = true
+			req.Reply(true, nil)
+		case "shell", "exec":
+			var command struct{ Command string }
+			if req.Type == "exec" {
+				if err := ssh.Unmarshal(req.Payload, &command); err != nil {
+					req.Reply(false, nil)
+					continue
+				}
+			}
+			req.Reply(true, nil)
+			go ssh.DiscardRequests(requests)
+			status := app.sshPaste(userID, ch, command.Command, tty)
+			ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+			return
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// sshPaste creates a snippet from what the client sends and replies with
+// its URL, returning the exit status for the client.
+func (app *application) sshPaste(userID int, ch ssh.Channel, command string, tty bool) uint32 {
+	// A terminal means nothing was piped in, and reading would wait for
+	// the user to type a whole snippet.
+	if tty {
+		fmt.Fprintf(ch.Stderr(), sshPasteUsage, app.sshHost)
+		return 1
+	}
+	flags := flag.NewFlagSet("paste", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	visibility := flags.String("visibility", models.VisibilityPublic, "")
+	expires := flags.Int("expires", 365, "")
+	language := flags.String("language", "", "")
+	if err := flags.Parse(strings.Fields(command)); err != nil {
+		fmt.Fprintf(ch.Stderr(), "%s\n\n"+sshPasteUsage, err, app.sshHost)
+		return 2
+	}
+	title := strings.Join(flags.Args(), " ")
+	if title == "" {
+		title = "Pasted " + time.Now().UTC().Format("02 Jan 2006 at 15:04")
+	}
+	if *language == "" && !strings.Contains(title, " ") {
+		*language = strings.TrimPrefix(path.Ext(title), ".")
+	}
+
+	// Read one byte past the limit so oversized content is noticed.
+	b, err := io.ReadAll(io.LimitReader(ch, int64(app.maxContentBytes)+1))
+	if err != nil {
+		fmt.Fprintln(ch.Stderr(), "Reading the snippet failed")
+		return 1
+	}
+	content := string(b)
+	var v Validator.Validator
+	v.CheckField(Validator.MaxChars(title, 100), "title", "This field cannot be more than 100 characters long")
+	v.CheckField(Validator.MaxBytes(content, app.maxContentBytes), "content",
+		fmt.Sprintf("This field cannot be more than %d KB", app.maxContentBytes/1024))
+	v.CheckField(Validator.NotBlank(content), "content", "This field cannot be blank")
+	checkSnippetDefaults(&v, *language, *visibility, *expires)
+	v.CheckField(*visibility != models.VisibilityOrganization, "visibility", "Organization snippets can only be created on the website")
+	if !v.Valid() {
+		keys := make([]string, 0, len(v.FieldErrors))
+		for key := range v.FieldErrors {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(ch.Stderr(), "%s: %s\n", key, v.FieldErrors[key])
+		}
+		return 1
+	}
+
+	id, err := app.snippets.Insert(userID, 0, title, content, *language, *visibility, *expires)
+	if err != nil {
+		app.errorLog.Println(err)
+		fmt.Fprintln(ch.Stderr(), "The server encountered a problem")
+		return 1
+	}
+	fmt.Fprintf(ch, "%s/snippet/view/%d\n", app.baseURL, id)
+	return 0
+}
@@ -7,18 +7,46 @@ import (
 	"time"
 
 	"snipit.bikraj.net/internal/models"
+	"snipit.bikraj.net/internal/oidc"
 	"snipit.bikraj.net/ui"
 )
 
 type templateData struct {
-	CurrentYear     int
-	Snippet         *models.Snippet
-	Snippets        []*models.Snippet
-	User            *models.User
-	Form            interface{}
-	Flash           string
-	IsAuthenticated bool
-	CSRFToken       string
+	CurrentYear      int
+	Snippet          *models.Snippet
+	Snippets         []*models.Snippet
+	SnippetTemplates []*models.SnippetTemplate
+	User             *models.User
+	Form             interface{}
+	Flash            string
+	IsAuthenticated  bool
+	CSRFToken        string
+	Truncated        bool
+	TwoFactorEnabled bool
+	TOTPSecret       string
+	RecoveryCodes    []string
+	UserSessions     []*models.UserSession
+	CurrentSession   string
+	APITokens        []*models.APIToken
+	NewAPIToken      string
+	LoginProviders   []*oidc.Provider
+	Users            []*models.User
+	AuditEntries     []*models.AuditEntry
+	Organizations    []*models.Organization
+	Organization     *models.Organization
+	OrgMembers       []*models.OrgMember
+	Invitation       *models.OrgInvitation
+	PrevPage         int
+	NextPage         int
+	Signup           signupPolicy
+	Invites          []*models.Invite
+	NewInviteCode    string
+	InviteLink       string
+	SSHKeys          []*models.SSHKey
+	SSHHost          string
+	Passkeys         []*models.Passkey
+	Impersonator     *models.User
+	Impersonating    *models.User
 }
 
 func humanDate(t time.Time) string {
@@ -10,12 +10,18 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
+	"snipit.bikraj.net/internal/mailer"
 	"snipit.bikraj.net/internal/models/mocks"
+	"snipit.bikraj.net/internal/signer"
+	"snipit.bikraj.net/internal/throttle"
+	Validator "snipit.bikraj.net/internal/validator"
+	"snipit.bikraj.net/internal/webauthn"
 )
 
 var csrfTokenRx = regexp.MustCompile(`<input type='hidden' name='csrf_token' value='(.+)'>` )
@@ -43,16 +49,40 @@ func newTestApplication(t *testing.T) *application {
 
   sessionManager.Cookie.Secure = true
 
-	return &application{
+	app := &application{
 		errorLog: log.New(io.Discard, "", 0),
     infoLog: log.New(io.Discard, "", 0),
     snippets: &mocks.SnippetModel{},
     users: &mocks.UserModel{},
+    snippetTemplates: &mocks.SnippetTemplateModel{},
+    passwordResets: &mocks.PasswordResetModel{},
+    twoFactor: &mocks.TwoFactorModel{},
+    userSessions: &mocks.UserSessionModel{},
+    apiTokens: &mocks.APITokenModel{},
+    identities: &mocks.IdentityModel{},
+    audit: &mocks.AuditModel{},
+    orgs: &mocks.OrganizationModel{},
+    rememberTokens: &mocks.RememberTokenModel{},
+    invites: &mocks.InviteModel{},
+    sshKeys: &mocks.SSHKeyModel{},
+    passkeys: &mocks.PasskeyModel{},
     templateCache: templateCache,
     formDecoder: formDecoder,
     sessionManager: sessionManager,
     debug: true,
+    maxContentBytes: 64 * 1024,
+    mailer: &mailer.Outbox{},
+    signer: signer.New([]byte("test-secret")),
+    baseURL: "https://snipit.test",
+    deletionGrace: 30 * 24 * time.Hour,
+    passwordPolicy: Validator.DefaultPasswordPolicy(),
+    rememberTTL: 30 * 24 * time.Hour,
+    auditRetention: 365 * 24 * time.Hour,
+    signup: signupPolicy{Mode: signupOpen},
+    relyingParty: &webauthn.RelyingParty{ID: "snipit.test", Name: "Snippetbox", Origin: "https://snipit.test"},
 	}
+	app.loginAccountGuard, app.loginIPGuard = newLoginGuards(&throttle.MemoryStore{})
+	return app
 }
 
 type testServer struct {
@@ -105,23 +135,41 @@ if err != nil {
   return rs.StatusCode, rs.Header, string(body)
 }
 
+// login signs the test client in through the real login form.
+func (ts *testServer) login(t *testing.T, email, password string) {
+	t.Helper()
+	_, _, body := ts.get(t, "/user/login")
+	form := url.Values{}
+	form.Add("email", email)
+	form.Add("password", password)
+	form.Add("csrf_token", extractCSRFToken(t, body))
+	code, _, _ := ts.postForm(t, "/user/login", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("login as %s: got status %d", email, code)
+	}
+}
 
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
+// apiRequest calls an API route with an optional bearer token and body.
+func (ts *testServer) apiRequest(t *testing.T, method, urlPath, token, body string) (int, http.Header, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+urlPath, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+	b, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rs.StatusCode, rs.Header, string(b)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"snipit.bikraj.net/internal/mailer"
+	"snipit.bikraj.net/internal/models"
+	"snipit.bikraj.net/internal/throttle"
+)
+
+// newLoginGuards returns the backoff policies for failed logins. Accounts
+// lock quickly; client IPs get more headroom because many people can share
+// one address behind NAT.
+func newLoginGuards(store throttle.Store) (*throttle.Guard, *throttle.Guard) {
+	account := &throttle.Guard{
+		Store:     store,
+		Prefix:    "account:",
+		Threshold: 5,
+		BaseDelay: 30 * time.Second,
+		MaxDelay:  15 * time.Minute,
+		Window:    time.Hour,
+	}
+	ip := &throttle.Guard{
+		Store:     store,
+		Prefix:    "ip:",
+		Threshold: 20,
+		BaseDelay: 30 * time.Second,
+		MaxDelay:  15 * time.Minute,
+		Window:    time.Hour,
+	}
+	return account, ip
+}
+
+// lockedOut answers a login attempt made while the account or client is
+// locked, telling the user how long to wait.
+func (app *application) lockedOut(w http.ResponseWriter, r *http.Request, form userLoginForm, wait time.Duration) {
+	err := app.recordLoginFailure(r, strings.ToLower(strings.TrimSpace(form.Email)), "throttled")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	form.AddNonFieldError(fmt.Sprintf("Too many failed login attempts. Please try again in %s.", humanWait(wait)))
+	data := app.newTemplateData(r)
+	data.Form = form
+	w.Header().Set("Retry-After", strconv.Itoa(int(wait.Round(time.Second).Seconds())))
+	app.render(w, http.StatusTooManyRequests, "login.tmpl.html", data)
+}
+
+// sendLockoutNotice warns the owner of email, if there is one, that their
+// account has been locked by failed logins from ip.
+func (app *application) sendLockoutNotice(email, ip string) error {
+	user, err := app.users.GetByEmail(email)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil
+		}
+		return err
+	}
+	return app.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your Snippetbox account has been locked",
+		Body: fmt.Sprintf("Hi %s,\n\nThere have been several failed attempts to log in to your account, "+
+			"most recently from %s, so we have temporarily locked it.\n\n"+
+			"If this wasn't you, you may want to reset your password:\n\n%s/user/password/forgot\n",
+			user.Name, ip, app.baseURL),
+	})
+}
+
+func humanWait(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%d seconds", int(d.Round(time.Second).Seconds()))
+	}
+	minutes := int((d + time.Minute - 1) / time.Minute)
+	if minutes == 1 {
+		return "1 minute"
+	}
+	return fmt.Sprintf("%d minutes", minutes)
+}
@@ -1,6 +1,6 @@
 module snipit.bikraj.net
 
-go 1.21.5
+go 1.23.0
 
 require (
 	github.com/alexedwards/scs/mysqlstore v0.0.0-20240316134038-7e11d57e8885
@@ -10,7 +10,11 @@ require (
 	github.com/julienschmidt/httprouter v1.3.0
 	github.com/justinas/alice v1.2.0
 	github.com/justinas/nosurf v1.1.1
-	golang.org/x/crypto v0.24.0
+	golang.org/x/crypto v0.35.0
+	rsc.io/qr v0.2.0
 )
 
-require filippo.io/edwards25519 v1.1.0 // indirect
+require (
+	filippo.io/edwards25519 v1.1.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+)
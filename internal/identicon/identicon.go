@@ -0,0 +1,51 @@
+// Package identicon draws the default avatars shown on profiles: a
+// symmetric 5x5 pattern of squares in a single colour, derived from a hash
+// of the seed so that the same user always gets the same picture.
+package identicon
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+)
+
+const (
+	cells = 5
+	// cellSize and margin are in SVG user units; the image scales freely.
+	cellSize = 10
+	margin   = 5
+	size     = cells*cellSize + 2*margin
+)
+
+// SVG returns the identicon for seed as a standalone SVG document.
+func SVG(seed string) []byte {
+	sum := sha256.Sum256([]byte(seed))
+
+	// The first two bytes pick the hue and the next the lightness, which is
+	// kept in a range that reads well on a light background.
+	hue := (int(sum[0])<<8 | int(sum[1])) % 360
+	lightness := 35 + int(sum[2])%20
+	fill := fmt.Sprintf("hsl(%d,55%%,%d%%)", hue, lightness)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d">`, size, size, size, size)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#f0f0f0"/>`, size, size)
+	for y := 0; y < cells; y++ {
+		// Only the left three columns come from the hash; the right two
+		// mirror them.
+		for x := 0; x < (cells+1)/2; x++ {
+			if sum[3+y*3+x]%2 == 0 {
+				continue
+			}
+			for _, col := range []int{x, cells - 1 - x} {
+				fmt.Fprintf(&buf, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`,
+					margin+col*cellSize, margin+y*cellSize, cellSize, cellSize, fill)
+				if col == cells-1-col {
+					break
+				}
+			}
+		}
+	}
+	buf.WriteString(`</svg>`)
+	return buf.Bytes()
+}
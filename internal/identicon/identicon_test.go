@@ -0,0 +1,44 @@
+package identicon
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+)
+
+func TestSVG(t *testing.T) {
+	a := SVG("alice")
+	if !bytes.Equal(a, SVG("alice")) {
+		t.Error("same seed gave different images")
+	}
+	if bytes.Equal(a, SVG("bob")) {
+		t.Error("different seeds gave the same image")
+	}
+
+	var doc struct {
+		XMLName xml.Name
+		Rects   []struct {
+			X int `xml:"x,attr"`
+			Y int `xml:"y,attr"`
+		} `xml:"rect"`
+	}
+	if err := xml.Unmarshal(a, &doc); err != nil {
+		t.Fatalf("not valid XML: %v", err)
+	}
+	if doc.XMLName.Local != "svg" {
+		t.Errorf("root element is %q; want svg", doc.XMLName.Local)
+	}
+
+	// Every filled cell has its mirror image filled too. The first rect is
+	// the background.
+	filled := map[[2]int]bool{}
+	for _, r := range doc.Rects[1:] {
+		filled[[2]int{r.X, r.Y}] = true
+	}
+	for cell := range filled {
+		mirror := [2]int{size - cellSize - cell[0], cell[1]}
+		if !filled[mirror] {
+			t.Errorf("cell at %v is filled but its mirror %v is not", cell, mirror)
+		}
+	}
+}
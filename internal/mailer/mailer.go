@@ -0,0 +1,117 @@
+// Package mailer sends the application's transactional email.
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrHeaderInjection is returned for messages whose recipient or subject
+// contains a line break, which would let it add headers of its own.
+var ErrHeaderInjection = errors.New("mailer: line break in header")
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer is implemented by everything that can deliver a Message.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// SMTP delivers messages through an SMTP server. Username and Password are
+// optional; when set the connection uses PLAIN auth.
+type SMTP struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTP) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	b, err := format(m.From, msg)
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(m.Addr, auth, m.From, []string{msg.To}, b)
+}
+
+// Outbox keeps every message in memory and, when Dir is set, also writes it
+// to Dir as an .eml file. It is meant for development and tests.
+type Outbox struct {
+	Dir string
+
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (o *Outbox) Send(msg Message) error {
+	b, err := format("outbox@localhost", msg)
+	if err != nil {
+		return err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, msg)
+	if o.Dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(o.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%03d.eml", time.Now().UnixNano(), len(o.messages))
+	return os.WriteFile(filepath.Join(o.Dir, name), b, 0o644)
+}
+
+// Messages returns a copy of everything sent so far.
+func (o *Outbox) Messages() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]Message(nil), o.messages...)
+}
+
+// Last returns the most recent message sent to the given address.
+func (o *Outbox) Last(to string) (Message, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i := len(o.messages) - 1; i >= 0; i-- {
+		if o.messages[i].To == to {
+			return o.messages[i], true
+		}
+	}
+	return Message{}, false
+}
+
+func format(from string, msg Message) ([]byte, error) {
+	for _, v := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(v, "\r\n") {
+			return nil, ErrHeaderInjection
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String()), nil
+}
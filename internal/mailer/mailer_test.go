@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"snipit.bikraj.net/internal/assert"
+)
+
+func TestOutbox(t *testing.T) {
+	dir := t.TempDir()
+	outbox := &Outbox{Dir: dir}
+
+	err := outbox.Send(Message{To: "alice@example.com", Subject: "First", Body: "one"})
+	assert.NilError(t, err)
+	err = outbox.Send(Message{To: "bob@example.com", Subject: "Second", Body: "two\nlines"})
+	assert.NilError(t, err)
+
+	assert.Equal(t, len(outbox.Messages()), 2)
+
+	msg, ok := outbox.Last("bob@example.com")
+	assert.Equal(t, ok, true)
+	assert.Equal(t, msg.Subject, "Second")
+
+	_, ok = outbox.Last("carol@example.com")
+	assert.Equal(t, ok, false)
+
+	files, err := os.ReadDir(dir)
+	assert.NilError(t, err)
+	assert.Equal(t, len(files), 2)
+
+	eml, err := os.ReadFile(dir + "/" + files[1].Name())
+	assert.NilError(t, err)
+	assert.StringContains(t, string(eml), "To: bob@example.com\r\n")
+	assert.Equal(t, strings.HasSuffix(string(eml), "\r\n\r\ntwo\r\nlines"), true)
+}
+
+func TestHeaderInjection(t *testing.T) {
+	outbox := &Outbox{}
+	tests := []struct {
+		name string
+		msg  Message
+	}{
+		{"Subject", Message{To: "alice@example.com", Subject: "Join Acme\r\nBcc: eve@example.com"}},
+		{"Bare newline", Message{To: "alice@example.com", Subject: "Join Acme\nBcc: eve@example.com"}},
+		{"Recipient", Message{To: "alice@example.com\r\nBcc: eve@example.com", Subject: "Hi"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := outbox.Send(tt.msg)
+			assert.Equal(t, errors.Is(err, ErrHeaderInjection), true)
+		})
+	}
+	assert.Equal(t, len(outbox.Messages()), 0)
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Scopes a personal API token can be granted.
+const (
+	ScopeRead   = "read"
+	ScopeWrite  = "write"
+	ScopeDelete = "delete"
+)
+
+// apiTokenPrefix marks our tokens so they are easy to recognise in logs and
+// secret scanners.
+const apiTokenPrefix = "snp_"
+
+type APIToken struct {
+	ID       int
+	UserID   int
+	Name     string
+	Scopes   []string
+	Created  time.Time
+	Expires  time.Time
+	LastUsed time.Time
+}
+
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type APITokenModel struct {
+	DB *sql.DB
+}
+
+type APITokenModelInterface interface {
+	Insert(userID int, name string, scopes []string, expires time.Time) (string, error)
+	Authenticate(token string) (*APIToken, error)
+	ForUser(userID int) ([]*APIToken, error)
+	Revoke(id, userID int) error
+}
+
+// Insert creates a token and returns it in plain text. Only its hash is
+// stored, so this is the one chance to show it to the user.
+func (m *APITokenModel) Insert(userID int, name string, scopes []string, expires time.Time) (string, error) {
+	token, _, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	token = apiTokenPrefix + token
+	stmt := `INSERT INTO api_tokens (user_id,name,token_hash,scopes,created,expires)
+  VALUES(?,?,?,?,UTC_TIMESTAMP(),?)`
+	_, err = m.DB.Exec(stmt, userID, name, hashToken(token), strings.Join(scopes, ","), expires.UTC())
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Authenticate looks up a live token and records that it was used. Unknown
+// and expired tokens, and those of disabled accounts, all give
+// ErrInvalidCredentials.
+func (m *APITokenModel) Authenticate(token string) (*APIToken, error) {
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return nil, ErrInvalidCredentials
+	}
+	stmt := `SELECT ` + apiTokenColumns + ` FROM api_tokens t JOIN users u ON u.id = t.user_id
+  WHERE t.token_hash = ? AND t.expires > UTC_TIMESTAMP() AND NOT u.disabled`
+	t, err := scanAPIToken(m.DB.QueryRow(stmt, hashToken(token)))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	_, err = m.DB.Exec(`UPDATE api_tokens SET last_used = UTC_TIMESTAMP() WHERE id = ?`, t.ID)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (m *APITokenModel) ForUser(userID int) ([]*APIToken, error) {
+	stmt := `SELECT ` + apiTokenColumns + ` FROM api_tokens t WHERE t.user_id = ? ORDER BY t.id DESC`
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tokens := []*APIToken{}
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func (m *APITokenModel) Revoke(id, userID int) error {
+	result, err := m.DB.Exec(`DELETE FROM api_tokens WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+const apiTokenColumns = `t.id,t.user_id,t.name,t.scopes,t.created,t.expires,t.last_used`
+
+func scanAPIToken(row rowScanner) (*APIToken, error) {
+	t := &APIToken{}
+	var scopes string
+	var lastUsed sql.NullTime
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &scopes, &t.Created, &t.Expires, &lastUsed)
+	if err != nil {
+		return nil, err
+	}
+	if scopes != "" {
+		t.Scopes = strings.Split(scopes, ",")
+	}
+	t.LastUsed = lastUsed.Time
+	return t, nil
+}
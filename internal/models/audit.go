@@ -0,0 +1,163 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Audit target types.
+const (
+	AuditTargetUser     = "user"
+	AuditTargetSnippet  = "snippet"
+	AuditTargetTemplate = "template"
+)
+
+// AuditEntry records a security-relevant event: something a user did to
+// their own account, to another user or to content. The log is append-only;
+// entries are only ever removed by Prune once they are past retention.
+type AuditEntry struct {
+	ID         int
+	ActorID    int
+	ActorName  string
+	Action     string
+	TargetType string
+	TargetID   int
+	Details    map[string]string
+	IP         string
+	UserAgent  string
+	Created    time.Time
+}
+
+// AuditFilter narrows down Search. Zero fields match everything.
+type AuditFilter struct {
+	// UserID matches entries where the user is either the actor or the
+	// target.
+	UserID int
+	// Actions match whole actions, or families of them when they end in a
+	// dot, like "login.".
+	Actions []string
+	IP      string
+	Since   time.Time
+	Until   time.Time
+	Limit   int
+}
+
+type AuditModel struct {
+	DB *sql.DB
+}
+
+type AuditModelInterface interface {
+	Record(e *AuditEntry) error
+	ForUser(userID, limit int) ([]*AuditEntry, error)
+	Search(f AuditFilter) ([]*AuditEntry, error)
+	Prune(retention time.Duration) (int, error)
+}
+
+func (m *AuditModel) Record(e *AuditEntry) error {
+	var details []byte
+	if len(e.Details) > 0 {
+		var err error
+		details, err = json.Marshal(e.Details)
+		if err != nil {
+			return err
+		}
+	}
+	userAgent := userAgentColumn(e.UserAgent)
+	stmt := `INSERT INTO audit_log (actor_id,action,target_type,target_id,details,ip,user_agent,created)
+  VALUES(?,?,?,?,?,?,?,UTC_TIMESTAMP())`
+	_, err := m.DB.Exec(stmt, nullID(e.ActorID), e.Action, e.TargetType, e.TargetID, details, e.IP, userAgent)
+	return err
+}
+
+// auditSelect picks entries together with the actor's current name.
+const auditSelect = `SELECT a.id,IFNULL(a.actor_id,0),IFNULL(u.name,''),a.action,a.target_type,a.target_id,
+  a.details,a.ip,a.user_agent,a.created
+  FROM audit_log a LEFT JOIN users u ON u.id = a.actor_id`
+
+// ForUser returns the most recent entries the user was involved in, either
+// by acting or by being acted on.
+func (m *AuditModel) ForUser(userID, limit int) ([]*AuditEntry, error) {
+	return m.Search(AuditFilter{UserID: userID, Limit: limit})
+}
+
+// Search returns the most recent entries matching f.
+func (m *AuditModel) Search(f AuditFilter) ([]*AuditEntry, error) {
+	var where []string
+	var args []any
+	if f.UserID != 0 {
+		where = append(where, `(a.actor_id = ? OR (a.target_type = 'user' AND a.target_id = ?))`)
+		args = append(args, f.UserID, f.UserID)
+	}
+	if len(f.Actions) > 0 {
+		var or []string
+		for _, action := range f.Actions {
+			if strings.HasSuffix(action, ".") {
+				or = append(or, `a.action LIKE ?`)
+				args = append(args, strings.ReplaceAll(action, "_", `\_`)+"%")
+			} else {
+				or = append(or, `a.action = ?`)
+				args = append(args, action)
+			}
+		}
+		where = append(where, `(`+strings.Join(or, ` OR `)+`)`)
+	}
+	if f.IP != "" {
+		where = append(where, `a.ip = ?`)
+		args = append(args, f.IP)
+	}
+	if !f.Since.IsZero() {
+		where = append(where, `a.created >= ?`)
+		args = append(args, f.Since.UTC())
+	}
+	if !f.Until.IsZero() {
+		where = append(where, `a.created < ?`)
+		args = append(args, f.Until.UTC())
+	}
+	stmt := auditSelect
+	if len(where) > 0 {
+		stmt += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	limit := f.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	return m.query(stmt+` ORDER BY a.id DESC LIMIT ?`, append(args, limit)...)
+}
+
+// Prune deletes entries older than retention and reports how many went.
+func (m *AuditModel) Prune(retention time.Duration) (int, error) {
+	result, err := m.DB.Exec(`DELETE FROM audit_log WHERE created < DATE_SUB(UTC_TIMESTAMP(), INTERVAL ? SECOND)`,
+		int(retention.Seconds()))
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+func (m *AuditModel) query(stmt string, args ...any) ([]*AuditEntry, error) {
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []*AuditEntry{}
+	for rows.Next() {
+		e := &AuditEntry{}
+		var details []byte
+		err = rows.Scan(&e.ID, &e.ActorID, &e.ActorName, &e.Action, &e.TargetType, &e.TargetID,
+			&details, &e.IP, &e.UserAgent, &e.Created)
+		if err != nil {
+			return nil, err
+		}
+		if len(details) > 0 {
+			if err := json.Unmarshal(details, &e.Details); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
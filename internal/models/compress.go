@@ -0,0 +1,49 @@
+package models
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// Contents larger than compressThreshold bytes are gzipped before they are
+// written to the snippets table; content_encoding records which rows were.
+const compressThreshold = 8 << 10
+
+const encodingGzip = "gzip"
+
+func encodeContent(content string) ([]byte, string, error) {
+	if len(content) <= compressThreshold {
+		return []byte(content), "", nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(content)); err != nil {
+		return nil, "", err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), encodingGzip, nil
+}
+
+func decodeContent(stored []byte, encoding string) (string, error) {
+	switch encoding {
+	case "":
+		return string(stored), nil
+	case encodingGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(stored))
+		if err != nil {
+			return "", err
+		}
+		defer zr.Close()
+		content, err := io.ReadAll(zr)
+		if err != nil {
+			return "", err
+		}
+		return string(content), nil
+	default:
+		return "", fmt.Errorf("models: unknown content encoding %q", encoding)
+	}
+}
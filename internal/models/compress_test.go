@@ -0,0 +1,38 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"snipit.bikraj.net/internal/assert"
+)
+
+func TestContentEncoding(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		wantEncoding string
+	}{
+		{
+			name:         "Small content",
+			content:      "An old silent pond...",
+			wantEncoding: "",
+		},
+		{
+			name:         "Large content",
+			content:      strings.Repeat("goroutine 1 [running]:\n", 1000),
+			wantEncoding: encodingGzip,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored, encoding, err := encodeContent(tt.content)
+			assert.NilError(t, err)
+			assert.Equal(t, encoding, tt.wantEncoding)
+
+			content, err := decodeContent(stored, encoding)
+			assert.NilError(t, err)
+			assert.Equal(t, content, tt.content)
+		})
+	}
+}
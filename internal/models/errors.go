@@ -8,4 +8,22 @@ var(
   ErrInvalidCredentials = errors.New("modles: invalid credentials")
 
   ErrDuplicateEmail = errors.New("models: duplicate email")
+
+  ErrDuplicateUsername = errors.New("models: duplicate username")
+
+  ErrDuplicateIdentity = errors.New("models: identity already linked")
+
+  ErrAccountDisabled = errors.New("models: account disabled")
+
+  ErrDuplicateSlug = errors.New("models: duplicate organization slug")
+
+  ErrTokenReused = errors.New("models: remember token reused")
+
+  ErrInvalidInvite = errors.New("models: invalid invite code")
+
+  ErrDuplicateKey = errors.New("models: duplicate ssh key")
+
+  ErrDuplicateCredential = errors.New("models: duplicate passkey")
+
+  ErrSignCount = errors.New("models: passkey counter already moved on")
 )
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// IdentityModel links accounts to users of external OIDC providers, keyed
+// by the provider's name and its stable subject identifier.
+type IdentityModel struct {
+	DB *sql.DB
+}
+
+type IdentityModelInterface interface {
+	UserID(provider, subject string) (int, error)
+	Link(userID int, provider, subject string) error
+}
+
+func (m *IdentityModel) UserID(provider, subject string) (int, error) {
+	var userID int
+	stmt := `SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?`
+	err := m.DB.QueryRow(stmt, provider, subject).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+	return userID, nil
+}
+
+func (m *IdentityModel) Link(userID int, provider, subject string) error {
+	stmt := `INSERT INTO user_identities (user_id,provider,subject,created)
+  VALUES(?,?,?,UTC_TIMESTAMP())`
+	_, err := m.DB.Exec(stmt, userID, provider, subject)
+	if err != nil {
+		var mySQLError *mysql.MySQLError
+		if errors.As(err, &mySQLError) && mySQLError.Number == 1062 &&
+			strings.Contains(mySQLError.Message, "user_identities_uc_provider_subject") {
+			return ErrDuplicateIdentity
+		}
+		return err
+	}
+	return nil
+}
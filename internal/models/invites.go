@@ -0,0 +1,148 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Invite is a code that lets someone sign up while registration is
+// invite-only. It works until it has been used MaxUses times or expires.
+type Invite struct {
+	ID          int
+	Note        string
+	MaxUses     int
+	Uses        int
+	CreatedBy   int
+	CreatorName string
+	Created     time.Time
+	Expires     time.Time
+}
+
+// Live reports whether the invite can still be used.
+func (i *Invite) Live() bool {
+	return i.Uses < i.MaxUses && time.Now().Before(i.Expires)
+}
+
+type InviteModel struct {
+	DB *sql.DB
+}
+
+type InviteModelInterface interface {
+	Insert(createdBy int, note string, maxUses int, expires time.Time) (string, error)
+	All() ([]*Invite, error)
+	Redeem(code string) (int, error)
+	Release(id int) error
+	Revoke(id int) error
+}
+
+// inviteEncoding spells codes without padding or lowercase, so they survive
+// being read out or retyped.
+var inviteEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NormalizeInviteCode undoes the ways people mangle a code when copying it:
+// case, spaces and the dash in the middle.
+func NormalizeInviteCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
+
+// Insert creates an invite and returns its code, formatted as two groups of
+// eight characters. Only its hash is stored, so this is the one chance to
+// show it.
+func (m *InviteModel) Insert(createdBy int, note string, maxUses int, expires time.Time) (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := inviteEncoding.EncodeToString(b)
+	stmt := `INSERT INTO invite_codes (code_hash,note,max_uses,created_by,created,expires)
+  VALUES(?,?,?,?,UTC_TIMESTAMP(),?)`
+	_, err := m.DB.Exec(stmt, hashToken(code), note, maxUses, nullID(createdBy), expires.UTC())
+	if err != nil {
+		return "", err
+	}
+	return code[:8] + "-" + code[8:], nil
+}
+
+// All returns every invite, newest first.
+func (m *InviteModel) All() ([]*Invite, error) {
+	stmt := `SELECT i.id,i.note,i.max_uses,i.uses,IFNULL(i.created_by,0),IFNULL(u.name,''),i.created,i.expires
+  FROM invite_codes i LEFT JOIN users u ON u.id = i.created_by ORDER BY i.id DESC`
+	rows, err := m.DB.Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	invites := []*Invite{}
+	for rows.Next() {
+		i := &Invite{}
+		err = rows.Scan(&i.ID, &i.Note, &i.MaxUses, &i.Uses, &i.CreatedBy, &i.CreatorName, &i.Created, &i.Expires)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, i)
+	}
+	return invites, rows.Err()
+}
+
+// Redeem uses up one use of a live code and returns the invite's ID.
+// Unknown, expired and used-up codes all give ErrInvalidInvite. The check
+// and the count happen in one statement, so a code can't be used more times
+// than allowed by racing signups.
+func (m *InviteModel) Redeem(code string) (int, error) {
+	hash := hashToken(NormalizeInviteCode(code))
+	stmt := `UPDATE invite_codes SET uses = uses + 1
+  WHERE code_hash = ? AND uses < max_uses AND expires > UTC_TIMESTAMP()`
+	result, err := m.DB.Exec(stmt, hash)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, ErrInvalidInvite
+	}
+	var id int
+	err = m.DB.QueryRow(`SELECT id FROM invite_codes WHERE code_hash = ?`, hash).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidInvite
+		}
+		return 0, err
+	}
+	return id, nil
+}
+
+// Release gives back a use taken by Redeem, for when the signup it was
+// meant for didn't go through.
+func (m *InviteModel) Release(id int) error {
+	_, err := m.DB.Exec(`UPDATE invite_codes SET uses = uses - 1 WHERE id = ? AND uses > 0`, id)
+	return err
+}
+
+// Revoke deletes an invite so its code stops working.
+func (m *InviteModel) Revoke(id int) error {
+	result, err := m.DB.Exec(`DELETE FROM invite_codes WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
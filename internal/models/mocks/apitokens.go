@@ -0,0 +1,57 @@
+package mocks
+
+import (
+	"time"
+
+	"snipit.bikraj.net/internal/models"
+)
+
+// Tokens accepted by APITokenModel.Authenticate, all belonging to user 1.
+const (
+	MockReadToken  = "snp_read-token"
+	MockWriteToken = "snp_write-token"
+	MockAdminToken = "snp_admin-token"
+)
+
+var mockAPIToken = &models.APIToken{
+	ID:      1,
+	UserID:  1,
+	Name:    "CI",
+	Scopes:  []string{models.ScopeRead},
+	Created: time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC),
+	Expires: time.Now().Add(30 * 24 * time.Hour),
+}
+
+type APITokenModel struct{}
+
+func (m *APITokenModel) Insert(userID int, name string, scopes []string, expires time.Time) (string, error) {
+	return "snp_new-token", nil
+}
+
+func (m *APITokenModel) Authenticate(token string) (*models.APIToken, error) {
+	t := *mockAPIToken
+	switch token {
+	case MockReadToken:
+	case MockWriteToken:
+		t.Scopes = []string{models.ScopeRead, models.ScopeWrite}
+	case MockAdminToken:
+		t.Scopes = []string{models.ScopeRead, models.ScopeWrite, models.ScopeDelete}
+	default:
+		return nil, models.ErrInvalidCredentials
+	}
+	return &t, nil
+}
+
+func (m *APITokenModel) ForUser(userID int) ([]*models.APIToken, error) {
+	if userID == mockAPIToken.UserID {
+		return []*models.APIToken{mockAPIToken}, nil
+	}
+	return []*models.APIToken{}, nil
+}
+
+func (m *APITokenModel) Revoke(id, userID int) error {
+	if id == mockAPIToken.ID && userID == mockAPIToken.UserID {
+		return nil
+	}
+	return models.ErrNoRecord
+}
@@ -0,0 +1,74 @@
+package mocks
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"snipit.bikraj.net/internal/models"
+)
+
+// AuditModel keeps entries in memory so tests can check what was recorded.
+type AuditModel struct {
+	mu      sync.Mutex
+	Entries []*models.AuditEntry
+}
+
+func (m *AuditModel) Record(e *models.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	copy := *e
+	copy.ID = len(m.Entries) + 1
+	copy.Created = time.Now()
+	if u, ok := findMockUser(func(u *models.User) bool { return u.ID == e.ActorID }); ok {
+		copy.ActorName = u.Name
+	}
+	m.Entries = append(m.Entries, &copy)
+	return nil
+}
+
+func (m *AuditModel) ForUser(userID, limit int) ([]*models.AuditEntry, error) {
+	return m.Search(models.AuditFilter{UserID: userID, Limit: limit})
+}
+
+func (m *AuditModel) Search(f models.AuditFilter) ([]*models.AuditEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := []*models.AuditEntry{}
+	for i := len(m.Entries) - 1; i >= 0 && (f.Limit <= 0 || len(entries) < f.Limit); i-- {
+		e := m.Entries[i]
+		switch {
+		case f.UserID != 0 && e.ActorID != f.UserID && !(e.TargetType == models.AuditTargetUser && e.TargetID == f.UserID):
+		case len(f.Actions) > 0 && !matchesAction(e.Action, f.Actions):
+		case f.IP != "" && e.IP != f.IP:
+		case !f.Since.IsZero() && e.Created.Before(f.Since):
+		case !f.Until.IsZero() && !e.Created.Before(f.Until):
+		default:
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+func (m *AuditModel) Prune(retention time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.Entries[:0]
+	for _, e := range m.Entries {
+		if time.Since(e.Created) < retention {
+			kept = append(kept, e)
+		}
+	}
+	n := len(m.Entries) - len(kept)
+	m.Entries = kept
+	return n, nil
+}
+
+func matchesAction(action string, actions []string) bool {
+	for _, a := range actions {
+		if action == a || strings.HasSuffix(a, ".") && strings.HasPrefix(action, a) {
+			return true
+		}
+	}
+	return false
+}
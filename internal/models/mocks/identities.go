@@ -0,0 +1,38 @@
+package mocks
+
+import (
+	"sync"
+
+	"snipit.bikraj.net/internal/models"
+)
+
+// IdentityModel remembers links in memory so a test can log in through a
+// provider twice and see the first login's link.
+type IdentityModel struct {
+	mu    sync.Mutex
+	links map[string]int
+}
+
+func (m *IdentityModel) UserID(provider, subject string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	userID, ok := m.links[provider+"|"+subject]
+	if !ok {
+		return 0, models.ErrNoRecord
+	}
+	return userID, nil
+}
+
+func (m *IdentityModel) Link(userID int, provider, subject string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.links == nil {
+		m.links = make(map[string]int)
+	}
+	key := provider + "|" + subject
+	if _, ok := m.links[key]; ok {
+		return models.ErrDuplicateIdentity
+	}
+	m.links[key] = userID
+	return nil
+}
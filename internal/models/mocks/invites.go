@@ -0,0 +1,91 @@
+package mocks
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"snipit.bikraj.net/internal/models"
+)
+
+type invite struct {
+	models.Invite
+	code string
+}
+
+// InviteModel keeps invites in memory so that usage limits and expiry
+// behave as they do against the database.
+type InviteModel struct {
+	mu      sync.Mutex
+	invites []*invite
+}
+
+func (m *InviteModel) Insert(createdBy int, note string, maxUses int, expires time.Time) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := len(m.invites) + 1
+	code := fmt.Sprintf("MOCKCODE-%08d", id)
+	i := &invite{code: models.NormalizeInviteCode(code)}
+	i.ID, i.Note, i.MaxUses, i.CreatedBy = id, note, maxUses, createdBy
+	i.Created, i.Expires = time.Now(), expires
+	if u, ok := findMockUser(func(u *models.User) bool { return u.ID == createdBy }); ok {
+		i.CreatorName = u.Name
+	}
+	m.invites = append(m.invites, i)
+	return code, nil
+}
+
+func (m *InviteModel) All() ([]*models.Invite, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	invites := []*models.Invite{}
+	for k := len(m.invites) - 1; k >= 0; k-- {
+		if i := m.invites[k]; i != nil {
+			copy := i.Invite
+			invites = append(invites, &copy)
+		}
+	}
+	return invites, nil
+}
+
+func (m *InviteModel) Redeem(code string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code = models.NormalizeInviteCode(code)
+	for _, i := range m.invites {
+		if i != nil && i.code == code && i.Live() {
+			i.Uses++
+			return i.ID, nil
+		}
+	}
+	return 0, models.ErrInvalidInvite
+}
+
+func (m *InviteModel) Release(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id >= 1 && id <= len(m.invites) && m.invites[id-1] != nil && m.invites[id-1].Uses > 0 {
+		m.invites[id-1].Uses--
+	}
+	return nil
+}
+
+func (m *InviteModel) Revoke(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id < 1 || id > len(m.invites) || m.invites[id-1] == nil {
+		return models.ErrNoRecord
+	}
+	m.invites[id-1] = nil
+	return nil
+}
+
+// Uses reports how many times the invite has been redeemed.
+func (m *InviteModel) Uses(id int) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id < 1 || id > len(m.invites) || m.invites[id-1] == nil {
+		return 0
+	}
+	return m.invites[id-1].Uses
+}
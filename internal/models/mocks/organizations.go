@@ -0,0 +1,106 @@
+package mocks
+
+import (
+	"strings"
+	"time"
+
+	"snipit.bikraj.net/internal/models"
+)
+
+// The Acme organization has Alice as its owner and Heidi as a member.
+// "valid-invite-token" invites bob@example.com to join as a member.
+const MockInviteToken = "valid-invite-token"
+
+var mockOrg = &models.Organization{
+	ID:      1,
+	Slug:    "acme",
+	Name:    "Acme",
+	Created: time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC),
+}
+
+var mockOrgRoles = map[int]string{
+	1: models.OrgRoleOwner,
+	8: models.OrgRoleMember,
+}
+
+type OrganizationModel struct{}
+
+func (m *OrganizationModel) Insert(name, slug string, ownerID int) (int, error) {
+	if slug == mockOrg.Slug {
+		return 0, models.ErrDuplicateSlug
+	}
+	return 2, nil
+}
+
+func (m *OrganizationModel) GetBySlug(slug string) (*models.Organization, error) {
+	if slug == mockOrg.Slug {
+		o := *mockOrg
+		return &o, nil
+	}
+	return nil, models.ErrNoRecord
+}
+
+func (m *OrganizationModel) ForUser(userID int) ([]*models.Organization, error) {
+	role, ok := mockOrgRoles[userID]
+	if !ok {
+		return []*models.Organization{}, nil
+	}
+	o := *mockOrg
+	o.Role = role
+	return []*models.Organization{&o}, nil
+}
+
+func (m *OrganizationModel) Role(orgID, userID int) (string, error) {
+	role, ok := mockOrgRoles[userID]
+	if orgID != mockOrg.ID || !ok {
+		return "", models.ErrNoRecord
+	}
+	return role, nil
+}
+
+func (m *OrganizationModel) Members(orgID int) ([]*models.OrgMember, error) {
+	if orgID != mockOrg.ID {
+		return []*models.OrgMember{}, nil
+	}
+	return []*models.OrgMember{
+		{UserID: 1, Name: "Alice Jones", Email: "alice@example.com", Role: models.OrgRoleOwner},
+		{UserID: 8, Name: "Heidi Clark", Email: "heidi@example.com", Role: models.OrgRoleMember},
+	}, nil
+}
+
+func (m *OrganizationModel) RemoveMember(orgID, userID int) error {
+	if _, ok := mockOrgRoles[userID]; orgID == mockOrg.ID && ok {
+		return nil
+	}
+	return models.ErrNoRecord
+}
+
+func (m *OrganizationModel) Invite(orgID int, email, role string, invitedBy int, ttl time.Duration) (string, error) {
+	return MockInviteToken, nil
+}
+
+func (m *OrganizationModel) Invitation(orgID int, token string) (*models.OrgInvitation, error) {
+	if orgID != mockOrg.ID || token != MockInviteToken {
+		return nil, models.ErrNoRecord
+	}
+	return &models.OrgInvitation{
+		ID:        1,
+		OrgID:     mockOrg.ID,
+		Email:     "bob@example.com",
+		Role:      models.OrgRoleMember,
+		InvitedBy: 1,
+		Expires:   time.Now().Add(time.Hour),
+	}, nil
+}
+
+func (m *OrganizationModel) AcceptInvitation(orgID int, token string, userID int) error {
+	inv, err := m.Invitation(orgID, token)
+	if err != nil {
+		return err
+	}
+	u, ok := findMockUser(func(u *models.User) bool { return u.ID == userID })
+	if !ok || !strings.EqualFold(u.Email, inv.Email) {
+		return models.ErrNoRecord
+	}
+	return nil
+}
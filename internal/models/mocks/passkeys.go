@@ -0,0 +1,87 @@
+package mocks
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"snipit.bikraj.net/internal/models"
+)
+
+// PasskeyModel keeps passkeys in memory so tests can register one with a
+// software authenticator and then sign in with it.
+type PasskeyModel struct {
+	mu       sync.Mutex
+	passkeys []*models.Passkey
+}
+
+func (m *PasskeyModel) Insert(userID int, name string, credentialID, publicKey []byte, signCount uint32) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.passkeys {
+		if p != nil && bytes.Equal(p.CredentialID, credentialID) {
+			return 0, models.ErrDuplicateCredential
+		}
+	}
+	p := &models.Passkey{
+		ID:           len(m.passkeys) + 1,
+		UserID:       userID,
+		Name:         name,
+		CredentialID: credentialID,
+		PublicKey:    publicKey,
+		SignCount:    signCount,
+		Created:      time.Now(),
+	}
+	m.passkeys = append(m.passkeys, p)
+	return p.ID, nil
+}
+
+func (m *PasskeyModel) Get(credentialID []byte) (*models.Passkey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.passkeys {
+		if p != nil && bytes.Equal(p.CredentialID, credentialID) {
+			copy := *p
+			return &copy, nil
+		}
+	}
+	return nil, models.ErrNoRecord
+}
+
+func (m *PasskeyModel) ForUser(userID int) ([]*models.Passkey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	passkeys := []*models.Passkey{}
+	for i := len(m.passkeys) - 1; i >= 0; i-- {
+		if p := m.passkeys[i]; p != nil && p.UserID == userID {
+			copy := *p
+			passkeys = append(passkeys, &copy)
+		}
+	}
+	return passkeys, nil
+}
+
+func (m *PasskeyModel) UpdateSignCount(id int, signCount uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id < 1 || id > len(m.passkeys) || m.passkeys[id-1] == nil {
+		return models.ErrSignCount
+	}
+	p := m.passkeys[id-1]
+	if signCount != 0 && signCount <= p.SignCount {
+		return models.ErrSignCount
+	}
+	p.SignCount = signCount
+	p.LastUsed = time.Now()
+	return nil
+}
+
+func (m *PasskeyModel) Delete(id, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id < 1 || id > len(m.passkeys) || m.passkeys[id-1] == nil || m.passkeys[id-1].UserID != userID {
+		return models.ErrNoRecord
+	}
+	m.passkeys[id-1] = nil
+	return nil
+}
@@ -0,0 +1,24 @@
+package mocks
+
+import (
+	"time"
+
+	"snipit.bikraj.net/internal/models"
+)
+
+type PasswordResetModel struct{}
+
+func (m *PasswordResetModel) New(userID int, ttl time.Duration) (string, error) {
+	return "valid-reset-token", nil
+}
+
+func (m *PasswordResetModel) UserID(token string) (int, error) {
+	if token == "valid-reset-token" {
+		return 1, nil
+	}
+	return 0, models.ErrNoRecord
+}
+
+func (m *PasswordResetModel) Consume(token string) (int, error) {
+	return m.UserID(token)
+}
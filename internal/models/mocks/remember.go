@@ -0,0 +1,108 @@
+package mocks
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"snipit.bikraj.net/internal/models"
+)
+
+type rememberToken struct {
+	validator string
+	family    string
+	userID    int
+	rotated   bool
+}
+
+// RememberTokenModel keeps tokens in memory so that rotation and replay
+// detection behave as they do against the database.
+type RememberTokenModel struct {
+	mu     sync.Mutex
+	tokens map[string]*rememberToken
+	next   int
+}
+
+func (m *RememberTokenModel) insert(userID int, family string) string {
+	if m.tokens == nil {
+		m.tokens = make(map[string]*rememberToken)
+	}
+	m.next++
+	selector := fmt.Sprintf("selector-%d", m.next)
+	validator := fmt.Sprintf("validator-%d", m.next)
+	m.tokens[selector] = &rememberToken{validator: validator, family: family, userID: userID}
+	return selector + "." + validator
+}
+
+func (m *RememberTokenModel) New(userID int, ttl time.Duration) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.insert(userID, fmt.Sprintf("family-%d", m.next+1)), nil
+}
+
+func (m *RememberTokenModel) Rotate(token string, ttl time.Duration) (int, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	selector, validator, _ := strings.Cut(token, ".")
+	t, ok := m.tokens[selector]
+	if !ok || t.validator != validator {
+		return 0, "", models.ErrInvalidCredentials
+	}
+	if u, ok := findMockUser(func(u *models.User) bool { return u.ID == t.userID }); !ok || u.Disabled {
+		return 0, "", models.ErrInvalidCredentials
+	}
+	if t.rotated {
+		m.revokeFamily(t.family)
+		return t.userID, "", models.ErrTokenReused
+	}
+	t.rotated = true
+	return t.userID, m.insert(t.userID, t.family), nil
+}
+
+func (m *RememberTokenModel) revokeFamily(family string) {
+	for selector, t := range m.tokens {
+		if t.family == family {
+			delete(m.tokens, selector)
+		}
+	}
+}
+
+func (m *RememberTokenModel) Revoke(token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	selector, _, _ := strings.Cut(token, ".")
+	if t, ok := m.tokens[selector]; ok {
+		m.revokeFamily(t.family)
+	}
+	return nil
+}
+
+func (m *RememberTokenModel) RevokeAll(userID int, exceptToken string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	selector, _, _ := strings.Cut(exceptToken, ".")
+	keep := ""
+	if t, ok := m.tokens[selector]; ok {
+		keep = t.family
+	}
+	for s, t := range m.tokens {
+		if t.userID == userID && t.family != keep {
+			delete(m.tokens, s)
+		}
+	}
+	return nil
+}
+
+// Count reports how many tokens, rotated or not, the user has.
+func (m *RememberTokenModel) Count(userID int) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, t := range m.tokens {
+		if t.userID == userID {
+			n++
+		}
+	}
+	return n
+}
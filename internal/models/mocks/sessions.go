@@ -0,0 +1,94 @@
+package mocks
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"snipit.bikraj.net/internal/models"
+)
+
+// UserSessionModel keeps sessions in memory, since logging in and the
+// authenticate middleware depend on seeing each other's writes.
+type UserSessionModel struct {
+	mu       sync.Mutex
+	sessions map[string]*models.UserSession
+	next     int
+}
+
+func (m *UserSessionModel) Create(userID int, ip, userAgent string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sessions == nil {
+		m.sessions = make(map[string]*models.UserSession)
+	}
+	m.next++
+	id := fmt.Sprintf("session-%d", m.next)
+	m.sessions[id] = &models.UserSession{
+		ID:        id,
+		UserID:    userID,
+		Created:   time.Now(),
+		LastSeen:  time.Now(),
+		IP:        ip,
+		UserAgent: userAgent,
+	}
+	return id, nil
+}
+
+func (m *UserSessionModel) Get(id string) (*models.UserSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+	copy := *s
+	return &copy, nil
+}
+
+func (m *UserSessionModel) Touch(id, ip string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.sessions[id]; ok {
+		s.LastSeen = time.Now()
+		s.IP = ip
+	}
+	return nil
+}
+
+func (m *UserSessionModel) ForUser(userID int) ([]*models.UserSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sessions := []*models.UserSession{}
+	for _, s := range m.sessions {
+		if s.UserID == userID {
+			copy := *s
+			sessions = append(sessions, &copy)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	return sessions, nil
+}
+
+func (m *UserSessionModel) Revoke(id string, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok || s.UserID != userID {
+		return models.ErrNoRecord
+	}
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *UserSessionModel) RevokeAll(userID int, exceptID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, s := range m.sessions {
+		if s.UserID == userID && id != exceptID {
+			delete(m.sessions, id)
+		}
+	}
+	return nil
+}
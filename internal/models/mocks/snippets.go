@@ -6,15 +6,45 @@ import (
 )
 
 var mockSnippet = &models.Snippet{ID: 1,
-	Title: "An old silent pond",
-  Content: "An old silent pond...", 
-  Created: time.Now(),
-	Expires: time.Now(),
+	UserID:     1,
+	Title:      "An old silent pond",
+	Content:    "An old silent pond...",
+	Visibility: models.VisibilityPublic,
+	Created:    time.Now(),
+	Expires:    time.Now(),
 }
 
-type SnippetModel struct{}
+// mockOrgSnippet belongs to the Acme organization and only its members
+// may read it.
+var mockOrgSnippet = &models.Snippet{ID: 3,
+	UserID:     8,
+	OrgID:      1,
+	Title:      "Acme deploy notes",
+	Content:    "Run make deploy",
+	Visibility: models.VisibilityOrganization,
+	Created:    time.Now(),
+	Expires:    time.Now(),
+}
+
+// mockPrivateOrgSnippet was filed under Acme and then made private, so
+// only its owner may see it.
+var mockPrivateOrgSnippet = &models.Snippet{ID: 4,
+	UserID:     8,
+	OrgID:      1,
+	Title:      "Heidi's salary notes",
+	Content:    "Ask for more",
+	Visibility: models.VisibilityPrivate,
+	Created:    time.Now(),
+	Expires:    time.Now(),
+}
+
+type SnippetModel struct {
+	// Disowned records the policy each deleted user's snippets were
+	// disowned with.
+	Disowned map[int]string
+}
 
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
+func (m *SnippetModel) Insert(userID, orgID int, title, content, language, visibility string, expires int) (int, error) {
 	return 2, nil
 }
 
@@ -22,6 +52,8 @@ func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
 	switch id {
 	case 1:
 		return mockSnippet, nil
+	case 3:
+		return mockOrgSnippet, nil
 	default:
 		return nil, models.ErrNoRecord
 	}
@@ -30,3 +62,78 @@ func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
 func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
 	return []*models.Snippet{mockSnippet}, nil
 }
+
+func (m *SnippetModel) FindDuplicate(userID int, content string) (*models.Snippet, error) {
+	if userID == mockSnippet.UserID && models.ContentHash(content) == models.ContentHash(mockSnippet.Content) {
+		return mockSnippet, nil
+	}
+	return nil, models.ErrNoRecord
+}
+
+func (m *SnippetModel) Similar(content string, limit int) ([]*models.Snippet, error) {
+	if models.ContentHash(content) == models.ContentHash(mockSnippet.Content) {
+		return []*models.Snippet{mockSnippet}, nil
+	}
+	return []*models.Snippet{}, nil
+}
+
+func (m *SnippetModel) Delete(id, userID int) error {
+	if id == mockSnippet.ID && userID == mockSnippet.UserID {
+		return nil
+	}
+	return models.ErrNoRecord
+}
+
+func (m *SnippetModel) Recent(limit int) ([]*models.Snippet, error) {
+	return []*models.Snippet{mockSnippet}, nil
+}
+
+func (m *SnippetModel) DeleteAny(id int) error {
+	if id == mockSnippet.ID {
+		return nil
+	}
+	return models.ErrNoRecord
+}
+
+func (m *SnippetModel) ForOrg(orgID, limit int) ([]*models.Snippet, error) {
+	if orgID == mockOrgSnippet.OrgID {
+		return []*models.Snippet{mockPrivateOrgSnippet, mockOrgSnippet}, nil
+	}
+	return []*models.Snippet{}, nil
+}
+
+func (m *SnippetModel) ForUser(userID int) ([]*models.Snippet, error) {
+	if userID == mockSnippet.UserID {
+		return []*models.Snippet{mockSnippet}, nil
+	}
+	return []*models.Snippet{}, nil
+}
+
+func (m *SnippetModel) Disown(userID int, policy string, orgID int) error {
+	if m.Disowned == nil {
+		m.Disowned = map[int]string{}
+	}
+	m.Disowned[userID] = policy
+	return nil
+}
+
+func (m *SnippetModel) PublicForUser(userID, limit, offset int) ([]*models.Snippet, error) {
+	if userID == mockSnippet.UserID && offset == 0 {
+		return []*models.Snippet{mockSnippet}, nil
+	}
+	return []*models.Snippet{}, nil
+}
+
+func (m *SnippetModel) PageForUser(userID, limit, offset int) ([]*models.Snippet, error) {
+	if userID == mockSnippet.UserID && offset == 0 && limit > 0 {
+		return []*models.Snippet{mockSnippet}, nil
+	}
+	return []*models.Snippet{}, nil
+}
+
+func (m *SnippetModel) Update(id, userID int, title, content, language, visibility string, expires int) error {
+	if id == mockSnippet.ID && userID == mockSnippet.UserID {
+		return nil
+	}
+	return models.ErrNoRecord
+}
@@ -0,0 +1,75 @@
+package mocks
+
+import (
+	"sync"
+	"time"
+
+	"snipit.bikraj.net/internal/models"
+)
+
+// SSHKeyModel keeps keys in memory so tests can register one and then log
+// in to the paste server with it.
+type SSHKeyModel struct {
+	mu   sync.Mutex
+	keys []*models.SSHKey
+}
+
+func (m *SSHKeyModel) Insert(userID int, name, fingerprint, publicKey string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range m.keys {
+		if k != nil && k.Fingerprint == fingerprint {
+			return 0, models.ErrDuplicateKey
+		}
+	}
+	k := &models.SSHKey{
+		ID:          len(m.keys) + 1,
+		UserID:      userID,
+		Name:        name,
+		Fingerprint: fingerprint,
+		PublicKey:   publicKey,
+		Created:     time.Now(),
+	}
+	m.keys = append(m.keys, k)
+	return k.ID, nil
+}
+
+func (m *SSHKeyModel) ForUser(userID int) ([]*models.SSHKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := []*models.SSHKey{}
+	for i := len(m.keys) - 1; i >= 0; i-- {
+		if k := m.keys[i]; k != nil && k.UserID == userID {
+			copy := *k
+			keys = append(keys, &copy)
+		}
+	}
+	return keys, nil
+}
+
+func (m *SSHKeyModel) Delete(id, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id < 1 || id > len(m.keys) || m.keys[id-1] == nil || m.keys[id-1].UserID != userID {
+		return models.ErrNoRecord
+	}
+	m.keys[id-1] = nil
+	return nil
+}
+
+func (m *SSHKeyModel) Authenticate(fingerprint string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range m.keys {
+		if k == nil || k.Fingerprint != fingerprint {
+			continue
+		}
+		u, ok := findMockUser(func(u *models.User) bool { return u.ID == k.UserID })
+		if !ok || !u.Verified || u.Disabled {
+			break
+		}
+		k.LastUsed = time.Now()
+		return k.UserID, nil
+	}
+	return 0, models.ErrInvalidCredentials
+}
@@ -0,0 +1,44 @@
+package mocks
+
+import (
+	"time"
+
+	"snipit.bikraj.net/internal/models"
+)
+
+var mockTemplate = &models.SnippetTemplate{
+	ID:           1,
+	Name:         "Stack trace",
+	TitlePattern: "Crash report {date}",
+	Language:     "text",
+	Content:      "Steps to reproduce:",
+	Expires:      7,
+	Visibility:   models.VisibilityUnlisted,
+	Created:      time.Now(),
+}
+
+type SnippetTemplateModel struct{}
+
+func (m *SnippetTemplateModel) Insert(userID int, name, titlePattern, language, content, visibility string, expires int) (int, error) {
+	return 2, nil
+}
+
+func (m *SnippetTemplateModel) Get(id int) (*models.SnippetTemplate, error) {
+	switch id {
+	case 1:
+		return mockTemplate, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+func (m *SnippetTemplateModel) ForUser(userID int) ([]*models.SnippetTemplate, error) {
+	return []*models.SnippetTemplate{mockTemplate}, nil
+}
+
+func (m *SnippetTemplateModel) Delete(id, userID int) error {
+	if id == mockTemplate.ID && userID == mockTemplate.UserID {
+		return nil
+	}
+	return models.ErrNoRecord
+}
@@ -0,0 +1,38 @@
+package mocks
+
+import (
+	"snipit.bikraj.net/internal/models"
+)
+
+// MockTOTPSecret is the secret of the mock user with 2FA turned on.
+const MockTOTPSecret = "JBSWY3DPEHPK3PXP"
+
+type TwoFactorModel struct{}
+
+func (m *TwoFactorModel) Secret(userID int) (string, error) {
+	switch userID {
+	case 4:
+		return MockTOTPSecret, nil
+	default:
+		return "", nil
+	}
+}
+
+func (m *TwoFactorModel) Enable(userID int, secret string, recoveryCodes []string) error {
+	return nil
+}
+
+func (m *TwoFactorModel) Disable(userID int) error {
+	return nil
+}
+
+func (m *TwoFactorModel) RecordStep(userID int, step int64) (bool, error) {
+	return true, nil
+}
+
+func (m *TwoFactorModel) UseRecoveryCode(userID int, code string) error {
+	if userID == 4 && code == "aaaa-bbbb" {
+		return nil
+	}
+	return models.ErrInvalidCredentials
+}
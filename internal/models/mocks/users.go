@@ -1,30 +1,64 @@
 package mocks
 
-import "snipit.bikraj.net/internal/models"
+import (
+	"time"
+
+	"snipit.bikraj.net/internal/models"
+)
+
+// mockUsers all have the password "pa$$word".
+var mockUsers = []models.User{
+	{ID: 1, Name: "Alice Jones", Username: "alice", Email: "alice@example.com", Verified: true, Role: models.RoleUser, Bio: "Writes Go at night."},
+	{ID: 2, Name: "Bob Smith", Username: "bob", Email: "bob@example.com", Role: models.RoleUser},
+	{ID: 4, Name: "Dave Brown", Username: "dave", Email: "dave@example.com", Verified: true, Role: models.RoleUser},
+	{ID: 5, Name: "Erin Admin", Username: "erin", Email: "admin@example.com", Verified: true, Role: models.RoleAdmin},
+	{ID: 6, Name: "Frank Moderator", Username: "frank", Email: "mod@example.com", Verified: true, Role: models.RoleModerator},
+	{ID: 7, Name: "Grace Disabled", Username: "grace", Email: "disabled@example.com", Verified: true, Role: models.RoleUser, Disabled: true},
+	{ID: 8, Name: "Heidi Clark", Username: "heidi", Email: "heidi@example.com", Verified: true, Role: models.RoleUser},
+}
+
+func findMockUser(match func(u *models.User) bool) (*models.User, bool) {
+	for _, u := range mockUsers {
+		if match(&u) {
+			u.Created = time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC)
+			return &u, true
+		}
+	}
+	return nil, false
+}
 
 type UserModel struct{}
 
-func (m *UserModel) Insert(name, email, password string) error {
-	switch email {
-	case "dupe@example.com":
-		return models.ErrDuplicateEmail
+func (m *UserModel) Insert(name, username, email, password string) (int, error) {
+	switch {
+	case email == "dupe@example.com":
+		return 0, models.ErrDuplicateEmail
+	case username == "taken":
+		return 0, models.ErrDuplicateUsername
 	default:
-		return nil
+		return 3, nil
 	}
 }
 func (m *UserModel) Authenticate(email, password string) (int, error) {
-	if email == "alice@example.com" && password == "pa$$word" {
-		return 1, nil
+	u, ok := findMockUser(func(u *models.User) bool { return u.Email == email })
+	if !ok || password != "pa$$word" {
+		return 0, models.ErrInvalidCredentials
 	}
-	return 0, models.ErrInvalidCredentials
+	if u.Disabled {
+		return 0, models.ErrAccountDisabled
+	}
+	return u.ID, nil
 }
 func (m *UserModel) Exists(id int) (bool, error) {
-	switch id {
-	case 1:
-		return true, nil
-	default:
-		return false, nil
+	_, ok := findMockUser(func(u *models.User) bool { return u.ID == id })
+	return ok, nil
+}
+func (m *UserModel) Get(id int) (*models.User, error) {
+	u, ok := findMockUser(func(u *models.User) bool { return u.ID == id })
+	if !ok {
+		return nil, models.ErrNoRecord
 	}
+	return u, nil
 }
 func (m *UserModel) ChangePassword(id int, oldPassword, newPassword string) (bool, error) {
 	if id == 1 {
@@ -35,3 +69,77 @@ func (m *UserModel) ChangePassword(id int, oldPassword, newPassword string) (boo
 	}
 	return false,models.ErrNoRecord
 }
+func (m *UserModel) SetVerified(id int) error {
+	switch id {
+	case 1, 2, 3:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+func (m *UserModel) GetByEmail(email string) (*models.User, error) {
+	u, ok := findMockUser(func(u *models.User) bool { return u.Email == email })
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+	return u, nil
+}
+func (m *UserModel) SetPassword(id int, password string) error {
+	switch id {
+	case 1, 2:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+func (m *UserModel) List() ([]*models.User, error) {
+	users := []*models.User{}
+	for i := range mockUsers {
+		u := mockUsers[i]
+		users = append(users, &u)
+	}
+	return users, nil
+}
+func (m *UserModel) SetRole(id int, role string) error {
+	return nil
+}
+func (m *UserModel) SetDisabled(id int, disabled bool) error {
+	return nil
+}
+
+func (m *UserModel) SoftDelete(id int, grace time.Duration) error {
+	if _, ok := findMockUser(func(u *models.User) bool { return u.ID == id }); !ok {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *UserModel) Purge() (int, error) {
+	return 0, nil
+}
+
+func (m *UserModel) GetByUsername(username string) (*models.User, error) {
+	u, ok := findMockUser(func(u *models.User) bool { return u.Username == username })
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+	return u, nil
+}
+
+func (m *UserModel) SetProfile(id int, username, bio string) error {
+	if u, ok := findMockUser(func(u *models.User) bool { return u.Username == username }); ok && u.ID != id {
+		return models.ErrDuplicateUsername
+	}
+	return nil
+}
+
+func (m *UserModel) SetName(id int, name string) error {
+	return nil
+}
+
+func (m *UserModel) ChangeEmail(id int, email string) error {
+	if _, ok := findMockUser(func(u *models.User) bool { return u.Email == email }); ok {
+		return models.ErrDuplicateEmail
+	}
+	return nil
+}
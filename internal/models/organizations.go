@@ -0,0 +1,240 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Roles a member can hold in an organization.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleMember = "member"
+)
+
+type Organization struct {
+	ID      int
+	Slug    string
+	Name    string
+	Created time.Time
+	// Role is the requesting user's role, when the organization was loaded
+	// through ForUser.
+	Role string
+}
+
+type OrgMember struct {
+	UserID int
+	Name   string
+	Email  string
+	Role   string
+	Joined time.Time
+}
+
+type OrgInvitation struct {
+	ID        int
+	OrgID     int
+	Email     string
+	Role      string
+	InvitedBy int
+	Expires   time.Time
+}
+
+type OrganizationModel struct {
+	DB *sql.DB
+}
+
+type OrganizationModelInterface interface {
+	Insert(name, slug string, ownerID int) (int, error)
+	GetBySlug(slug string) (*Organization, error)
+	ForUser(userID int) ([]*Organization, error)
+	Role(orgID, userID int) (string, error)
+	Members(orgID int) ([]*OrgMember, error)
+	RemoveMember(orgID, userID int) error
+	Invite(orgID int, email, role string, invitedBy int, ttl time.Duration) (string, error)
+	Invitation(orgID int, token string) (*OrgInvitation, error)
+	AcceptInvitation(orgID int, token string, userID int) error
+}
+
+// Insert creates an organization with ownerID as its first owner.
+func (m *OrganizationModel) Insert(name, slug string, ownerID int) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`INSERT INTO organizations (slug,name,created) VALUES(?,?,UTC_TIMESTAMP())`, slug, name)
+	if err != nil {
+		var mySQLError *mysql.MySQLError
+		if errors.As(err, &mySQLError) && mySQLError.Number == 1062 &&
+			strings.Contains(mySQLError.Message, "organizations_uc_slug") {
+			return 0, ErrDuplicateSlug
+		}
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	stmt := `INSERT INTO org_members (org_id,user_id,role,created) VALUES(?,?,?,UTC_TIMESTAMP())`
+	_, err = tx.Exec(stmt, id, ownerID, OrgRoleOwner)
+	if err != nil {
+		return 0, err
+	}
+	return int(id), tx.Commit()
+}
+
+func (m *OrganizationModel) GetBySlug(slug string) (*Organization, error) {
+	o := &Organization{}
+	stmt := `SELECT id,slug,name,created FROM organizations WHERE slug = ?`
+	err := m.DB.QueryRow(stmt, slug).Scan(&o.ID, &o.Slug, &o.Name, &o.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	return o, nil
+}
+
+// ForUser lists the organizations the user belongs to, by name.
+func (m *OrganizationModel) ForUser(userID int) ([]*Organization, error) {
+	stmt := `SELECT o.id,o.slug,o.name,o.created,m.role FROM organizations o
+  JOIN org_members m ON m.org_id = o.id WHERE m.user_id = ? ORDER BY o.name`
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	orgs := []*Organization{}
+	for rows.Next() {
+		o := &Organization{}
+		err = rows.Scan(&o.ID, &o.Slug, &o.Name, &o.Created, &o.Role)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, o)
+	}
+	return orgs, rows.Err()
+}
+
+// Role returns the user's role in the organization, or ErrNoRecord if they
+// aren't a member.
+func (m *OrganizationModel) Role(orgID, userID int) (string, error) {
+	var role string
+	stmt := `SELECT role FROM org_members WHERE org_id = ? AND user_id = ?`
+	err := m.DB.QueryRow(stmt, orgID, userID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNoRecord
+		}
+		return "", err
+	}
+	return role, nil
+}
+
+// Members lists the organization's members, owners first.
+func (m *OrganizationModel) Members(orgID int) ([]*OrgMember, error) {
+	stmt := `SELECT u.id,u.name,u.email,m.role,m.created FROM org_members m
+  JOIN users u ON u.id = m.user_id WHERE m.org_id = ?
+  ORDER BY m.role = 'owner' DESC, u.name`
+	rows, err := m.DB.Query(stmt, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	members := []*OrgMember{}
+	for rows.Next() {
+		mem := &OrgMember{}
+		err = rows.Scan(&mem.UserID, &mem.Name, &mem.Email, &mem.Role, &mem.Joined)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, mem)
+	}
+	return members, rows.Err()
+}
+
+func (m *OrganizationModel) RemoveMember(orgID, userID int) error {
+	result, err := m.DB.Exec(`DELETE FROM org_members WHERE org_id = ? AND user_id = ?`, orgID, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+// Invite records an invitation for email to join with role and returns the
+// token for the emailed link. Only its hash is stored.
+func (m *OrganizationModel) Invite(orgID int, email, role string, invitedBy int, ttl time.Duration) (string, error) {
+	token, hash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	stmt := `INSERT INTO org_invitations (org_id,email,role,token_hash,invited_by,created,expires)
+  VALUES(?,?,?,?,?,UTC_TIMESTAMP(),DATE_ADD(UTC_TIMESTAMP(),INTERVAL ? SECOND))`
+	_, err = m.DB.Exec(stmt, orgID, email, role, hash, invitedBy, int(ttl.Seconds()))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+const orgInvitationColumns = `id,org_id,email,role,invited_by,expires`
+
+// Invitation looks up a live invitation to the organization.
+func (m *OrganizationModel) Invitation(orgID int, token string) (*OrgInvitation, error) {
+	inv := &OrgInvitation{}
+	stmt := `SELECT ` + orgInvitationColumns + ` FROM org_invitations
+  WHERE org_id = ? AND token_hash = ? AND expires > UTC_TIMESTAMP()`
+	err := m.DB.QueryRow(stmt, orgID, hashToken(token)).Scan(
+		&inv.ID, &inv.OrgID, &inv.Email, &inv.Role, &inv.InvitedBy, &inv.Expires)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	return inv, nil
+}
+
+// AcceptInvitation makes userID a member with the invited role and uses up
+// the invitation. Existing members keep their current role.
+func (m *OrganizationModel) AcceptInvitation(orgID int, token string, userID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int
+	var role string
+	stmt := `SELECT id,role FROM org_invitations
+  WHERE org_id = ? AND token_hash = ? AND expires > UTC_TIMESTAMP() FOR UPDATE`
+	err = tx.QueryRow(stmt, orgID, hashToken(token)).Scan(&id, &role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+	stmt = `INSERT IGNORE INTO org_members (org_id,user_id,role,created) VALUES(?,?,?,UTC_TIMESTAMP())`
+	_, err = tx.Exec(stmt, orgID, userID, role)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM org_invitations WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Passkey is a WebAuthn credential a user signs in with. The ceremony is
+// checked by the caller; the model stores the result and the signature
+// counter that goes with it.
+type Passkey struct {
+	ID           int
+	UserID       int
+	Name         string
+	CredentialID []byte
+	PublicKey    []byte
+	SignCount    uint32
+	Created      time.Time
+	LastUsed     time.Time
+}
+
+type PasskeyModel struct {
+	DB *sql.DB
+}
+
+type PasskeyModelInterface interface {
+	Insert(userID int, name string, credentialID, publicKey []byte, signCount uint32) (int, error)
+	Get(credentialID []byte) (*Passkey, error)
+	ForUser(userID int) ([]*Passkey, error)
+	UpdateSignCount(id int, signCount uint32) error
+	Delete(id, userID int) error
+}
+
+// Insert stores a passkey, giving ErrDuplicateCredential if the credential
+// is already registered.
+func (m *PasskeyModel) Insert(userID int, name string, credentialID, publicKey []byte, signCount uint32) (int, error) {
+	stmt := `INSERT INTO passkeys (user_id,name,credential_id,public_key,sign_count,created)
+  VALUES(?,?,?,?,?,UTC_TIMESTAMP())`
+	result, err := m.DB.Exec(stmt, userID, name, credentialID, publicKey, signCount)
+	if err != nil {
+		var mySQLError *mysql.MySQLError
+		if errors.As(err, &mySQLError) && mySQLError.Number == 1062 &&
+			strings.Contains(mySQLError.Message, "passkeys_uc_credential_id") {
+			return 0, ErrDuplicateCredential
+		}
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+const passkeyColumns = `id,user_id,name,credential_id,public_key,sign_count,created,last_used`
+
+func scanPasskey(row rowScanner) (*Passkey, error) {
+	p := &Passkey{}
+	var lastUsed sql.NullTime
+	err := row.Scan(&p.ID, &p.UserID, &p.Name, &p.CredentialID, &p.PublicKey, &p.SignCount, &p.Created, &lastUsed)
+	if err != nil {
+		return nil, err
+	}
+	p.LastUsed = lastUsed.Time
+	return p, nil
+}
+
+// Get finds the passkey with credentialID, which is how an authenticator
+// identifies itself when signing in.
+func (m *PasskeyModel) Get(credentialID []byte) (*Passkey, error) {
+	stmt := `SELECT ` + passkeyColumns + ` FROM passkeys WHERE credential_id = ?`
+	p, err := scanPasskey(m.DB.QueryRow(stmt, credentialID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+func (m *PasskeyModel) ForUser(userID int) ([]*Passkey, error) {
+	stmt := `SELECT ` + passkeyColumns + ` FROM passkeys WHERE user_id = ? ORDER BY id DESC`
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	passkeys := []*Passkey{}
+	for rows.Next() {
+		p, err := scanPasskey(rows)
+		if err != nil {
+			return nil, err
+		}
+		passkeys = append(passkeys, p)
+	}
+	return passkeys, rows.Err()
+}
+
+// UpdateSignCount records a login with the passkey and the counter the
+// authenticator reported for it. The counter must still be ahead of the
+// stored one, so of two logins racing with copies of the same key only one
+// gets through; the other gets ErrSignCount. Authenticators without a
+// counter report zero and always pass.
+func (m *PasskeyModel) UpdateSignCount(id int, signCount uint32) error {
+	stmt := `UPDATE passkeys SET sign_count = ?, last_used = UTC_TIMESTAMP()
+  WHERE id = ? AND (sign_count < ? OR ? = 0)`
+	result, err := m.DB.Exec(stmt, signCount, id, signCount, signCount)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	// MySQL doesn't count rows the update left as they were, as happens to
+	// a passkey without a counter used twice in a second, so check that
+	// the condition really failed.
+	var ok bool
+	err = m.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM passkeys WHERE id = ? AND (sign_count < ? OR ? = 0))`,
+		id, signCount, signCount).Scan(&ok)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrSignCount
+	}
+	return nil
+}
+
+func (m *PasskeyModel) Delete(id, userID int) error {
+	result, err := m.DB.Exec(`DELETE FROM passkeys WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type PasswordResetModel struct {
+	DB *sql.DB
+}
+
+type PasswordResetModelInterface interface {
+	New(userID int, ttl time.Duration) (string, error)
+	UserID(token string) (int, error)
+	Consume(token string) (int, error)
+}
+
+// New issues a reset token for the user that is valid for ttl. The token is
+// returned in plain text and stored only as a hash.
+func (m *PasswordResetModel) New(userID int, ttl time.Duration) (string, error) {
+	token, hash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	stmt := `INSERT INTO password_resets (token_hash,user_id,created,expires)
+  VALUES(?,?,UTC_TIMESTAMP(),DATE_ADD(UTC_TIMESTAMP(),INTERVAL ? SECOND))`
+	_, err = m.DB.Exec(stmt, hash, userID, int(ttl.Seconds()))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// UserID returns the owner of a live token without using it up.
+func (m *PasswordResetModel) UserID(token string) (int, error) {
+	var userID int
+	stmt := `SELECT user_id FROM password_resets WHERE token_hash = ? AND expires > UTC_TIMESTAMP()`
+	err := m.DB.QueryRow(stmt, hashToken(token)).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+	return userID, nil
+}
+
+// Consume redeems a live token and deletes every outstanding token for the
+// same user, so each emailed link works at most once.
+func (m *PasswordResetModel) Consume(token string) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	stmt := `SELECT user_id FROM password_resets
+  WHERE token_hash = ? AND expires > UTC_TIMESTAMP() FOR UPDATE`
+	err = tx.QueryRow(stmt, hashToken(token)).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+	_, err = tx.Exec(`DELETE FROM password_resets WHERE user_id = ?`, userID)
+	if err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
@@ -0,0 +1,142 @@
+package models
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// RememberTokenModel keeps the long-lived tokens behind "remember me". A
+// token is a selector, which finds the row, and a validator, which is only
+// stored hashed, so a leaked table can't be replayed and lookups don't leak
+// timing about the secret part.
+//
+// Every use rotates the token. The replaced row is kept, marked as rotated,
+// until it expires: if it ever comes back the cookie has been copied, and
+// every token descended from the same login is revoked.
+type RememberTokenModel struct {
+	DB *sql.DB
+}
+
+type RememberTokenModelInterface interface {
+	New(userID int, ttl time.Duration) (string, error)
+	Rotate(token string, ttl time.Duration) (int, string, error)
+	Revoke(token string) error
+	RevokeAll(userID int, exceptToken string) error
+}
+
+// New issues a token for a fresh login, starting a new family.
+func (m *RememberTokenModel) New(userID int, ttl time.Duration) (string, error) {
+	family, err := randomString(12)
+	if err != nil {
+		return "", err
+	}
+	// Nothing else clears out expired tokens, so logging in does.
+	_, err = m.DB.Exec(`DELETE FROM remember_tokens WHERE user_id = ? AND expires <= UTC_TIMESTAMP()`, userID)
+	if err != nil {
+		return "", err
+	}
+	return m.insert(m.DB, userID, family, ttl)
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func (m *RememberTokenModel) insert(db execer, userID int, family string, ttl time.Duration) (string, error) {
+	selector, err := randomString(12)
+	if err != nil {
+		return "", err
+	}
+	validator, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+	stmt := `INSERT INTO remember_tokens (selector,validator_hash,family,user_id,created,expires)
+  VALUES(?,?,?,?,UTC_TIMESTAMP(),DATE_ADD(UTC_TIMESTAMP(),INTERVAL ? SECOND))`
+	_, err = db.Exec(stmt, selector, hashToken(validator), family, userID, int(ttl.Seconds()))
+	if err != nil {
+		return "", err
+	}
+	return selector + "." + validator, nil
+}
+
+// Rotate redeems token, returning its owner and the token that replaces it.
+// Unknown, expired and forged tokens, and those of locked accounts, give
+// ErrInvalidCredentials. A token that has already been rotated is being
+// replayed, so its family is revoked and ErrTokenReused is returned along
+// with the owner.
+func (m *RememberTokenModel) Rotate(token string, ttl time.Duration) (int, string, error) {
+	selector, validator, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, "", ErrInvalidCredentials
+	}
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback()
+
+	var (
+		hash, family string
+		userID       int
+		rotated      sql.NullTime
+	)
+	stmt := `SELECT t.validator_hash, t.family, t.user_id, t.rotated FROM remember_tokens t
+  JOIN users u ON u.id = t.user_id
+  WHERE t.selector = ? AND t.expires > UTC_TIMESTAMP() AND NOT u.disabled AND u.deleted IS NULL
+  FOR UPDATE`
+	err = tx.QueryRow(stmt, selector).Scan(&hash, &family, &userID, &rotated)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, "", ErrInvalidCredentials
+		}
+		return 0, "", err
+	}
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(hashToken(validator))) != 1 {
+		return 0, "", ErrInvalidCredentials
+	}
+	if rotated.Valid {
+		_, err = tx.Exec(`DELETE FROM remember_tokens WHERE family = ?`, family)
+		if err != nil {
+			return 0, "", err
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, "", err
+		}
+		return userID, "", ErrTokenReused
+	}
+
+	_, err = tx.Exec(`UPDATE remember_tokens SET rotated = UTC_TIMESTAMP() WHERE selector = ?`, selector)
+	if err != nil {
+		return 0, "", err
+	}
+	next, err := m.insert(tx, userID, family, ttl)
+	if err != nil {
+		return 0, "", err
+	}
+	return userID, next, tx.Commit()
+}
+
+// Revoke removes the family token belongs to, for logging out. Tokens that
+// don't match anything are ignored.
+func (m *RememberTokenModel) Revoke(token string) error {
+	selector, _, _ := strings.Cut(token, ".")
+	stmt := `DELETE t FROM remember_tokens t JOIN remember_tokens s ON s.family = t.family
+  WHERE s.selector = ?`
+	_, err := m.DB.Exec(stmt, selector)
+	return err
+}
+
+// RevokeAll removes every one of the user's tokens except those in the same
+// family as exceptToken, which may be empty.
+func (m *RememberTokenModel) RevokeAll(userID int, exceptToken string) error {
+	selector, _, _ := strings.Cut(exceptToken, ".")
+	stmt := `DELETE FROM remember_tokens WHERE user_id = ? AND family NOT IN (
+  SELECT family FROM (SELECT family FROM remember_tokens WHERE selector = ?) AS keep)`
+	_, err := m.DB.Exec(stmt, userID, selector)
+	return err
+}
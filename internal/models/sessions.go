@@ -0,0 +1,126 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// UserSession describes one logged in browser. Its ID is kept in the
+// server-side session data, never in a cookie; removing the row logs that
+// browser out on its next request.
+type UserSession struct {
+	ID        string
+	UserID    int
+	Created   time.Time
+	LastSeen  time.Time
+	IP        string
+	UserAgent string
+}
+
+type UserSessionModel struct {
+	DB *sql.DB
+}
+
+type UserSessionModelInterface interface {
+	Create(userID int, ip, userAgent string) (string, error)
+	Get(id string) (*UserSession, error)
+	Touch(id, ip string) error
+	ForUser(userID int) ([]*UserSession, error)
+	Revoke(id string, userID int) error
+	RevokeAll(userID int, exceptID string) error
+}
+
+func (m *UserSessionModel) Create(userID int, ip, userAgent string) (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := base64.RawURLEncoding.EncodeToString(b)
+	userAgent = userAgentColumn(userAgent)
+	stmt := `INSERT INTO user_sessions (id,user_id,created,last_seen,ip,user_agent)
+  VALUES(?,?,UTC_TIMESTAMP(),UTC_TIMESTAMP(),?,?)`
+	_, err := m.DB.Exec(stmt, id, userID, ip, userAgent)
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (m *UserSessionModel) Get(id string) (*UserSession, error) {
+	stmt := `SELECT id,user_id,created,last_seen,ip,user_agent FROM user_sessions WHERE id = ?`
+	s := &UserSession{}
+	err := m.DB.QueryRow(stmt, id).Scan(&s.ID, &s.UserID, &s.Created, &s.LastSeen, &s.IP, &s.UserAgent)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+// Touch records that the session was just used from ip.
+func (m *UserSessionModel) Touch(id, ip string) error {
+	_, err := m.DB.Exec(`UPDATE user_sessions SET last_seen = UTC_TIMESTAMP(), ip = ? WHERE id = ?`, ip, id)
+	return err
+}
+
+// ForUser lists the user's sessions, most recently used first.
+func (m *UserSessionModel) ForUser(userID int) ([]*UserSession, error) {
+	stmt := `SELECT id,user_id,created,last_seen,ip,user_agent FROM user_sessions
+  WHERE user_id = ? ORDER BY last_seen DESC`
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sessions := []*UserSession{}
+	for rows.Next() {
+		s := &UserSession{}
+		err = rows.Scan(&s.ID, &s.UserID, &s.Created, &s.LastSeen, &s.IP, &s.UserAgent)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// Revoke ends one of the user's sessions.
+func (m *UserSessionModel) Revoke(id string, userID int) error {
+	result, err := m.DB.Exec(`DELETE FROM user_sessions WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+// RevokeAll ends every session the user has apart from exceptID, which may
+// be empty to end them all.
+func (m *UserSessionModel) RevokeAll(userID int, exceptID string) error {
+	_, err := m.DB.Exec(`DELETE FROM user_sessions WHERE user_id = ? AND id <> ?`, userID, exceptID)
+	return err
+}
+
+// userAgentColumn fits a User-Agent header into a VARCHAR(255) column.
+// Headers can hold any bytes, so invalid UTF-8 is dropped before cutting
+// on a character boundary; strict MySQL rejects both otherwise.
+func userAgentColumn(userAgent string) string {
+	userAgent = strings.ToValidUTF8(userAgent, "")
+	if utf8.RuneCountInString(userAgent) <= 255 {
+		return userAgent
+	}
+	return string([]rune(userAgent)[:255])
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"snipit.bikraj.net/internal/assert"
+)
+
+func TestUserAgentColumn(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      string
+	}{
+		{"Short", "Mozilla/5.0", "Mozilla/5.0"},
+		{"Long ASCII", strings.Repeat("a", 300), strings.Repeat("a", 255)},
+		{"Long multi-byte", strings.Repeat("é", 300), strings.Repeat("é", 255)},
+		{"Invalid UTF-8", "Mozilla\xff/5.0", "Mozilla/5.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := userAgentColumn(tt.userAgent)
+			assert.Equal(t, got, tt.want)
+			assert.Equal(t, utf8.ValidString(got), true)
+		})
+	}
+}
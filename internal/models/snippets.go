@@ -1,26 +1,53 @@
 package models
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 )
 
+// Visibility levels a snippet can be published with.
+const (
+	VisibilityPublic       = "public"
+	VisibilityUnlisted     = "unlisted"
+	VisibilityPrivate      = "private"
+	VisibilityOrganization = "organization" // members of the owning organization only
+)
+
 type Snippet struct {
-	ID      int
-	Title   string
-	Content string
-	Created time.Time
-	Expires time.Time
+	ID         int
+	UserID     int
+	OrgID      int
+	Title      string
+	Content    string
+	Language   string
+	Visibility string
+	Created    time.Time
+	Expires    time.Time
 }
 
 type SnippetModel struct {
 	DB *sql.DB
 }
 type SnippetModelInterface interface {
-	Insert(title string, content string, expires int) (int, error)
+	Insert(userID, orgID int, title, content, language, visibility string, expires int) (int, error)
 	Get(id int) (*Snippet, error)
 	Latest() ([]*Snippet, error)
+	FindDuplicate(userID int, content string) (*Snippet, error)
+	Similar(content string, limit int) ([]*Snippet, error)
+	Delete(id, userID int) error
+	Recent(limit int) ([]*Snippet, error)
+	DeleteAny(id int) error
+	ForOrg(orgID, limit int) ([]*Snippet, error)
+	ForUser(userID int) ([]*Snippet, error)
+	Disown(userID int, policy string, orgID int) error
+	PublicForUser(userID, limit, offset int) ([]*Snippet, error)
+	PageForUser(userID, limit, offset int) ([]*Snippet, error)
+	Update(id, userID int, title, content, language, visibility string, expires int) error
 }
 type MyTime time.Time
 
@@ -35,14 +62,20 @@ func (t *MyTime) Scan(v any) error {
 	return nil
 }
 
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
-	stmt := `INSERT INTO SNIPPETS(title,content,expires,created)
-  VALUES(?,?,UTC_TIMESTAMP(),DATE_ADD(UTC_TIMESTAMP(),INTERVAL ? DAY))`
-	result, err := m.DB.Exec(stmt, title, content, expires)
+// Insert stores a snippet created by userID, owned by the organization
+// orgID when that isn't 0.
+func (m *SnippetModel) Insert(userID, orgID int, title, content, language, visibility string, expires int) (int, error) {
+	stored, encoding, err := encodeContent(content)
 	if err != nil {
 		return 0, err
 	}
-  
+	stmt := `INSERT INTO SNIPPETS(user_id,org_id,title,content,content_encoding,content_hash,language,visibility,created,expires)
+  VALUES(?,?,?,?,?,?,?,?,UTC_TIMESTAMP(),DATE_ADD(UTC_TIMESTAMP(),INTERVAL ? DAY))`
+	result, err := m.DB.Exec(stmt, nullID(userID), nullID(orgID), title, stored, encoding, ContentHash(content), language, visibility, expires)
+	if err != nil {
+		return 0, err
+	}
+
 	id, err := result.LastInsertId()
 	if err != nil {
 		return 0, err
@@ -51,13 +84,10 @@ func (m *SnippetModel) Insert(title string, content string, expires int) (int, e
 }
 
 func (m *SnippetModel) Get(id int) (*Snippet, error) {
-	stmt := `SELECT id, title,content,created,expires FROM SNIPPETS
+	stmt := `SELECT ` + snippetColumns + ` FROM SNIPPETS
   WHERE id = ?`
 
-	row := m.DB.QueryRow(stmt, id)
-	s := &Snippet{}
-
-	err := row.Scan(&s.ID, &s.Title, &s.Content, (*MyTime)(&s.Created), (*MyTime)(&s.Expires))
+	s, err := scanSnippet(m.DB.QueryRow(stmt, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNoRecord
@@ -69,22 +99,247 @@ func (m *SnippetModel) Get(id int) (*Snippet, error) {
 }
 
 func (m *SnippetModel) Latest() ([]*Snippet, error) {
-	stmt := `SELECT id,title,content,expires,created FROM SNIPPETS
-   ORDER BY id DESC LIMIT 10`
+	stmt := `SELECT ` + snippetColumns + ` FROM SNIPPETS
+   WHERE visibility = 'public' ORDER BY id DESC LIMIT 10`
+
+	return m.query(stmt)
+}
 
-	rows, err := m.DB.Query(stmt)
+// FindDuplicate returns the user's most recent live snippet whose normalised
+// content matches content, or ErrNoRecord when there is none.
+func (m *SnippetModel) FindDuplicate(userID int, content string) (*Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM SNIPPETS
+  WHERE user_id = ? AND content_hash = ? AND expires > UTC_TIMESTAMP()
+  ORDER BY id DESC LIMIT 1`
+	s, err := scanSnippet(m.DB.QueryRow(stmt, userID, ContentHash(content)))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+// Similar returns up to limit live public snippets, from any user, whose
+// normalised content matches content.
+func (m *SnippetModel) Similar(content string, limit int) ([]*Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM SNIPPETS
+  WHERE content_hash = ? AND visibility = 'public' AND expires > UTC_TIMESTAMP()
+  ORDER BY id DESC LIMIT ?`
+	return m.query(stmt, ContentHash(content), limit)
+}
+
+// Delete removes one of the user's snippets.
+func (m *SnippetModel) Delete(id, userID int) error {
+	result, err := m.DB.Exec(`DELETE FROM SNIPPETS WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+// Recent returns the newest snippets of every visibility, for moderation.
+func (m *SnippetModel) Recent(limit int) ([]*Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM SNIPPETS ORDER BY id DESC LIMIT ?`
+	return m.query(stmt, limit)
+}
+
+// DeleteAny removes a snippet regardless of who owns it.
+func (m *SnippetModel) DeleteAny(id int) error {
+	result, err := m.DB.Exec(`DELETE FROM SNIPPETS WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+// ForOrg returns the organization's live snippets, newest first. Callers
+// check membership; private snippets are left out.
+func (m *SnippetModel) ForOrg(orgID, limit int) ([]*Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM SNIPPETS
+  WHERE org_id = ? AND visibility <> 'private' AND expires > UTC_TIMESTAMP()
+  ORDER BY id DESC LIMIT ?`
+	return m.query(stmt, orgID, limit)
+}
+
+// PublicForUser returns a page of the user's live public snippets, newest
+// first, for their profile.
+func (m *SnippetModel) PublicForUser(userID, limit, offset int) ([]*Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM SNIPPETS
+  WHERE user_id = ? AND visibility = 'public' AND expires > UTC_TIMESTAMP()
+  ORDER BY id DESC LIMIT ? OFFSET ?`
+	return m.query(stmt, userID, limit, offset)
+}
+
+// PageForUser returns the user's unexpired snippets of every visibility,
+// newest first, a page at a time.
+func (m *SnippetModel) PageForUser(userID, limit, offset int) ([]*Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM SNIPPETS
+  WHERE user_id = ? AND expires > UTC_TIMESTAMP()
+  ORDER BY id DESC LIMIT ? OFFSET ?`
+	return m.query(stmt, userID, limit, offset)
+}
+
+// Update replaces the fields of a snippet userID created. When expires
+// isn't 0 the snippet expires that many days from now; otherwise its
+// expiry stays as it was.
+func (m *SnippetModel) Update(id, userID int, title, content, language, visibility string, expires int) error {
+	stored, encoding, err := encodeContent(content)
+	if err != nil {
+		return err
+	}
+	stmt := `UPDATE SNIPPETS SET title = ?, content = ?, content_encoding = ?, content_hash = ?, language = ?, visibility = ?,
+  expires = IF(? > 0, DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY), expires)
+  WHERE id = ? AND user_id = ?`
+	result, err := m.DB.Exec(stmt, title, stored, encoding, ContentHash(content), language, visibility, expires, expires, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	// MySQL doesn't count rows the update left as they were, so make sure
+	// the snippet is really missing.
+	var exists bool
+	err = m.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM SNIPPETS WHERE id = ? AND user_id = ?)`, id, userID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+// ForUser returns every snippet the user created, expired ones included,
+// oldest first.
+func (m *SnippetModel) ForUser(userID int) ([]*Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM SNIPPETS WHERE user_id = ? ORDER BY id`
+	return m.query(stmt, userID)
+}
+
+// What happens to a user's own snippets when they delete their account.
+// Snippets that already belong to an organization stay with it whatever the
+// policy.
+const (
+	SnippetPolicyDelete       = "delete"       // delete them
+	SnippetPolicyAnonymous    = "anonymous"    // keep public and unlisted ones without an owner
+	SnippetPolicyOrganization = "organization" // hand them all to one of the user's organizations
+)
+
+// Disown detaches the user from their snippets according to policy. orgID
+// is only used by SnippetPolicyOrganization; private snippets handed to an
+// organization become visible to its members only.
+func (m *SnippetModel) Disown(userID int, policy string, orgID int) error {
+	var stmts []string
+	var args [][]any
+	switch policy {
+	case SnippetPolicyDelete:
+		stmts = append(stmts, `DELETE FROM snippets WHERE user_id = ? AND org_id IS NULL`)
+		args = append(args, []any{userID})
+	case SnippetPolicyAnonymous:
+		// Nobody could reach an ownerless private snippet, so those go.
+		stmts = append(stmts, `DELETE FROM snippets WHERE user_id = ? AND org_id IS NULL AND visibility = 'private'`)
+		args = append(args, []any{userID})
+	case SnippetPolicyOrganization:
+		if orgID == 0 {
+			return errors.New("models: no organization to hand snippets to")
+		}
+		stmts = append(stmts, `UPDATE snippets SET org_id = ?,
+  visibility = IF(visibility = 'private', 'organization', visibility) WHERE user_id = ? AND org_id IS NULL`)
+		args = append(args, []any{orgID, userID})
+	default:
+		return fmt.Errorf("models: unknown snippet policy %q", policy)
+	}
+	stmts = append(stmts, `UPDATE snippets SET user_id = NULL WHERE user_id = ?`)
+	args = append(args, []any{userID})
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for i, stmt := range stmts {
+		if _, err := tx.Exec(stmt, args[i]...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// snippetColumns is the select list understood by scanSnippet.
+const snippetColumns = `id,IFNULL(user_id,0),IFNULL(org_id,0),title,content,content_encoding,language,visibility,created,expires`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSnippet(row rowScanner) (*Snippet, error) {
+	s := &Snippet{}
+	var stored []byte
+	var encoding string
+	err := row.Scan(&s.ID, &s.UserID, &s.OrgID, &s.Title, &stored, &encoding, &s.Language, &s.Visibility, &s.Created, &s.Expires)
+	if err != nil {
+		return nil, err
+	}
+	s.Content, err = decodeContent(stored, encoding)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (m *SnippetModel) query(stmt string, args ...any) ([]*Snippet, error) {
+	rows, err := m.DB.Query(stmt, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	snippets := []*Snippet{}
 	for rows.Next() {
-		s := &Snippet{}
-		err = rows.Scan(&s.ID, &s.Title, &s.Content, (&s.Created), (&s.Expires))
+		s, err := scanSnippet(rows)
 		if err != nil {
 			return nil, err
 		}
 		snippets = append(snippets, s)
 	}
-	return snippets, nil
+	return snippets, rows.Err()
+}
+
+// ContentHash returns the hex SHA-256 of content after normalisation: line
+// endings are unified to \n, trailing whitespace is stripped from every line
+// and leading/trailing blank space is trimmed from the whole text.
+func ContentHash(content string) string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.ReplaceAll(content, "\r", "\n")
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	sum := sha256.Sum256([]byte(strings.TrimSpace(strings.Join(lines, "\n"))))
+	return hex.EncodeToString(sum[:])
+}
+
+// nullID maps the zero ID used by handlers for "nobody" onto a SQL NULL.
+func nullID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
 }
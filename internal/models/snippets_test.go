@@ -0,0 +1,48 @@
+package models
+
+import (
+	"testing"
+
+	"snipit.bikraj.net/internal/assert"
+)
+
+func TestContentHash(t *testing.T) {
+	base := ContentHash("panic: boom\n\tmain.go:12\n")
+
+	tests := []struct {
+		name    string
+		content string
+		want    bool
+	}{
+		{
+			name:    "Identical",
+			content: "panic: boom\n\tmain.go:12\n",
+			want:    true,
+		},
+		{
+			name:    "CRLF line endings",
+			content: "panic: boom\r\n\tmain.go:12\r\n",
+			want:    true,
+		},
+		{
+			name:    "Surrounding and trailing whitespace",
+			content: "\n\n  panic: boom   \n\tmain.go:12\t\n\n",
+			want:    true,
+		},
+		{
+			name:    "Changed indentation",
+			content: "panic: boom\n    main.go:12\n",
+			want:    false,
+		},
+		{
+			name:    "Different content",
+			content: "panic: bang\n\tmain.go:12\n",
+			want:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, ContentHash(tt.content) == base, tt.want)
+		})
+	}
+}
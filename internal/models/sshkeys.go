@@ -0,0 +1,112 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// SSHKey is a public key a user has registered for the paste server. Keys
+// are parsed and fingerprinted by the caller; the model only stores them.
+type SSHKey struct {
+	ID          int
+	UserID      int
+	Name        string
+	Fingerprint string
+	PublicKey   string
+	Created     time.Time
+	LastUsed    time.Time
+}
+
+type SSHKeyModel struct {
+	DB *sql.DB
+}
+
+type SSHKeyModelInterface interface {
+	Insert(userID int, name, fingerprint, publicKey string) (int, error)
+	ForUser(userID int) ([]*SSHKey, error)
+	Delete(id, userID int) error
+	Authenticate(fingerprint string) (int, error)
+}
+
+// Insert registers a key, giving ErrDuplicateKey if any account already
+// has it.
+func (m *SSHKeyModel) Insert(userID int, name, fingerprint, publicKey string) (int, error) {
+	stmt := `INSERT INTO ssh_keys (user_id,name,fingerprint,public_key,created)
+  VALUES(?,?,?,?,UTC_TIMESTAMP())`
+	result, err := m.DB.Exec(stmt, userID, name, fingerprint, publicKey)
+	if err != nil {
+		var mySQLError *mysql.MySQLError
+		if errors.As(err, &mySQLError) && mySQLError.Number == 1062 &&
+			strings.Contains(mySQLError.Message, "ssh_keys_uc_fingerprint") {
+			return 0, ErrDuplicateKey
+		}
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (m *SSHKeyModel) ForUser(userID int) ([]*SSHKey, error) {
+	stmt := `SELECT id,user_id,name,fingerprint,public_key,created,last_used
+  FROM ssh_keys WHERE user_id = ? ORDER BY id DESC`
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []*SSHKey{}
+	for rows.Next() {
+		k := &SSHKey{}
+		var lastUsed sql.NullTime
+		err = rows.Scan(&k.ID, &k.UserID, &k.Name, &k.Fingerprint, &k.PublicKey, &k.Created, &lastUsed)
+		if err != nil {
+			return nil, err
+		}
+		k.LastUsed = lastUsed.Time
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (m *SSHKeyModel) Delete(id, userID int) error {
+	result, err := m.DB.Exec(`DELETE FROM ssh_keys WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+// Authenticate finds the owner of the key with fingerprint and records that
+// it was used. Unknown keys, and those of disabled or unverified accounts,
+// give ErrInvalidCredentials.
+func (m *SSHKeyModel) Authenticate(fingerprint string) (int, error) {
+	stmt := `SELECT k.id,k.user_id FROM ssh_keys k JOIN users u ON u.id = k.user_id
+  WHERE k.fingerprint = ? AND u.verified AND NOT u.disabled AND u.deleted IS NULL`
+	var id, userID int
+	err := m.DB.QueryRow(stmt, fingerprint).Scan(&id, &userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidCredentials
+		}
+		return 0, err
+	}
+	_, err = m.DB.Exec(`UPDATE ssh_keys SET last_used = UTC_TIMESTAMP() WHERE id = ?`, id)
+	if err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
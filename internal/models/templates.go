@@ -0,0 +1,118 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// SnippetTemplate is a reusable starting point for the create form. Templates
+// without an owner (UserID == 0) are site-wide and visible to every user.
+type SnippetTemplate struct {
+	ID           int
+	UserID       int
+	Name         string
+	TitlePattern string
+	Language     string
+	Content      string
+	Expires      int
+	Visibility   string
+	Created      time.Time
+}
+
+// SiteWide reports whether the template is shared with every user.
+func (t *SnippetTemplate) SiteWide() bool {
+	return t.UserID == 0
+}
+
+// Title expands the placeholders {date} and {time} in the title pattern.
+func (t *SnippetTemplate) Title(now time.Time) string {
+	r := strings.NewReplacer(
+		"{date}", now.UTC().Format("2006-01-02"),
+		"{time}", now.UTC().Format("15:04"),
+	)
+	return r.Replace(t.TitlePattern)
+}
+
+type SnippetTemplateModel struct {
+	DB *sql.DB
+}
+
+type SnippetTemplateModelInterface interface {
+	Insert(userID int, name, titlePattern, language, content, visibility string, expires int) (int, error)
+	Get(id int) (*SnippetTemplate, error)
+	ForUser(userID int) ([]*SnippetTemplate, error)
+	Delete(id, userID int) error
+}
+
+// Insert stores a new template. A userID of 0 creates a site-wide template.
+func (m *SnippetTemplateModel) Insert(userID int, name, titlePattern, language, content, visibility string, expires int) (int, error) {
+	stmt := `INSERT INTO snippet_templates (user_id,name,title_pattern,language,content,expires,visibility,created)
+  VALUES(?,?,?,?,?,?,?,UTC_TIMESTAMP())`
+	result, err := m.DB.Exec(stmt, nullID(userID), name, titlePattern, language, content, expires, visibility)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (m *SnippetTemplateModel) Get(id int) (*SnippetTemplate, error) {
+	stmt := `SELECT id,IFNULL(user_id,0),name,title_pattern,language,content,expires,visibility,created
+  FROM snippet_templates WHERE id = ?`
+	t := &SnippetTemplate{}
+	err := m.DB.QueryRow(stmt, id).Scan(&t.ID, &t.UserID, &t.Name, &t.TitlePattern, &t.Language,
+		&t.Content, &t.Expires, &t.Visibility, &t.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	return t, nil
+}
+
+// ForUser returns the site-wide templates followed by the user's own ones.
+func (m *SnippetTemplateModel) ForUser(userID int) ([]*SnippetTemplate, error) {
+	stmt := `SELECT id,IFNULL(user_id,0),name,title_pattern,language,content,expires,visibility,created
+  FROM snippet_templates WHERE user_id IS NULL OR user_id = ?
+  ORDER BY user_id IS NOT NULL, name`
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	templates := []*SnippetTemplate{}
+	for rows.Next() {
+		t := &SnippetTemplate{}
+		err = rows.Scan(&t.ID, &t.UserID, &t.Name, &t.TitlePattern, &t.Language,
+			&t.Content, &t.Expires, &t.Visibility, &t.Created)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	return templates, rows.Err()
+}
+
+// Delete removes a template owned by userID. A userID of 0 targets a
+// site-wide template.
+func (m *SnippetTemplateModel) Delete(id, userID int) error {
+	stmt := `DELETE FROM snippet_templates WHERE id = ? AND user_id <=> ?`
+	result, err := m.DB.Exec(stmt, id, nullID(userID))
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
@@ -1,20 +1,190 @@
 CREATE TABLE snippets (
 id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+user_id INTEGER,
+org_id INTEGER,
 title  VARCHAR(100) NOT NULL,
-content TEXT NOT NULL,
+content MEDIUMBLOB NOT NULL,
+content_encoding VARCHAR(10) NOT NULL DEFAULT '',
+content_hash CHAR(64) NOT NULL DEFAULT '',
+language VARCHAR(30) NOT NULL DEFAULT '',
+visibility VARCHAR(20) NOT NULL DEFAULT 'public',
 created DATETIME NOT NULL,
 expires DATETIME NOT NULL
 );
+CREATE INDEX idx_snippets_user_content_hash ON snippets(user_id, content_hash);
+CREATE INDEX idx_snippets_content_hash ON snippets(content_hash);
 -- CREATE INDEX idx_snippets_created ON snippets(created);
 CREATE TABLE users (
 
  name   VARCHAR(255) NOT NULL,
 id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
 email  VARCHAR(255) NOT NULL,
-hashed_password VARCHAR(60) NOT NULL,
-created DATETIME NOT NULL
+hashed_password VARCHAR(255) NOT NULL,
+created DATETIME NOT NULL,
+verified BOOLEAN NOT NULL DEFAULT FALSE,
+totp_secret VARCHAR(64),
+totp_last_step BIGINT,
+role VARCHAR(20) NOT NULL DEFAULT 'user',
+disabled BOOLEAN NOT NULL DEFAULT FALSE,
+deleted DATETIME,
+purge_after DATETIME,
+username VARCHAR(30) NOT NULL,
+bio VARCHAR(500) NOT NULL DEFAULT ''
 );
+CREATE INDEX idx_users_purge_after ON users(purge_after);
 ALTER TABLE users ADD CONSTRAINT users_uc_email UNIQUE (email);
-INSERT INTO users (name, email, hashed_password, created) VALUES ( 
-  'Alice Jones','alice@example.com', '$2a$12$NuTjWXm3KKntReFwyBVHyuf/to.HEwTy.eS206TNfkGfr6HzGJSWG', '2022-01-01 10:00:00'
+ALTER TABLE users ADD CONSTRAINT users_uc_username UNIQUE (username);
+INSERT INTO users (name, username, email, hashed_password, created) VALUES ( 
+  'Alice Jones','alice','alice@example.com', '$2a$12$NuTjWXm3KKntReFwyBVHyuf/to.HEwTy.eS206TNfkGfr6HzGJSWG', '2022-01-01 10:00:00'
+);
+UPDATE users SET verified = TRUE;
+CREATE TABLE snippet_templates (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+user_id INTEGER,
+name VARCHAR(100) NOT NULL,
+title_pattern VARCHAR(100) NOT NULL,
+language VARCHAR(30) NOT NULL DEFAULT '',
+content TEXT NOT NULL,
+expires INTEGER NOT NULL,
+visibility VARCHAR(20) NOT NULL DEFAULT 'public',
+created DATETIME NOT NULL
+);
+CREATE INDEX idx_snippet_templates_user_id ON snippet_templates(user_id);
+CREATE TABLE password_resets (
+token_hash CHAR(64) NOT NULL PRIMARY KEY,
+user_id INTEGER NOT NULL,
+created DATETIME NOT NULL,
+expires DATETIME NOT NULL
+);
+CREATE INDEX idx_password_resets_user_id ON password_resets(user_id);
+CREATE TABLE recovery_codes (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+user_id INTEGER NOT NULL,
+code_hash CHAR(64) NOT NULL,
+created DATETIME NOT NULL
+);
+CREATE INDEX idx_recovery_codes_user_id ON recovery_codes(user_id);
+CREATE TABLE login_attempts (
+attempt_key VARCHAR(300) NOT NULL PRIMARY KEY,
+failures INTEGER NOT NULL,
+last_failure DATETIME(6) NOT NULL
+);
+CREATE TABLE user_sessions (
+id VARCHAR(43) NOT NULL PRIMARY KEY,
+user_id INTEGER NOT NULL,
+created DATETIME NOT NULL,
+last_seen DATETIME NOT NULL,
+ip VARCHAR(45) NOT NULL,
+user_agent VARCHAR(255) NOT NULL
+);
+CREATE INDEX idx_user_sessions_user_id ON user_sessions(user_id);
+CREATE TABLE api_tokens (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+user_id INTEGER NOT NULL,
+name VARCHAR(100) NOT NULL,
+token_hash CHAR(64) NOT NULL,
+scopes VARCHAR(50) NOT NULL,
+created DATETIME NOT NULL,
+expires DATETIME NOT NULL,
+last_used DATETIME NULL
+);
+ALTER TABLE api_tokens ADD CONSTRAINT api_tokens_uc_token_hash UNIQUE (token_hash);
+CREATE INDEX idx_api_tokens_user_id ON api_tokens(user_id);
+CREATE TABLE user_identities (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+user_id INTEGER NOT NULL,
+provider VARCHAR(50) NOT NULL,
+subject VARCHAR(255) NOT NULL,
+created DATETIME NOT NULL
+);
+ALTER TABLE user_identities ADD CONSTRAINT user_identities_uc_provider_subject UNIQUE (provider, subject);
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
+CREATE TABLE audit_log (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+actor_id INTEGER,
+action VARCHAR(50) NOT NULL,
+target_type VARCHAR(20) NOT NULL,
+target_id INTEGER NOT NULL,
+ip VARCHAR(45) NOT NULL DEFAULT '',
+created DATETIME NOT NULL,
+details JSON NULL,
+user_agent VARCHAR(255) NOT NULL DEFAULT ''
+);
+CREATE INDEX idx_audit_log_created ON audit_log(created);
+CREATE INDEX idx_audit_log_actor_id ON audit_log(actor_id);
+CREATE INDEX idx_audit_log_target ON audit_log(target_type, target_id);
+CREATE INDEX idx_audit_log_ip ON audit_log(ip);
+CREATE TRIGGER audit_log_append_only BEFORE UPDATE ON audit_log FOR EACH ROW
+  SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+CREATE TABLE organizations (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+slug VARCHAR(50) NOT NULL,
+name VARCHAR(100) NOT NULL,
+created DATETIME NOT NULL
+);
+ALTER TABLE organizations ADD CONSTRAINT organizations_uc_slug UNIQUE (slug);
+CREATE TABLE org_members (
+org_id INTEGER NOT NULL,
+user_id INTEGER NOT NULL,
+role VARCHAR(20) NOT NULL,
+created DATETIME NOT NULL,
+PRIMARY KEY (org_id, user_id)
+);
+CREATE INDEX idx_org_members_user_id ON org_members(user_id);
+CREATE TABLE org_invitations (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+org_id INTEGER NOT NULL,
+email VARCHAR(255) NOT NULL,
+role VARCHAR(20) NOT NULL,
+token_hash CHAR(64) NOT NULL,
+invited_by INTEGER NOT NULL,
+created DATETIME NOT NULL,
+expires DATETIME NOT NULL
+);
+ALTER TABLE org_invitations ADD CONSTRAINT org_invitations_uc_token_hash UNIQUE (token_hash);
+CREATE INDEX idx_snippets_org_id ON snippets(org_id);
+CREATE TABLE remember_tokens (
+selector CHAR(16) NOT NULL PRIMARY KEY,
+validator_hash CHAR(64) NOT NULL,
+family CHAR(16) NOT NULL,
+user_id INTEGER NOT NULL,
+created DATETIME NOT NULL,
+expires DATETIME NOT NULL,
+rotated DATETIME NULL
+);
+CREATE INDEX idx_remember_tokens_family ON remember_tokens(family);
+CREATE INDEX idx_remember_tokens_user_id ON remember_tokens(user_id);
+CREATE TABLE invite_codes (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+code_hash CHAR(64) NOT NULL,
+note VARCHAR(100) NOT NULL,
+max_uses INTEGER NOT NULL,
+uses INTEGER NOT NULL DEFAULT 0,
+created_by INTEGER NULL,
+created DATETIME NOT NULL,
+expires DATETIME NOT NULL
+);
+ALTER TABLE invite_codes ADD CONSTRAINT invite_codes_uc_code_hash UNIQUE (code_hash);
+CREATE TABLE ssh_keys (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+user_id INTEGER NOT NULL,
+name VARCHAR(100) NOT NULL,
+fingerprint VARCHAR(64) NOT NULL,
+public_key TEXT NOT NULL,
+created DATETIME NOT NULL,
+last_used DATETIME NULL
+);
+ALTER TABLE ssh_keys ADD CONSTRAINT ssh_keys_uc_fingerprint UNIQUE (fingerprint);
+CREATE INDEX idx_ssh_keys_user_id ON ssh_keys(user_id);
+CREATE TABLE passkeys (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+user_id INTEGER NOT NULL,
+name VARCHAR(100) NOT NULL,
+credential_id VARBINARY(1023) NOT NULL,
+public_key BLOB NOT NULL,
+sign_count INTEGER UNSIGNED NOT NULL DEFAULT 0,
+created DATETIME NOT NULL,
+last_used DATETIME NULL
 );
+ALTER TABLE passkeys ADD CONSTRAINT passkeys_uc_credential_id UNIQUE (credential_id);
+CREATE INDEX idx_passkeys_user_id ON passkeys(user_id);
@@ -1 +1 @@
-DROP TABLE users; DROP TABLE snippets;
+DROP TABLE users; DROP TABLE snippets; DROP TABLE snippet_templates; DROP TABLE password_resets; DROP TABLE recovery_codes; DROP TABLE login_attempts; DROP TABLE user_sessions; DROP TABLE api_tokens; DROP TABLE user_identities; DROP TABLE audit_log; DROP TABLE organizations; DROP TABLE org_members; DROP TABLE org_invitations; DROP TABLE remember_tokens; DROP TABLE invite_codes; DROP TABLE ssh_keys; DROP TABLE passkeys;
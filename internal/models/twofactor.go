@@ -0,0 +1,117 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// TwoFactorModel stores each user's TOTP secret and their hashed one-shot
+// recovery codes. A user has 2FA enabled when they have a secret.
+type TwoFactorModel struct {
+	DB *sql.DB
+}
+
+type TwoFactorModelInterface interface {
+	Secret(userID int) (string, error)
+	Enable(userID int, secret string, recoveryCodes []string) error
+	Disable(userID int) error
+	RecordStep(userID int, step int64) (bool, error)
+	UseRecoveryCode(userID int, code string) error
+}
+
+// Secret returns the user's TOTP secret, or "" when 2FA is off.
+func (m *TwoFactorModel) Secret(userID int) (string, error) {
+	var secret sql.NullString
+	err := m.DB.QueryRow(`SELECT totp_secret FROM users WHERE id = ?`, userID).Scan(&secret)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNoRecord
+		}
+		return "", err
+	}
+	return secret.String, nil
+}
+
+// Enable turns on 2FA with secret and replaces any previous recovery codes.
+func (m *TwoFactorModel) Enable(userID int, secret string, recoveryCodes []string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE users SET totp_secret = ?, totp_last_step = NULL WHERE id = ?`, secret, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+	for _, code := range recoveryCodes {
+		_, err = tx.Exec(`INSERT INTO recovery_codes (user_id,code_hash,created) VALUES(?,?,UTC_TIMESTAMP())`,
+			userID, hashToken(normaliseRecoveryCode(code)))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (m *TwoFactorModel) Disable(userID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE users SET totp_secret = NULL, totp_last_step = NULL WHERE id = ?`, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RecordStep remembers the time step of the last accepted code and reports
+// false if step is not newer, so an observed code can't be replayed.
+func (m *TwoFactorModel) RecordStep(userID int, step int64) (bool, error) {
+	stmt := `UPDATE users SET totp_last_step = ?
+  WHERE id = ? AND (totp_last_step IS NULL OR totp_last_step < ?)`
+	result, err := m.DB.Exec(stmt, step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// UseRecoveryCode deletes the matching recovery code, or returns
+// ErrInvalidCredentials if the user has no such code.
+func (m *TwoFactorModel) UseRecoveryCode(userID int, code string) error {
+	stmt := `DELETE FROM recovery_codes WHERE user_id = ? AND code_hash = ?`
+	result, err := m.DB.Exec(stmt, userID, hashToken(normaliseRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// normaliseRecoveryCode lets users type codes without the dash or in any case.
+func normaliseRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
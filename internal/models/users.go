@@ -3,77 +3,133 @@ package models
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
 	"github.com/go-sql-driver/mysql"
-	"golang.org/x/crypto/bcrypt"
+	"snipit.bikraj.net/internal/passhash"
 )
 
+// Roles, from least to most privileged.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var roleRank = map[string]int{RoleUser: 0, RoleModerator: 1, RoleAdmin: 2}
+
 type User struct {
 	ID             int
 	Name           string
+	Username       string
 	Email          string
 	HashedPassword []byte
 	Created        time.Time
+	Verified       bool
+	Role           string
+	Disabled       bool
+	Bio            string
+}
+
+// HasRole reports whether the user's role is role or a more privileged one.
+func (u *User) HasRole(role string) bool {
+	have, ok := roleRank[u.Role]
+	want, known := roleRank[role]
+	return ok && known && have >= want
 }
 
 type UserModel struct {
 	Db *sql.DB
+	// Hasher hashes new passwords; passhash.Default is used when it is nil.
+	Hasher *passhash.Hasher
+}
+
+func (m *UserModel) hasher() *passhash.Hasher {
+	if m.Hasher == nil {
+		return passhash.Default
+	}
+	return m.Hasher
 }
 
 type UserModelInterface interface {
-	Insert(name, email, password string) error
+	Insert(name, username, email, password string) (int, error)
 	Authenticate(email, password string) (int, error)
 	Exists(id int) (bool, error)
 	Get(id int) (*User, error)
   ChangePassword(id int, oldPassword string,newPassword string)(bool, error)
+	SetVerified(id int) error
+	GetByEmail(email string) (*User, error)
+	SetPassword(id int, password string) error
+	List() ([]*User, error)
+	SetRole(id int, role string) error
+	SetDisabled(id int, disabled bool) error
+	SoftDelete(id int, grace time.Duration) error
+	Purge() (int, error)
+	GetByUsername(username string) (*User, error)
+	SetProfile(id int, username, bio string) error
+	SetName(id int, name string) error
+	ChangeEmail(id int, email string) error
 }
 
-func (m *UserModel) Get(id int) (*User, error) {
-	var user User
-	stmt := `SELECT name,email,created FROM USERS WHERE id  = ?`
-	exists, err := m.Exists(id)
+const userColumns = `id,name,username,email,created,verified,role,disabled,bio`
+
+func scanUser(row rowScanner) (*User, error) {
+	u := &User{}
+	err := row.Scan(&u.ID, &u.Name, &u.Username, &u.Email, &u.Created, &u.Verified, &u.Role, &u.Disabled, &u.Bio)
 	if err != nil {
-		return &User{}, err
-	} else if !exists {
-		return &User{}, ErrNoRecord
+		return nil, err
 	}
-	err = m.Db.QueryRow(stmt, id).Scan(&user.Name, &user.Email, &user.Created)
+	return u, nil
+}
+
+func (m *UserModel) Get(id int) (*User, error) {
+	stmt := `SELECT ` + userColumns + ` FROM users WHERE id = ? AND deleted IS NULL`
+	user, err := scanUser(m.Db.QueryRow(stmt, id))
 	if err != nil {
-		return &User{}, err
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
 	}
-	return &user, nil
+	return user, nil
 }
 
-func (m *UserModel) Insert(name, email, password string) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+func (m *UserModel) Insert(name, username, email, password string) (int, error) {
+	hashedPassword, err := m.hasher().Hash(password)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	stmt := `INSERT INTO USERS (name,email,hashed_password,created) 
-VALUES(?,?,?,UTC_TIMESTAMP())
+	stmt := `INSERT INTO USERS (name,username,email,hashed_password,created) 
+VALUES(?,?,?,?,UTC_TIMESTAMP())
   `
-	_, err = m.Db.Exec(stmt, name, email, hashedPassword)
+	result, err := m.Db.Exec(stmt, name, username, email, hashedPassword)
 
 	if err != nil {
-		var mySqlError *mysql.MySQLError
-		if errors.As(err, &mySqlError) {
-			if mySqlError.Number == 1062 && strings.Contains(mySqlError.Message, "users_uc_email") {
-				return ErrDuplicateEmail
-			}
+		if dup := duplicateUserError(err); dup != nil {
+			return 0, dup
 		}
+		return 0, err
 	}
-	return nil
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
 }
 
+// Authenticate checks the password first, so ErrAccountDisabled is only
+// ever returned to someone who knows it. A hash made with outdated settings
+// is replaced while the plain password is at hand.
 func (m *UserModel) Authenticate(email, password string) (int, error) {
 	var id int
-	var hashedPassword []byte
-	stmt := "SELECT id, hashed_password FROM users WHERE email = ?"
+	var hashedPassword string
+	var disabled bool
+	stmt := "SELECT id, hashed_password, disabled FROM users WHERE email = ? AND deleted IS NULL"
 
-	err := m.Db.QueryRow(stmt, email).Scan(&id, &hashedPassword)
+	err := m.Db.QueryRow(stmt, email).Scan(&id, &hashedPassword, &disabled)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return 0, ErrInvalidCredentials
@@ -84,25 +140,41 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 
 		}
 	}
-	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	ok, rehash, err := m.hasher().Verify(hashedPassword, password)
 	if err != nil {
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-			return 0, ErrInvalidCredentials
-		} else {
-			return 0, err
-		}
+		return 0, err
+	}
+	if !ok {
+		return 0, ErrInvalidCredentials
+	}
+	if disabled {
+		return 0, ErrAccountDisabled
+	}
+	if rehash {
+		m.rehash(id, hashedPassword, password)
 	}
 	return id, nil
 }
 
+// rehash stores a fresh hash of password unless the stored one has changed
+// in the meantime. Failing is harmless: the old hash still works and the
+// next login tries again.
+func (m *UserModel) rehash(id int, oldHash, password string) {
+	newHash, err := m.hasher().Hash(password)
+	if err != nil {
+		return
+	}
+	m.Db.Exec(`UPDATE users SET hashed_password = ? WHERE id = ? AND hashed_password = ?`, newHash, id, oldHash)
+}
+
 func (m *UserModel) Exists(id int) (bool, error) {
 	var exist bool
-	stmt := `SELECT EXISTS(SELECT true from  Users where id =?)`
+	stmt := `SELECT EXISTS(SELECT true from  Users where id =? AND deleted IS NULL)`
 	err := m.Db.QueryRow(stmt, id).Scan(&exist)
 	return exist, err
 }
 func (m *UserModel) ChangePassword(id int, oldPassword string, newPassword string) (bool, error) {
-	var hashedPassword []byte
+	var hashedPassword string
 	stmt := `SELECT hashed_password FROM users WHERE id = ?`
 
 	err := m.Db.QueryRow(stmt, id).Scan(&hashedPassword)
@@ -114,15 +186,14 @@ func (m *UserModel) ChangePassword(id int, oldPassword string, newPassword strin
 			return false, err
 		}
 	}
-	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(oldPassword))
+	ok, _, err := m.hasher().Verify(hashedPassword, oldPassword)
 	if err != nil {
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-			return false, ErrInvalidCredentials
-		} else {
-			return false, err
-		}
+		return false, err
 	}
-	newHashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), 12)
+	if !ok {
+		return false, ErrInvalidCredentials
+	}
+	newHashedPassword, err := m.hasher().Hash(newPassword)
 	if err != nil {
 		return false, err
 	}
@@ -136,3 +207,237 @@ WHERE ID = ?  `
 	}
 	return true, nil
 }
+
+// SetVerified marks the user's email address as confirmed.
+func (m *UserModel) SetVerified(id int) error {
+	stmt := `UPDATE users SET verified = TRUE WHERE id = ?`
+	result, err := m.Db.Exec(stmt, id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+func (m *UserModel) GetByEmail(email string) (*User, error) {
+	stmt := `SELECT ` + userColumns + ` FROM users WHERE email = ? AND deleted IS NULL`
+	user, err := scanUser(m.Db.QueryRow(stmt, email))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// SetPassword replaces the user's password without checking the old one. It
+// is used once the user has proved their identity some other way.
+func (m *UserModel) SetPassword(id int, password string) error {
+	hashedPassword, err := m.hasher().Hash(password)
+	if err != nil {
+		return err
+	}
+	result, err := m.Db.Exec(`UPDATE users SET hashed_password = ? WHERE id = ?`, hashedPassword, id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+// List returns every user that hasn't deleted their account, oldest first.
+func (m *UserModel) List() ([]*User, error) {
+	rows, err := m.Db.Query(`SELECT ` + userColumns + ` FROM users WHERE deleted IS NULL ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := []*User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// SetRole and SetDisabled don't report a missing user: MySQL counts an
+// update that changes nothing as zero rows, so callers look the user up first.
+func (m *UserModel) SetRole(id int, role string) error {
+	if _, ok := roleRank[role]; !ok {
+		return fmt.Errorf("models: unknown role %q", role)
+	}
+	_, err := m.Db.Exec(`UPDATE users SET role = ? WHERE id = ?`, role, id)
+	return err
+}
+
+// SetDisabled locks the user out of, or back into, their account.
+func (m *UserModel) SetDisabled(id int, disabled bool) error {
+	_, err := m.Db.Exec(`UPDATE users SET disabled = ? WHERE id = ?`, disabled, id)
+	return err
+}
+
+// SoftDelete locks the account straight away and schedules it to be purged
+// once grace has passed. Ways back in that don't go through the users table,
+// such as API tokens and linked identities, are removed now.
+func (m *UserModel) SoftDelete(id int, grace time.Duration) error {
+	tx, err := m.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE users SET deleted = UTC_TIMESTAMP(),
+  purge_after = DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? SECOND) WHERE id = ? AND deleted IS NULL`,
+		int(grace.Seconds()), id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	for _, stmt := range []string{
+		`DELETE FROM api_tokens WHERE user_id = ?`,
+		`DELETE FROM user_identities WHERE user_id = ?`,
+		`DELETE FROM password_resets WHERE user_id = ?`,
+		`DELETE FROM org_members WHERE user_id = ?`,
+		`DELETE FROM remember_tokens WHERE user_id = ?`,
+		`DELETE FROM ssh_keys WHERE user_id = ?`,
+		`DELETE FROM passkeys WHERE user_id = ?`,
+	} {
+		if _, err := tx.Exec(stmt, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// purgeTables hold rows that belong to a user and go when the user does.
+var purgeTables = []string{
+	"api_tokens", "user_identities", "user_sessions", "password_resets",
+	"org_members", "recovery_codes", "snippet_templates", "remember_tokens",
+	"ssh_keys", "passkeys",
+}
+
+// Purge removes deleted accounts whose grace period is over, along with
+// everything they still own, and reports how many accounts went.
+func (m *UserModel) Purge() (int, error) {
+	tx, err := m.Db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT id FROM users WHERE deleted IS NOT NULL AND purge_after <= UTC_TIMESTAMP() FOR UPDATE`)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		for _, table := range purgeTables {
+			if _, err := tx.Exec(`DELETE FROM `+table+` WHERE user_id = ?`, id); err != nil {
+				return 0, err
+			}
+		}
+		// Snippets were dealt with when the account was deleted; anything
+		// left over stays up without an owner.
+		if _, err := tx.Exec(`UPDATE snippets SET user_id = NULL WHERE user_id = ?`, id); err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec(`DELETE FROM users WHERE id = ?`, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), tx.Commit()
+}
+
+// duplicateUserError translates a violated unique constraint on users into
+// the matching model error, or returns nil for anything else.
+func duplicateUserError(err error) error {
+	var mySqlError *mysql.MySQLError
+	if errors.As(err, &mySqlError) && mySqlError.Number == 1062 {
+		switch {
+		case strings.Contains(mySqlError.Message, "users_uc_email"):
+			return ErrDuplicateEmail
+		case strings.Contains(mySqlError.Message, "users_uc_username"):
+			return ErrDuplicateUsername
+		}
+	}
+	return nil
+}
+
+// GetByUsername looks up the owner of a public profile.
+func (m *UserModel) GetByUsername(username string) (*User, error) {
+	stmt := `SELECT ` + userColumns + ` FROM users WHERE username = ? AND deleted IS NULL`
+	user, err := scanUser(m.Db.QueryRow(stmt, username))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// SetProfile updates what the user's public profile shows.
+func (m *UserModel) SetProfile(id int, username, bio string) error {
+	_, err := m.Db.Exec(`UPDATE users SET username = ?, bio = ? WHERE id = ?`, username, bio, id)
+	if err != nil {
+		if dup := duplicateUserError(err); dup != nil {
+			return dup
+		}
+		return err
+	}
+	return nil
+}
+
+// SetName changes the user's display name.
+func (m *UserModel) SetName(id int, name string) error {
+	_, err := m.Db.Exec(`UPDATE users SET name = ? WHERE id = ?`, name, id)
+	return err
+}
+
+// ChangeEmail moves the account to an address the user has just proved they
+// own, so it counts as verified.
+func (m *UserModel) ChangeEmail(id int, email string) error {
+	_, err := m.Db.Exec(`UPDATE users SET email = ?, verified = TRUE WHERE id = ? AND deleted IS NULL`, email, id)
+	if err != nil {
+		if dup := duplicateUserError(err); dup != nil {
+			return dup
+		}
+		return err
+	}
+	return nil
+}
@@ -33,7 +33,7 @@ func TestUserModelExists(t *testing.T) {
     t.Run(tt.name,  func(t *testing.T) {
       db:= newTestDB(t) 
     
-      m :=UserModel{db}
+      m :=UserModel{Db: db}
 
       exist,err :=  m.Exists( tt.userID)
       assert.Equal(t, exist , tt.want)
@@ -0,0 +1,274 @@
+// Package oidc implements the relying party side of OpenID Connect: provider
+// discovery, the authorization code flow with PKCE and ID token
+// verification. Only what a web login needs is supported.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("oidc: invalid ID token")
+	ErrExchange     = errors.New("oidc: code exchange failed")
+)
+
+// Config describes one provider, as read from the JSON config file.
+type Config struct {
+	// Name identifies the provider in URLs and stored identities, so it
+	// shouldn't change once users have logged in with it.
+	Name         string   `json:"name"`
+	DisplayName  string   `json:"display_name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes"`
+}
+
+// LoadConfig reads a JSON array of provider configs.
+func LoadConfig(path string) ([]Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []Config
+	err = json.Unmarshal(b, &configs)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: %s: %w", path, err)
+	}
+	for _, c := range configs {
+		if c.Name == "" || c.Issuer == "" || c.ClientID == "" {
+			return nil, fmt.Errorf("oidc: %s: every provider needs a name, issuer and client_id", path)
+		}
+	}
+	return configs, nil
+}
+
+// Metadata is the part of the discovery document we use.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims are the ID token claims used for logging in.
+type Claims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	AuthorizedParty   string   `json:"azp"`
+	Expiry            int64    `json:"exp"`
+	IssuedAt          int64    `json:"iat"`
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     boolish  `json:"email_verified"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+}
+
+// Provider is a configured OIDC provider. Its discovery document and
+// signing keys are fetched on first use and cached.
+type Provider struct {
+	Config
+	RedirectURL string
+	Client      *http.Client
+	Clock       func() time.Time
+
+	mu        sync.Mutex
+	metadata  *Metadata
+	keys      map[string]any
+	keysFetch time.Time
+}
+
+func NewProvider(config Config, redirectURL string) *Provider {
+	return &Provider{
+		Config:      config,
+		RedirectURL: redirectURL,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		Clock:       time.Now,
+	}
+}
+
+// DisplayLabel is the name shown on the login button.
+func (p *Provider) DisplayLabel() string {
+	if p.DisplayName != "" {
+		return p.DisplayName
+	}
+	return p.Name
+}
+
+func (p *Provider) discover(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+	wellKnown := strings.TrimSuffix(p.Issuer, "/") + "/.well-known/openid-configuration"
+	var m Metadata
+	err := p.getJSON(ctx, wellKnown, &m)
+	if err != nil {
+		return nil, err
+	}
+	if m.Issuer != p.Issuer {
+		return nil, fmt.Errorf("oidc: discovery issuer %q does not match configured issuer %q", m.Issuer, p.Issuer)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc: discovery document for %s is incomplete", p.Issuer)
+	}
+	p.metadata = &m
+	return p.metadata, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	rs, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rs.Body.Close()
+	if rs.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: GET %s: %s", url, rs.Status)
+	}
+	return json.NewDecoder(io.LimitReader(rs.Body, 1<<20)).Decode(dst)
+}
+
+// AuthCodeURL is where to send the user to log in. state and nonce tie the
+// response to this request; verifier is the PKCE code verifier.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	m, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	scopes := p.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", p.RedirectURL)
+	q.Set("scope", strings.Join(scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", S256Challenge(verifier))
+	q.Set("code_challenge_method", "S256")
+	sep := "?"
+	if strings.Contains(m.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return m.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the verified claims
+// of the ID token that came with it.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	m, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("code_verifier", verifier)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	rs, err := p.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	err = json.NewDecoder(io.LimitReader(rs.Body, 1<<20)).Decode(&body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrExchange, rs.Status)
+	}
+	if rs.StatusCode != http.StatusOK || body.Error != "" {
+		return nil, fmt.Errorf("%w: %s %s", ErrExchange, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return nil, fmt.Errorf("%w: no id_token in response", ErrExchange)
+	}
+	return p.Verify(ctx, body.IDToken, nonce)
+}
+
+// RandomString returns a URL-safe random value for state, nonce and PKCE
+// verifiers.
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// S256Challenge derives the PKCE code challenge for verifier.
+func S256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// audience accepts both forms of the aud claim.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+func (a audience) contains(s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// boolish accepts email_verified as a boolean or, as some providers send
+// it, a string.
+type boolish bool
+
+func (b *boolish) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "true", `"true"`:
+		*b = true
+	default:
+		*b = false
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"snipit.bikraj.net/internal/assert"
+	"snipit.bikraj.net/internal/oidc"
+	"snipit.bikraj.net/internal/oidc/oidctest"
+)
+
+const redirectURL = "https://snipit.test/user/login/oidc/test/callback"
+
+// authorize runs the browser leg of the flow against the fake issuer and
+// returns the code and state it redirected back with.
+func authorize(t *testing.T, p *oidc.Provider, state, nonce, verifier string) (string, string) {
+	t.Helper()
+	authURL, err := p.AuthCodeURL(context.Background(), state, nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	rs, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+	assert.Equal(t, rs.StatusCode, http.StatusFound)
+	back, err := url.Parse(rs.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return back.Query().Get("code"), back.Query().Get("state")
+}
+
+func TestExchange(t *testing.T) {
+	issuer := oidctest.NewServer()
+	defer issuer.Close()
+	issuer.User = oidctest.User{Subject: "u-1", Email: "alice@example.com", EmailVerified: true, Name: "Alice Jones"}
+	p := oidc.NewProvider(issuer.Config("test"), redirectURL)
+	ctx := context.Background()
+
+	t.Run("Valid", func(t *testing.T) {
+		code, state := authorize(t, p, "state-1", "nonce-1", "verifier-1")
+		assert.Equal(t, state, "state-1")
+		claims, err := p.Exchange(ctx, code, "verifier-1", "nonce-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, claims.Subject, "u-1")
+		assert.Equal(t, claims.Email, "alice@example.com")
+		assert.Equal(t, bool(claims.EmailVerified), true)
+	})
+
+	t.Run("Code is single use", func(t *testing.T) {
+		code, _ := authorize(t, p, "state-1", "nonce-1", "verifier-1")
+		_, err := p.Exchange(ctx, code, "verifier-1", "nonce-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = p.Exchange(ctx, code, "verifier-1", "nonce-1")
+		assert.Equal(t, errors.Is(err, oidc.ErrExchange), true)
+	})
+
+	t.Run("Wrong PKCE verifier", func(t *testing.T) {
+		code, _ := authorize(t, p, "state-1", "nonce-1", "verifier-1")
+		_, err := p.Exchange(ctx, code, "verifier-2", "nonce-1")
+		assert.Equal(t, errors.Is(err, oidc.ErrExchange), true)
+	})
+
+	t.Run("Wrong nonce", func(t *testing.T) {
+		code, _ := authorize(t, p, "state-1", "nonce-1", "verifier-1")
+		_, err := p.Exchange(ctx, code, "verifier-1", "nonce-2")
+		assert.Equal(t, errors.Is(err, oidc.ErrInvalidToken), true)
+	})
+}
+
+func TestVerify(t *testing.T) {
+	issuer := oidctest.NewServer()
+	defer issuer.Close()
+	p := oidc.NewProvider(issuer.Config("test"), redirectURL)
+	now := time.Now()
+
+	claims := func(edit func(map[string]any)) map[string]any {
+		c := map[string]any{
+			"iss":   issuer.URL,
+			"sub":   "u-1",
+			"aud":   oidctest.ClientID,
+			"iat":   now.Unix(),
+			"exp":   now.Add(5 * time.Minute).Unix(),
+			"nonce": "n",
+		}
+		if edit != nil {
+			edit(c)
+		}
+		return c
+	}
+	valid := issuer.Sign(claims(nil))
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"Valid", valid, false},
+		{"Audience list", issuer.Sign(claims(func(c map[string]any) {
+			c["aud"] = []string{oidctest.ClientID, "other"}
+			c["azp"] = oidctest.ClientID
+		})), false},
+		{"Audience list without azp", issuer.Sign(claims(func(c map[string]any) {
+			c["aud"] = []string{oidctest.ClientID, "other"}
+		})), true},
+		{"Wrong audience", issuer.Sign(claims(func(c map[string]any) { c["aud"] = "other" })), true},
+		{"Wrong issuer", issuer.Sign(claims(func(c map[string]any) { c["iss"] = "https://evil.example" })), true},
+		{"Expired", issuer.Sign(claims(func(c map[string]any) { c["exp"] = now.Add(-time.Hour).Unix() })), true},
+		{"Issued in the future", issuer.Sign(claims(func(c map[string]any) { c["iat"] = now.Add(time.Hour).Unix() })), true},
+		{"No subject", issuer.Sign(claims(func(c map[string]any) { c["sub"] = "" })), true},
+		{"Tampered signature", valid[:len(valid)-4] + "AAAA", true},
+		{"Unsigned", "eyJhbGciOiJub25lIn0." + strings.Split(valid, ".")[1] + ".", true},
+		{"Malformed", "not-a-jwt", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := p.Verify(context.Background(), tt.token, "n")
+			assert.Equal(t, err != nil, tt.wantErr)
+			if tt.wantErr {
+				assert.Equal(t, errors.Is(err, oidc.ErrInvalidToken), true)
+			}
+		})
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	issuer := oidctest.NewServer()
+	defer issuer.Close()
+	config := issuer.Config("test")
+	config.Issuer = issuer.URL + "/"
+	p := oidc.NewProvider(config, redirectURL)
+	_, err := p.AuthCodeURL(context.Background(), "s", "n", "v")
+	assert.Equal(t, err != nil, true)
+}
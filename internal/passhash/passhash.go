@@ -0,0 +1,152 @@
+// Package passhash hashes passwords for storage. Hashes carry their
+// algorithm and parameters, so old ones keep verifying after the
+// configuration changes and can be upgraded the next time the user logs in.
+package passhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algorithms a Hasher can produce.
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+// ErrUnknownHash is returned for stored hashes in a format this package
+// doesn't recognise.
+var ErrUnknownHash = errors.New("passhash: unknown hash format")
+
+// Argon2Params are the argon2id cost settings. Memory is in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params follow the OWASP minimum recommendation.
+var DefaultArgon2Params = Argon2Params{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Hasher creates hashes with Algorithm and verifies hashes made with any
+// supported algorithm.
+type Hasher struct {
+	Algorithm  string
+	BcryptCost int
+	Argon2     Argon2Params
+}
+
+// Default hashes new passwords with argon2id.
+var Default = &Hasher{Algorithm: Argon2id, BcryptCost: bcrypt.DefaultCost, Argon2: DefaultArgon2Params}
+
+// New returns a Hasher for algorithm, which must be Argon2id or Bcrypt.
+func New(algorithm string, bcryptCost int) (*Hasher, error) {
+	switch algorithm {
+	case Argon2id:
+	case Bcrypt:
+		if bcryptCost < bcrypt.MinCost || bcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("passhash: bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return nil, fmt.Errorf("passhash: unknown algorithm %q", algorithm)
+	}
+	return &Hasher{Algorithm: algorithm, BcryptCost: bcryptCost, Argon2: DefaultArgon2Params}, nil
+}
+
+// Hash returns the encoded hash of password.
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.Algorithm == Argon2id {
+		return h.hashArgon2id(password)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Verify reports whether password matches hash and, if it does, whether the
+// hash should be replaced because it was made with other settings.
+func (h *Hasher) Verify(hash, password string) (ok, rehash bool, err error) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, false, err
+		}
+		other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(key, other) != 1 {
+			return false, false, nil
+		}
+		current := h.Argon2
+		current.SaltLength, current.KeyLength = uint32(len(salt)), uint32(len(key))
+		return true, h.Algorithm != Argon2id || params != current, nil
+	case strings.HasPrefix(hash, "$2"):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		} else if err != nil {
+			return false, false, err
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		if err != nil {
+			return false, false, err
+		}
+		return true, h.Algorithm != Bcrypt || cost != h.BcryptCost, nil
+	}
+	return false, false, ErrUnknownHash
+}
+
+// hashArgon2id encodes in the PHC string format used by the reference
+// implementation: $argon2id$v=19$m=...,t=...,p=...$salt$key.
+func (h *Hasher) hashArgon2id(password string) (string, error) {
+	p := h.Argon2
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func decodeArgon2id(hash string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, ErrUnknownHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrUnknownHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, ErrUnknownHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrUnknownHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, ErrUnknownHash
+	}
+	p.SaltLength, p.KeyLength = uint32(len(salt)), uint32(len(key))
+	return p, salt, key, nil
+}
@@ -0,0 +1,63 @@
+package passhash
+
+import (
+	"strings"
+	"testing"
+
+	"snipit.bikraj.net/internal/assert"
+)
+
+func TestHasher(t *testing.T) {
+	bcrypt10, err := New(Bcrypt, 10)
+	assert.NilError(t, err)
+	bcrypt12, err := New(Bcrypt, 12)
+	assert.NilError(t, err)
+	argon, err := New(Argon2id, 0)
+	assert.NilError(t, err)
+	strongerArgon := *argon
+	strongerArgon.Argon2.Iterations++
+
+	tests := []struct {
+		name       string
+		made       *Hasher
+		checker    *Hasher
+		wantPrefix string
+		wantRehash bool
+	}{
+		{"Same bcrypt cost", bcrypt12, bcrypt12, "$2a$12$", false},
+		{"Bcrypt cost raised", bcrypt10, bcrypt12, "$2a$10$", true},
+		{"Bcrypt to argon2id", bcrypt12, argon, "$2a$12$", true},
+		{"Same argon2id", argon, argon, "$argon2id$v=19$m=19456,t=2,p=1$", false},
+		{"Argon2id parameters raised", argon, &strongerArgon, "$argon2id$", true},
+		{"Argon2id to bcrypt", argon, bcrypt12, "$argon2id$", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := tt.made.Hash("staple-Dragon-Harbour")
+			assert.NilError(t, err)
+			assert.Equal(t, strings.HasPrefix(hash, tt.wantPrefix), true)
+
+			ok, rehash, err := tt.checker.Verify(hash, "staple-Dragon-Harbour")
+			assert.NilError(t, err)
+			assert.Equal(t, ok, true)
+			assert.Equal(t, rehash, tt.wantRehash)
+
+			ok, rehash, err = tt.checker.Verify(hash, "wrong password")
+			assert.NilError(t, err)
+			assert.Equal(t, ok, false)
+			assert.Equal(t, rehash, false)
+		})
+	}
+}
+
+func TestHasherErrors(t *testing.T) {
+	_, err := New("md5", 0)
+	assert.Equal(t, err != nil, true)
+	_, err = New(Bcrypt, 99)
+	assert.Equal(t, err != nil, true)
+
+	for _, hash := range []string{"", "plaintext", "$argon2id$v=19$m=1,t=1$salt", "$argon2id$v=18$m=1,t=1,p=1$c2FsdA$a2V5"} {
+		_, _, err := Default.Verify(hash, "password")
+		assert.Equal(t, err, ErrUnknownHash)
+	}
+}
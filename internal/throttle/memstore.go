@@ -0,0 +1,56 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps records in process memory. It is only suitable when a
+// single instance of the application is running.
+type MemoryStore struct {
+	// TTL, when set, lets records that haven't failed for that long be
+	// swept from memory.
+	TTL time.Duration
+
+	mu      sync.Mutex
+	records map[string]Record
+	updates int
+}
+
+func (s *MemoryStore) Update(key string, fn func(*Record)) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.records == nil {
+		s.records = make(map[string]Record)
+	}
+	rec := s.records[key]
+	fn(&rec)
+	s.records[key] = rec
+
+	s.updates++
+	if s.TTL > 0 && s.updates%1000 == 0 {
+		s.sweep(time.Now().Add(-s.TTL))
+	}
+	return rec, nil
+}
+
+func (s *MemoryStore) Get(key string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.records[key], nil
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+func (s *MemoryStore) sweep(before time.Time) {
+	for key, rec := range s.records {
+		if rec.LastFailure.Before(before) {
+			delete(s.records, key)
+		}
+	}
+}
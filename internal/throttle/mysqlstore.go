@@ -0,0 +1,56 @@
+package throttle
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// MySQLStore keeps records in the login_attempts table so that every
+// replica of the application sees the same counters.
+type MySQLStore struct {
+	DB *sql.DB
+}
+
+func (s *MySQLStore) Update(key string, fn func(*Record)) (Record, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return Record{}, err
+	}
+	defer tx.Rollback()
+
+	// Make sure a row exists so that SELECT ... FOR UPDATE has something to
+	// lock; concurrent updates for the key then queue up behind each other.
+	_, err = tx.Exec(`INSERT IGNORE INTO login_attempts (attempt_key,failures,last_failure)
+  VALUES(?,0,UTC_TIMESTAMP(6))`, key)
+	if err != nil {
+		return Record{}, err
+	}
+	var rec Record
+	err = tx.QueryRow(`SELECT failures,last_failure FROM login_attempts WHERE attempt_key = ? FOR UPDATE`, key).
+		Scan(&rec.Failures, &rec.LastFailure)
+	if err != nil {
+		return Record{}, err
+	}
+	fn(&rec)
+	_, err = tx.Exec(`UPDATE login_attempts SET failures = ?, last_failure = ? WHERE attempt_key = ?`,
+		rec.Failures, rec.LastFailure.UTC(), key)
+	if err != nil {
+		return Record{}, err
+	}
+	return rec, tx.Commit()
+}
+
+func (s *MySQLStore) Get(key string) (Record, error) {
+	var rec Record
+	err := s.DB.QueryRow(`SELECT failures,last_failure FROM login_attempts WHERE attempt_key = ?`, key).
+		Scan(&rec.Failures, &rec.LastFailure)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return Record{}, err
+	}
+	return rec, nil
+}
+
+func (s *MySQLStore) Delete(key string) error {
+	_, err := s.DB.Exec(`DELETE FROM login_attempts WHERE attempt_key = ?`, key)
+	return err
+}
@@ -0,0 +1,160 @@
+// Package throttle slows down repeated failures, such as password guessing,
+// with exponential backoff and temporary lockouts. Counters live in a Store so
+// several replicas can share them.
+package throttle
+
+import (
+	"time"
+)
+
+// Record is what a Store keeps per key.
+type Record struct {
+	Failures    int
+	LastFailure time.Time
+}
+
+// Store persists records. Update must apply fn and save its result
+// atomically with respect to other calls for the same key.
+type Store interface {
+	Update(key string, fn func(*Record)) (Record, error)
+	Get(key string) (Record, error)
+	Delete(key string) error
+}
+
+// Guard applies a backoff policy to the keys in one namespace. Once a key
+// has Threshold failures it is locked for BaseDelay, doubling with every
+// further failure up to MaxDelay. Failures older than Window are forgotten.
+type Guard struct {
+	Store     Store
+	Prefix    string
+	Threshold int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	Window    time.Duration
+	// Clock returns the current time; time.Now is used when it is nil.
+	Clock func() time.Time
+}
+
+// Result describes a key after an attempt or failure was recorded.
+type Result struct {
+	Allowed  bool
+	Wait     time.Duration
+	Failures int
+
+	// at and prev are when Attempt counted its failure and the key's
+	// previous last failure, so that Forgive can take it back.
+	at, prev time.Time
+}
+
+// Attempt atomically checks that key isn't locked and, if so, counts the
+// attempt as a failure up front. Callers Reset the key when the attempt
+// succeeds. Counting first means concurrent attempts can't all slip through
+// before any of them is recorded.
+func (g *Guard) Attempt(key string) (Result, error) {
+	now := g.now()
+	var res Result
+	rec, err := g.Store.Update(g.Prefix+key, func(rec *Record) {
+		g.expire(rec, now)
+		if wait := g.wait(*rec, now); wait > 0 {
+			res.Wait = wait
+			return
+		}
+		res.Allowed = true
+		res.at, res.prev = now, rec.LastFailure
+		rec.Failures++
+		rec.LastFailure = now
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	res.Failures = rec.Failures
+	return res, nil
+}
+
+// Forgive takes back the failure Attempt counted for an attempt that
+// succeeded. It is for keys shared by many callers, such as a client IP,
+// where Reset would also wipe out everybody else's failures.
+func (g *Guard) Forgive(key string, res Result) error {
+	if !res.Allowed {
+		return nil
+	}
+	_, err := g.Store.Update(g.Prefix+key, func(rec *Record) {
+		if rec.Failures == 0 {
+			return
+		}
+		rec.Failures--
+		// Unless a later failure has been recorded since, the key goes
+		// back to how it was before the attempt.
+		if !rec.LastFailure.After(res.at) {
+			rec.LastFailure = res.prev
+		}
+	})
+	return err
+}
+
+// Fail records a failure for key whether or not it is locked.
+func (g *Guard) Fail(key string) (Result, error) {
+	now := g.now()
+	rec, err := g.Store.Update(g.Prefix+key, func(rec *Record) {
+		g.expire(rec, now)
+		rec.Failures++
+		rec.LastFailure = now
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Allowed: true, Wait: g.wait(rec, now), Failures: rec.Failures}, nil
+}
+
+// Check reports how long key stays locked, without recording anything.
+func (g *Guard) Check(key string) (time.Duration, error) {
+	now := g.now()
+	rec, err := g.Store.Get(g.Prefix + key)
+	if err != nil {
+		return 0, err
+	}
+	g.expire(&rec, now)
+	return g.wait(rec, now), nil
+}
+
+// Reset forgets every failure for key.
+func (g *Guard) Reset(key string) error {
+	return g.Store.Delete(g.Prefix + key)
+}
+
+// Delay returns how long a key with the given number of failures is locked
+// after its last failure.
+func (g *Guard) Delay(failures int) time.Duration {
+	if failures < g.Threshold {
+		return 0
+	}
+	delay := g.BaseDelay
+	for i := g.Threshold; i < failures && delay < g.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > g.MaxDelay {
+		delay = g.MaxDelay
+	}
+	return delay
+}
+
+func (g *Guard) wait(rec Record, now time.Time) time.Duration {
+	until := rec.LastFailure.Add(g.Delay(rec.Failures))
+	if !until.After(now) {
+		return 0
+	}
+	return until.Sub(now)
+}
+
+func (g *Guard) expire(rec *Record, now time.Time) {
+	if rec.Failures > 0 && now.Sub(rec.LastFailure) > g.Window {
+		*rec = Record{}
+	}
+}
+
+func (g *Guard) now() time.Time {
+	if g.Clock != nil {
+		return g.Clock()
+	}
+	return time.Now()
+}
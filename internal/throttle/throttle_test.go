@@ -0,0 +1,148 @@
+package throttle
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"snipit.bikraj.net/internal/assert"
+)
+
+func newTestGuard(now *time.Time) *Guard {
+	return &Guard{
+		Store:     &MemoryStore{},
+		Prefix:    "account:",
+		Threshold: 3,
+		BaseDelay: time.Minute,
+		MaxDelay:  10 * time.Minute,
+		Window:    time.Hour,
+		Clock:     func() time.Time { return *now },
+	}
+}
+
+func TestGuardDelay(t *testing.T) {
+	g := newTestGuard(nil)
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{5, 4 * time.Minute},
+		{6, 8 * time.Minute},
+		{7, 10 * time.Minute},
+		{50, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, g.Delay(tt.failures), tt.want)
+	}
+}
+
+func TestGuardAttempt(t *testing.T) {
+	now := time.Date(2024, 3, 17, 10, 0, 0, 0, time.UTC)
+	g := newTestGuard(&now)
+
+	for i := 1; i <= 3; i++ {
+		res, err := g.Attempt("alice")
+		assert.NilError(t, err)
+		assert.Equal(t, res.Allowed, true)
+		assert.Equal(t, res.Failures, i)
+	}
+
+	res, err := g.Attempt("alice")
+	assert.NilError(t, err)
+	assert.Equal(t, res.Allowed, false)
+	assert.Equal(t, res.Wait, time.Minute)
+	assert.Equal(t, res.Failures, 3)
+
+	// Other keys are unaffected.
+	res, err = g.Attempt("bob")
+	assert.NilError(t, err)
+	assert.Equal(t, res.Allowed, true)
+
+	// Once the lock runs out the next failure doubles it.
+	now = now.Add(time.Minute)
+	res, err = g.Attempt("alice")
+	assert.NilError(t, err)
+	assert.Equal(t, res.Allowed, true)
+	wait, err := g.Check("alice")
+	assert.NilError(t, err)
+	assert.Equal(t, wait, 2*time.Minute)
+
+	// Old failures are forgotten after the window.
+	now = now.Add(2 * time.Hour)
+	wait, err = g.Check("alice")
+	assert.NilError(t, err)
+	assert.Equal(t, wait, time.Duration(0))
+	res, err = g.Attempt("alice")
+	assert.NilError(t, err)
+	assert.Equal(t, res.Failures, 1)
+
+	assert.NilError(t, g.Reset("alice"))
+	res, err = g.Attempt("alice")
+	assert.NilError(t, err)
+	assert.Equal(t, res.Failures, 1)
+}
+
+func TestGuardForgive(t *testing.T) {
+	now := time.Date(2024, 3, 17, 10, 0, 0, 0, time.UTC)
+	g := newTestGuard(&now)
+
+	for i := 0; i < 2; i++ {
+		_, err := g.Fail("10.0.0.1")
+		assert.NilError(t, err)
+	}
+	now = now.Add(time.Second)
+	res, err := g.Attempt("10.0.0.1")
+	assert.NilError(t, err)
+	assert.Equal(t, res.Allowed, true)
+	assert.Equal(t, res.Failures, 3)
+
+	// Forgiving a successful attempt keeps the earlier failures but lifts
+	// the lock the attempt itself caused.
+	assert.NilError(t, g.Forgive("10.0.0.1", res))
+	wait, err := g.Check("10.0.0.1")
+	assert.NilError(t, err)
+	assert.Equal(t, wait, time.Duration(0))
+	res, err = g.Attempt("10.0.0.1")
+	assert.NilError(t, err)
+	assert.Equal(t, res.Failures, 3)
+
+	// An attempt that was turned away counted nothing to forgive.
+	locked, err := g.Attempt("10.0.0.1")
+	assert.NilError(t, err)
+	assert.Equal(t, locked.Allowed, false)
+	assert.NilError(t, g.Forgive("10.0.0.1", locked))
+	wait, err = g.Check("10.0.0.1")
+	assert.NilError(t, err)
+	assert.Equal(t, wait, time.Minute)
+}
+
+func TestGuardConcurrentAttempts(t *testing.T) {
+	now := time.Now()
+	g := newTestGuard(&now)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := g.Attempt("alice")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if res.Allowed {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, allowed, g.Threshold)
+}
@@ -0,0 +1,61 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"snipit.bikraj.net/internal/assert"
+)
+
+// The SHA-1 test vectors from RFC 6238 appendix B, truncated to six digits.
+func TestCode(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			code, err := Code(secret, Step(time.Unix(tt.unix, 0)))
+			assert.NilError(t, err)
+			assert.Equal(t, code, tt.want)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	assert.NilError(t, err)
+	now := time.Now()
+
+	current, err := Code(secret, Step(now))
+	assert.NilError(t, err)
+	previous, err := Code(secret, Step(now)-1)
+	assert.NilError(t, err)
+
+	tests := []struct {
+		name string
+		code string
+		want bool
+	}{
+		{"Current step", current, true},
+		{"Previous step", previous, true},
+		{"Wrong length", "12345", false},
+		{"Not a number", "abcdef", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok := Validate(secret, tt.code, now)
+			assert.Equal(t, ok, tt.want)
+		})
+	}
+}
@@ -0,0 +1,413 @@
+package Validator
+
+import (
+	"bufio"
+	"compress/gzip"
+	_ "embed"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// commonPasswords lists frequently used and breached passwords, most common
+// first, one per line.
+//
+//go:embed common-passwords.txt.gz
+var commonPasswords []byte
+
+// DefaultMinEntropy is roughly what eight random letters and digits give.
+const DefaultMinEntropy = 40
+
+// MaxPasswordChars is the longest password forms accept. Estimate only looks
+// at this many runes, because its cost grows much faster than the length.
+const MaxPasswordChars = 128
+
+// PasswordPolicy decides whether a password is hard enough to guess. It
+// estimates entropy the way a guessing attack would proceed, so common words,
+// keyboard rows, sequences, repeats and years count for very little.
+type PasswordPolicy struct {
+	MinEntropy float64
+	// rank maps a blocklisted password to its position in the list,
+	// starting at 1.
+	rank map[string]int
+}
+
+// LoadPasswordPolicy reads a gzip-compressed list of passwords, one per line
+// and most common first, which are rejected outright and treated as words
+// inside longer passwords.
+func LoadPasswordPolicy(r io.Reader, minEntropy float64) (*PasswordPolicy, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	p := &PasswordPolicy{MinEntropy: minEntropy, rank: map[string]int{}}
+	scanner := bufio.NewScanner(zr)
+	for scanner.Scan() {
+		word := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if word == "" {
+			continue
+		}
+		if _, seen := p.rank[word]; !seen {
+			p.rank[word] = len(p.rank) + 1
+		}
+	}
+	return p, scanner.Err()
+}
+
+var (
+	defaultPolicy     *PasswordPolicy
+	defaultPolicyOnce sync.Once
+)
+
+// DefaultPasswordPolicy uses the built-in list of common passwords.
+func DefaultPasswordPolicy() *PasswordPolicy {
+	defaultPolicyOnce.Do(func() {
+		p, err := LoadPasswordPolicy(strings.NewReader(string(commonPasswords)), DefaultMinEntropy)
+		if err != nil {
+			panic("validator: built-in password list: " + err.Error())
+		}
+		defaultPolicy = p
+	})
+	return defaultPolicy
+}
+
+// CheckPassword adds an error for key unless password satisfies policy.
+// personal holds things the password mustn't contain, such as the user's
+// name and email address.
+func (v *Validator) CheckPassword(policy *PasswordPolicy, key, password string, personal ...string) {
+	if problem := policy.Check(password, personal...); problem != "" {
+		v.AddField(key, problem)
+	}
+}
+
+// Check returns what is wrong with password, or "" if it is acceptable.
+func (p *PasswordPolicy) Check(password string, personal ...string) string {
+	password = truncateRunes(password, MaxPasswordChars)
+	lower := strings.ToLower(password)
+	plain := unleet(lower)
+	for _, candidate := range []string{lower, plain, unleet(strings.TrimRightFunc(lower, notLetter))} {
+		if _, ok := p.rank[candidate]; ok {
+			return "This is a commonly used password. Choose something less predictable"
+		}
+	}
+	for _, s := range personalTokens(personal) {
+		if strings.Contains(lower, s) || strings.Contains(plain, s) {
+			return "This field cannot contain your name or email address"
+		}
+	}
+	entropy, patterns := p.Estimate(password)
+	if entropy >= p.MinEntropy {
+		return ""
+	}
+	msg := "This password is too easy to guess."
+	for _, kind := range []string{patternWord, patternKeyboard, patternSequence, patternRepeat, patternYear} {
+		if patterns[kind] {
+			msg += " " + patternHints[kind]
+			break
+		}
+	}
+	return msg + " Add another word or two; uncommon words are better"
+}
+
+// Kinds of guessable pattern that Estimate looks for.
+const (
+	patternWord     = "word"
+	patternKeyboard = "keyboard"
+	patternSequence = "sequence"
+	patternRepeat   = "repeat"
+	patternYear     = "year"
+)
+
+var patternHints = map[string]string{
+	patternWord:     "Common words and passwords are easy to guess, even with symbols swapped in.",
+	patternKeyboard: "Rows of keys like qwerty are easy to guess.",
+	patternSequence: "Sequences like abc or 6543 are easy to guess.",
+	patternRepeat:   "Repeats like aaa or abcabc are easy to guess.",
+	patternYear:     "Recent years are easy to guess.",
+}
+
+var keyboardRows = []string{"qwertyuiop", "asdfghjkl", "zxcvbnm", "1234567890"}
+
+// match is a stretch of the password, runes [i, j), that an attacker would
+// guess as a unit.
+type match struct {
+	i, j    int
+	kind    string
+	entropy float64
+}
+
+// Estimate returns the password's entropy in bits together with the kinds
+// of pattern found in the cheapest way of guessing it.
+func (p *PasswordPolicy) Estimate(password string) (float64, map[string]bool) {
+	runes := []rune(truncateRunes(password, MaxPasswordChars))
+	// Lowercase rune by rune so that positions agree across the three.
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	plain := []rune(unleet(string(lower)))
+	n := len(runes)
+	if n == 0 {
+		return 0, map[string]bool{}
+	}
+	charBits := math.Log2(float64(charsetSize(runes)))
+
+	var matches []match
+	matches = append(matches, p.wordMatches(runes, lower, plain)...)
+	matches = append(matches, keyboardMatches(lower)...)
+	matches = append(matches, sequenceMatches(lower)...)
+	matches = append(matches, repeatMatches(lower, charBits)...)
+	matches = append(matches, yearMatches(lower)...)
+	ending := make([][]match, n+1)
+	for _, m := range matches {
+		ending[m.j] = append(ending[m.j], m)
+	}
+
+	// best[j] is the cheapest guess for the first j runes; anything not
+	// covered by a pattern is guessed one character at a time.
+	best := make([]float64, n+1)
+	via := make([]*match, n+1)
+	for j := 1; j <= n; j++ {
+		best[j] = best[j-1] + charBits
+		via[j] = nil
+		for k := range ending[j] {
+			m := &ending[j][k]
+			if e := best[m.i] + m.entropy; e < best[j] {
+				best[j] = e
+				via[j] = m
+			}
+		}
+	}
+
+	patterns := map[string]bool{}
+	for j := n; j > 0; {
+		if m := via[j]; m != nil {
+			patterns[m.kind] = true
+			j = m.i
+		} else {
+			j--
+		}
+	}
+	return best[n], patterns
+}
+
+func (p *PasswordPolicy) wordMatches(runes, lower, plain []rune) []match {
+	var matches []match
+	for i := range plain {
+		for j := i + 3; j <= len(plain) && j-i <= 20; j++ {
+			rank, ok := p.rank[string(plain[i:j])]
+			if !ok {
+				continue
+			}
+			bits := math.Log2(float64(rank + 1))
+			if string(runes[i:j]) != string(lower[i:j]) {
+				bits++ // capitals
+			}
+			if string(lower[i:j]) != string(plain[i:j]) {
+				bits++ // substituted symbols
+			}
+			matches = append(matches, match{i, j, patternWord, bits})
+		}
+	}
+	return matches
+}
+
+func keyboardMatches(lower []rune) []match {
+	var matches []match
+	for i := range lower {
+		for j := i + 4; j <= len(lower); j++ {
+			chunk := string(lower[i:j])
+			if !isASCII(chunk) || !onKeyboardRow(chunk) {
+				break
+			}
+			matches = append(matches, match{i, j, patternKeyboard, math.Log2(float64(len(keyboardRows)*10*2)) + math.Log2(float64(j-i))})
+		}
+	}
+	return matches
+}
+
+func onKeyboardRow(chunk string) bool {
+	for _, row := range keyboardRows {
+		if strings.Contains(row, chunk) || strings.Contains(reverse(row), chunk) {
+			return true
+		}
+	}
+	return false
+}
+
+func sequenceMatches(lower []rune) []match {
+	var matches []match
+	for i := 0; i+2 < len(lower); i++ {
+		delta := lower[i+1] - lower[i]
+		if delta != 1 && delta != -1 || !sequenceRune(lower[i]) {
+			continue
+		}
+		j := i + 1
+		for j < len(lower) && lower[j]-lower[j-1] == delta && sequenceRune(lower[j]) {
+			j++
+		}
+		if j-i >= 3 {
+			// Pick a starting point and a direction, then a length.
+			matches = append(matches, match{i, j, patternSequence, math.Log2(36*2) + math.Log2(float64(j-i))})
+		}
+	}
+	return matches
+}
+
+func sequenceRune(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= '0' && r <= '9'
+}
+
+func repeatMatches(lower []rune, charBits float64) []match {
+	var matches []match
+	n := len(lower)
+	for i := 0; i < n; i++ {
+		for size := 1; i+2*size <= n; size++ {
+			block := string(lower[i : i+size])
+			j := i + size
+			for j+size <= n && string(lower[j:j+size]) == block {
+				j += size
+			}
+			count := (j - i) / size
+			if count < 2 || size == 1 && count < 3 {
+				continue
+			}
+			bits := float64(size)*charBits + math.Log2(float64(count))
+			matches = append(matches, match{i, j, patternRepeat, bits})
+		}
+	}
+	return matches
+}
+
+func yearMatches(lower []rune) []match {
+	var matches []match
+	for i := 0; i+4 <= len(lower); i++ {
+		s := string(lower[i : i+4])
+		if (strings.HasPrefix(s, "19") || strings.HasPrefix(s, "20")) && isDigits(s) {
+			matches = append(matches, match{i, i + 4, patternYear, math.Log2(200)})
+		}
+	}
+	return matches
+}
+
+// charsetSize is how many characters an attacker has to try for each
+// position, given the kinds of character the password uses.
+func charsetSize(runes []rune) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r <= unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	size := 0
+	for _, c := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if c.used {
+			size += c.size
+		}
+	}
+	return size
+}
+
+var leetReplacer = strings.NewReplacer(
+	"4", "a", "@", "a", "3", "e", "1", "i", "!", "i", "0", "o", "$", "s", "5", "s", "7", "t", "|", "l",
+)
+
+// unleet undoes the usual symbol-for-letter swaps. Every replacement is a
+// single ASCII byte for another, so positions line up with the input.
+func unleet(s string) string {
+	return leetReplacer.Replace(s)
+}
+
+// personalTokens breaks names and email addresses into the parts a
+// password shouldn't contain.
+func personalTokens(personal []string) []string {
+	var tokens []string
+	for _, s := range personal {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s == "" {
+			continue
+		}
+		if local, _, ok := strings.Cut(s, "@"); ok {
+			tokens = append(tokens, s, local)
+		}
+		for _, part := range strings.FieldsFunc(s, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			tokens = append(tokens, part)
+		}
+	}
+	long := tokens[:0]
+	for _, t := range tokens {
+		if len([]rune(t)) >= 3 && !commonEmailPart(t) {
+			long = append(long, t)
+		}
+	}
+	return long
+}
+
+// commonEmailPart reports parts of an address, like the domain's top level,
+// that say nothing about the user.
+func commonEmailPart(s string) bool {
+	switch s {
+	case "com", "net", "org", "edu", "gov", "mail", "gmail", "yahoo", "hotmail", "outlook", "example":
+		return true
+	}
+	return false
+}
+
+func notLetter(r rune) bool {
+	return !unicode.IsLetter(r)
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isASCII(s string) bool {
+	for _, r := range s {
+		if r > unicode.MaxASCII {
+			return false
+		}
+	}
+	return true
+}
+
+func reverse(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
+
+// truncateRunes returns at most the first n runes of s.
+func truncateRunes(s string, n int) string {
+	i := 0
+	for pos := range s {
+		if i == n {
+			return s[:pos]
+		}
+		i++
+	}
+	return s
+}
@@ -0,0 +1,75 @@
+package Validator
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+	"time"
+
+	"snipit.bikraj.net/internal/assert"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	policy := DefaultPasswordPolicy()
+	tests := []struct {
+		name     string
+		password string
+		want     string
+	}{
+		{"Passphrase", "correct horse battery staple", ""},
+		{"Random characters", "kT9#mQ2x", ""},
+		{"Mixed words and symbols", "Unbr0ken-Lantern", ""},
+		{"Common password", "password", "This is a commonly used password"},
+		{"Common password with digits", "password1", "This is a commonly used password"},
+		{"Symbols swapped in", "p4$$w0rd", "This is a commonly used password"},
+		{"Common word inside", "n3wPa$$word", "Common words and passwords are easy to guess"},
+		{"Keyboard row", "hgfdsaytrewq", "Rows of keys like qwerty"},
+		{"Sequence", "abcdefghijklmn", "Sequences like abc or 6543"},
+		{"Repeats", "xyzzxyzzxyzzxyzz", "Repeats like aaa or abcabc"},
+		{"Contains name", "alicewonderland", "This field cannot contain your name or email address"},
+		{"Contains email", "xx-alice@example.com", "This field cannot contain your name or email address"},
+		{"Contains surname", "J0nes-Family-Tree", "This field cannot contain your name or email address"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := policy.Check(tt.password, "Alice Jones", "alice@example.com")
+			if tt.want == "" {
+				assert.Equal(t, got, "")
+				return
+			}
+			assert.StringContains(t, got, tt.want)
+		})
+	}
+}
+
+func TestPasswordPolicyLongPassword(t *testing.T) {
+	policy := DefaultPasswordPolicy()
+	// Scoring every rune of this would take hours.
+	password := strings.Repeat("Unbr0ken-Lantern ", 4096)
+	start := time.Now()
+	got := policy.Check(password, "Alice Jones", "alice@example.com")
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Check took %s", elapsed)
+	}
+	assert.Equal(t, got, "")
+}
+
+func TestLoadPasswordPolicy(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("hunter2\n\nTrombone\n"))
+	zw.Close()
+
+	policy, err := LoadPasswordPolicy(&buf, DefaultMinEntropy)
+	assert.NilError(t, err)
+	assert.StringContains(t, policy.Check("trombone"), "This is a commonly used password")
+	assert.StringContains(t, policy.Check("hunter2"), "This is a commonly used password")
+	// Only the loaded list counts, not the built-in one.
+	assert.Equal(t, policy.Check("staple-Dragon-Harbour"), "")
+
+	var v Validator
+	v.CheckPassword(policy, "password", "trombone")
+	assert.Equal(t, v.Valid(), false)
+	assert.StringContains(t, v.FieldErrors["password"], "commonly used")
+}
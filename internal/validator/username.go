@@ -0,0 +1,39 @@
+package Validator
+
+import (
+	"regexp"
+	"strings"
+)
+
+// UsernameRX matches usernames as they appear in /u/:username URLs: 3 to 30
+// lowercase letters, digits, dashes and underscores, starting and ending
+// with a letter or digit.
+var UsernameRX = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{1,28}[a-z0-9]$`)
+
+// generatedUsernameRX matches the names given to accounts that predate
+// usernames, which nobody else may take.
+var generatedUsernameRX = regexp.MustCompile(`^user[0-9]+$`)
+
+// reservedUsernames could be mistaken for the site itself or its staff.
+var reservedUsernames = map[string]bool{
+	"about": true, "abuse": true, "account": true, "admin": true, "administrator": true,
+	"anonymous": true, "api": true, "auth": true, "help": true, "login": true,
+	"logout": true, "mod": true, "moderator": true, "null": true, "org": true,
+	"postmaster": true, "root": true, "security": true, "settings": true, "signup": true,
+	"snippet": true, "snippetbox": true, "snippets": true, "staff": true, "static": true,
+	"support": true, "system": true, "undefined": true, "user": true, "webmaster": true,
+	"www": true,
+}
+
+// NotReserved reports whether username is free for anyone to take.
+func NotReserved(username string) bool {
+	username = strings.ToLower(username)
+	return !reservedUsernames[username] && !generatedUsernameRX.MatchString(username)
+}
+
+// CheckUsername adds an error for key unless username is well formed and
+// free for anyone to take. It doesn't know which usernames are in use.
+func (v *Validator) CheckUsername(key, username string) {
+	v.CheckField(Matches(username, UsernameRX), key, "Use 3 to 30 lowercase letters, digits, dashes and underscores")
+	v.CheckField(NotReserved(username), key, "That username is reserved")
+}
@@ -3,6 +3,7 @@ package Validator
 import (
 	"regexp"
 	"strings"
+	"unicode"
 	"unicode/utf8"
 )
 
@@ -65,3 +66,13 @@ func PermittedValue [T comparable](value T, permitttedValues ...T) bool {
 func Same [T comparable] (firstValue T, secondValue T) bool {
   return firstValue == secondValue
 }
+
+func MaxBytes(value string, maxBytes int) bool {
+	return len(value) <= maxBytes
+}
+
+// NoControlChars reports whether value is free of control characters such
+// as line breaks, for text that ends up in mail headers or on one line.
+func NoControlChars(value string) bool {
+	return strings.IndexFunc(value, unicode.IsControl) < 0
+}
@@ -0,0 +1,46 @@
+package webauthn
+
+import (
+	"testing"
+
+	"snipit.bikraj.net/internal/assert"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		valid bool
+	}{
+		{name: "Small uint", input: []byte{0x17}, valid: true},
+		{name: "Negative int", input: []byte{0x38, 0x63}, valid: true},
+		{name: "Map", input: []byte{0xa2, 0x01, 0x02, 0x61, 'a', 0xf5}, valid: true},
+		{name: "Array", input: []byte{0x82, 0x40, 0xf6}, valid: true},
+		{name: "Empty", input: []byte{}},
+		{name: "Short length", input: []byte{0x58}},
+		{name: "Long string", input: []byte{0x45, 'a'}},
+		{name: "Invalid UTF-8", input: []byte{0x61, 0xff}},
+		{name: "Duplicate key", input: []byte{0xa2, 0x01, 0x02, 0x01, 0x03}},
+		{name: "Array key", input: []byte{0xa1, 0x80, 0x01}},
+		{name: "Huge array", input: []byte{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{name: "Tag", input: []byte{0xc1, 0x00}},
+		{name: "Float", input: []byte{0xf9, 0x3c, 0x00}},
+		{name: "Indefinite", input: []byte{0x9f, 0xff}},
+		{name: "Too deep", input: []byte("\x81\x81\x81\x81\x81\x81\x81\x81\x81\x81\x81\x81\x81\x81\x81\x81\x81\x81\x00")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, rest, err := decodeCBOR(tt.input)
+			assert.Equal(t, err == nil, tt.valid)
+			if tt.valid {
+				assert.Equal(t, len(rest), 0)
+			}
+		})
+	}
+
+	v, rest, err := decodeCBOR([]byte{0xa1, 0x20, 0x42, 1, 2, 0xff})
+	assert.NilError(t, err)
+	assert.Equal(t, len(rest), 1)
+	m := v.(map[any]any)
+	assert.Equal(t, len(m[int64(-1)].([]byte)), 2)
+}
@@ -0,0 +1,121 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers for the signature schemes we accept.
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// COSE_Key labels and values, from RFC 9053.
+const (
+	coseKty = 1
+	coseAlg = 3
+
+	coseCrv = -1
+	coseX   = -2
+	coseY   = -3
+	coseN   = -1
+	coseE   = -2
+
+	ktyOKP = 1
+	ktyEC2 = 2
+	ktyRSA = 3
+
+	crvP256    = 1
+	crvEd25519 = 6
+)
+
+// minRSABits is the smallest RSA key accepted from an authenticator.
+const minRSABits = 2048
+
+var errSignature = errors.New("webauthn: signature verification failed")
+
+// publicKey is a credential public key, parsed from its COSE encoding.
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parseCOSEKey reads a COSE_Key from the start of b and returns the bytes
+// that follow it.
+func parseCOSEKey(b []byte) (*publicKey, []byte, error) {
+	item, rest, err := decodeCBOR(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	m, ok := item.(map[any]any)
+	if !ok {
+		return nil, nil, fmt.Errorf("webauthn: public key is not a COSE key")
+	}
+	kty, _ := m[int64(coseKty)].(int64)
+	alg, _ := m[int64(coseAlg)].(int64)
+	bytesAt := func(label int64) []byte {
+		b, _ := m[label].([]byte)
+		return b
+	}
+
+	switch {
+	case alg == AlgES256 && kty == ktyEC2:
+		if crv, _ := m[int64(coseCrv)].(int64); crv != crvP256 {
+			return nil, nil, fmt.Errorf("webauthn: ES256 key is not on P-256")
+		}
+		x, y := bytesAt(coseX), bytesAt(coseY)
+		if len(x) != 32 || len(y) != 32 {
+			return nil, nil, fmt.Errorf("webauthn: malformed P-256 key")
+		}
+		// crypto/ecdh rejects points that aren't on the curve.
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, nil, fmt.Errorf("webauthn: malformed P-256 key")
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		return &publicKey{alg: alg, key: key}, rest, nil
+	case alg == AlgEdDSA && kty == ktyOKP:
+		if crv, _ := m[int64(coseCrv)].(int64); crv != crvEd25519 {
+			return nil, nil, fmt.Errorf("webauthn: EdDSA key is not Ed25519")
+		}
+		x := bytesAt(coseX)
+		if len(x) != ed25519.PublicKeySize {
+			return nil, nil, fmt.Errorf("webauthn: malformed Ed25519 key")
+		}
+		return &publicKey{alg: alg, key: ed25519.PublicKey(x)}, rest, nil
+	case alg == AlgRS256 && kty == ktyRSA:
+		n, e := new(big.Int).SetBytes(bytesAt(coseN)), new(big.Int).SetBytes(bytesAt(coseE))
+		if n.BitLen() < minRSABits || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, nil, fmt.Errorf("webauthn: unacceptable RSA key")
+		}
+		return &publicKey{alg: alg, key: &rsa.PublicKey{N: n, E: int(e.Int64())}}, rest, nil
+	}
+	return nil, nil, fmt.Errorf("webauthn: unsupported key type %d with algorithm %d", kty, alg)
+}
+
+// verify checks sig over message with the key's algorithm.
+func (k *publicKey) verify(message, sig []byte) error {
+	digest := sha256.Sum256(message)
+	ok := false
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(key, digest[:], sig)
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(key, message, sig)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	}
+	if !ok {
+		return errSignature
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+// Package webauthn implements the relying party side of WebAuthn passkeys:
+// it issues challenges, checks "none" attestations when a passkey is
+// registered and verifies the assertions that sign in with one.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+var (
+	// ErrInvalidResponse is returned for any response from the browser that
+	// doesn't check out: a wrong challenge or origin, a bad signature or a
+	// malformed structure.
+	ErrInvalidResponse = errors.New("webauthn: invalid response")
+	// ErrSignCount is returned when an assertion's signature counter hasn't
+	// moved past the stored one, which suggests the credential was cloned.
+	ErrSignCount = errors.New("webauthn: signature counter went backwards")
+)
+
+// Authenticator data flags.
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+	flagExtensions   = 0x80
+)
+
+// ChallengeSize is the number of random bytes in a challenge.
+const ChallengeSize = 32
+
+// Timeout is how long the browser is given to finish a ceremony, in
+// milliseconds.
+const Timeout = 5 * 60 * 1000
+
+var encoding = base64.RawURLEncoding
+
+// RelyingParty identifies the site passkeys are scoped to. ID is the host
+// name and Origin the scheme, host and port the browser reports.
+type RelyingParty struct {
+	ID     string
+	Name   string
+	Origin string
+}
+
+// NewRelyingParty derives the relying party from the site's public URL.
+func NewRelyingParty(name, baseURL string) (*RelyingParty, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Hostname() == "" {
+		return nil, fmt.Errorf("webauthn: %q is not an absolute URL", baseURL)
+	}
+	return &RelyingParty{ID: u.Hostname(), Name: name, Origin: u.Scheme + "://" + u.Host}, nil
+}
+
+// NewChallenge returns a fresh random challenge.
+func NewChallenge() ([]byte, error) {
+	b := make([]byte, ChallengeSize)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// CredentialDescriptor names a credential the browser should, or shouldn't,
+// use.
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// CreationOptions are the publicKey options for navigator.credentials.create,
+// with binary values base64url encoded.
+type CreationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams []struct {
+		Type string `json:"type"`
+		Alg  int    `json:"alg"`
+	} `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+	Attestation string `json:"attestation"`
+}
+
+// RequestOptions are the publicKey options for navigator.credentials.get.
+// No credentials are listed, so the browser offers every passkey it holds
+// for the site.
+type RequestOptions struct {
+	Challenge        string `json:"challenge"`
+	RPID             string `json:"rpId"`
+	Timeout          int    `json:"timeout"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions builds the options to register a passkey for a user.
+// userHandle is stored on the authenticator and returned when signing in;
+// exclude lists credential IDs the user already has.
+func (rp *RelyingParty) CreationOptions(challenge, userHandle []byte, name, displayName string, exclude [][]byte) *CreationOptions {
+	o := &CreationOptions{
+		Challenge:          encoding.EncodeToString(challenge),
+		Timeout:            Timeout,
+		ExcludeCredentials: []CredentialDescriptor{},
+		Attestation:        "none",
+	}
+	o.RP.ID, o.RP.Name = rp.ID, rp.Name
+	o.User.ID, o.User.Name, o.User.DisplayName = encoding.EncodeToString(userHandle), name, displayName
+	for _, alg := range []int{AlgES256, AlgEdDSA, AlgRS256} {
+		o.PubKeyCredParams = append(o.PubKeyCredParams, struct {
+			Type string `json:"type"`
+			Alg  int    `json:"alg"`
+		}{"public-key", alg})
+	}
+	for _, id := range exclude {
+		o.ExcludeCredentials = append(o.ExcludeCredentials, CredentialDescriptor{"public-key", encoding.EncodeToString(id)})
+	}
+	o.AuthenticatorSelection.ResidentKey = "required"
+	o.AuthenticatorSelection.UserVerification = "required"
+	return o
+}
+
+// RequestOptions builds the options to sign in with a passkey.
+func (rp *RelyingParty) RequestOptions(challenge []byte) *RequestOptions {
+	return &RequestOptions{
+		Challenge:        encoding.EncodeToString(challenge),
+		RPID:             rp.ID,
+		Timeout:          Timeout,
+		UserVerification: "required",
+	}
+}
+
+// Credential is a verified passkey, ready to be stored.
+type Credential struct {
+	ID        []byte
+	PublicKey []byte
+	SignCount uint32
+}
+
+// clientData is the part of the JSON the browser signs that we check.
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+func (rp *RelyingParty) checkClientData(b []byte, typ string, challenge []byte) error {
+	var c clientData
+	if err := json.Unmarshal(b, &c); err != nil {
+		return err
+	}
+	got, err := encoding.DecodeString(c.Challenge)
+	if err != nil {
+		return err
+	}
+	switch {
+	case c.Type != typ:
+		return fmt.Errorf("webauthn: client data type is %q", c.Type)
+	case len(challenge) == 0 || subtle.ConstantTimeCompare(got, challenge) != 1:
+		return errors.New("webauthn: challenge mismatch")
+	case c.Origin != rp.Origin:
+		return fmt.Errorf("webauthn: origin is %q", c.Origin)
+	}
+	return nil
+}
+
+// authData is parsed authenticator data. credentialID and publicKey are
+// only set when the attested credential flag is.
+type authData struct {
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+func (rp *RelyingParty) parseAuthData(b []byte) (*authData, error) {
+	if len(b) < 37 {
+		return nil, errors.New("webauthn: authenticator data too short")
+	}
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(b[:32], rpIDHash[:]) {
+		return nil, errors.New("webauthn: relying party ID mismatch")
+	}
+	d := &authData{flags: b[32], signCount: binary.BigEndian.Uint32(b[33:37])}
+	if d.flags&flagUserPresent == 0 || d.flags&flagUserVerified == 0 {
+		return nil, errors.New("webauthn: user was not verified")
+	}
+	rest := b[37:]
+	if d.flags&flagAttested != 0 {
+		// A 16 byte AAGUID, then the credential ID with its length.
+		if len(rest) < 18 {
+			return nil, errors.New("webauthn: attested credential data too short")
+		}
+		n := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if n == 0 || n > 1023 || len(rest) < n {
+			return nil, errors.New("webauthn: bad credential ID length")
+		}
+		d.credentialID, rest = rest[:n:n], rest[n:]
+		_, after, err := parseCOSEKey(rest)
+		if err != nil {
+			return nil, err
+		}
+		n = len(rest) - len(after)
+		d.publicKey, rest = rest[:n:n], after
+	}
+	if d.flags&flagExtensions != 0 {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, err
+		}
+		rest = after
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("webauthn: trailing bytes in authenticator data")
+	}
+	return d, nil
+}
+
+// VerifyRegistration checks the response to navigator.credentials.create
+// against the challenge it was issued with and returns the new credential.
+// Only the "none" attestation format is accepted: we trust the browser's
+// word for what kind of authenticator made the key.
+func (rp *RelyingParty) VerifyRegistration(clientDataJSON, attestationObject, challenge []byte) (*Credential, error) {
+	if err := rp.checkClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+	item, rest, err := decodeCBOR(attestationObject)
+	if err != nil || len(rest) != 0 {
+		return nil, fmt.Errorf("%w: malformed attestation object", ErrInvalidResponse)
+	}
+	m, _ := item.(map[any]any)
+	format, _ := m["fmt"].(string)
+	statement, _ := m["attStmt"].(map[any]any)
+	raw, _ := m["authData"].([]byte)
+	if format != "none" || statement == nil || len(statement) != 0 {
+		return nil, fmt.Errorf("%w: unsupported attestation format %q", ErrInvalidResponse, format)
+	}
+	d, err := rp.parseAuthData(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+	if d.flags&flagAttested == 0 {
+		return nil, fmt.Errorf("%w: no credential in attestation", ErrInvalidResponse)
+	}
+	return &Credential{ID: d.credentialID, PublicKey: d.publicKey, SignCount: d.signCount}, nil
+}
+
+// VerifyAssertion checks the response to navigator.credentials.get for the
+// stored credential and returns the authenticator's new signature counter,
+// which the caller should save.
+func (rp *RelyingParty) VerifyAssertion(clientDataJSON, authenticatorData, signature, challenge []byte, cred *Credential) (uint32, error) {
+	if err := rp.checkClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+	d, err := rp.parseAuthData(authenticatorData)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+	key, rest, err := parseCOSEKey(cred.PublicKey)
+	if err != nil {
+		return 0, fmt.Errorf("webauthn: stored public key: %w", err)
+	}
+	if len(rest) != 0 {
+		return 0, errors.New("webauthn: trailing bytes after stored public key")
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	message := append(append([]byte{}, authenticatorData...), clientDataHash[:]...)
+	if err := key.verify(message, signature); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+	// Authenticators that don't keep a counter always report zero; any
+	// that do must count up on every use.
+	if (d.signCount != 0 || cred.SignCount != 0) && d.signCount <= cred.SignCount {
+		return 0, ErrSignCount
+	}
+	return d.signCount, nil
+}
@@ -0,0 +1,183 @@
+package webauthn_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"snipit.bikraj.net/internal/assert"
+	"snipit.bikraj.net/internal/webauthn"
+	"snipit.bikraj.net/internal/webauthn/webauthntest"
+)
+
+// register runs a registration ceremony and returns the stored credential.
+func register(t *testing.T, rp *webauthn.RelyingParty, a *webauthntest.Authenticator) *webauthn.Credential {
+	t.Helper()
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	att, err := a.Create(rp.CreationOptions(challenge, []byte("1"), "alice@example.com", "Alice", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred, err := rp.VerifyRegistration(att.ClientDataJSON, att.AttestationObject, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cred
+}
+
+func TestNewRelyingParty(t *testing.T) {
+	rp, err := webauthn.NewRelyingParty("Snippetbox", "https://snipit.test:4000/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, rp.ID, "snipit.test")
+	assert.Equal(t, rp.Origin, "https://snipit.test:4000")
+
+	_, err = webauthn.NewRelyingParty("Snippetbox", "snipit.test")
+	assert.Equal(t, err != nil, true)
+}
+
+func TestRegistration(t *testing.T) {
+	rp, err := webauthn.NewRelyingParty("Snippetbox", "https://snipit.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		a := webauthntest.New(rp.Origin)
+		cred := register(t, rp, a)
+		assert.Equal(t, len(cred.ID), 16)
+		assert.Equal(t, cred.SignCount, uint32(0))
+	})
+
+	tests := []struct {
+		name   string
+		origin string
+		rpID   string
+		mutate func(challenge []byte) []byte
+	}{
+		{name: "Wrong challenge", mutate: func([]byte) []byte { return bytes.Repeat([]byte{1}, 32) }},
+		{name: "No challenge", mutate: func([]byte) []byte { return nil }},
+		{name: "Wrong origin", origin: "https://evil.test"},
+		{name: "Wrong relying party", rpID: "evil.test"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origin := rp.Origin
+			if tt.origin != "" {
+				origin = tt.origin
+			}
+			a := webauthntest.New(origin)
+			challenge, _ := webauthn.NewChallenge()
+			o := rp.CreationOptions(challenge, []byte("1"), "alice@example.com", "Alice", nil)
+			if tt.rpID != "" {
+				o.RP.ID = tt.rpID
+			}
+			att, err := a.Create(o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.mutate != nil {
+				challenge = tt.mutate(challenge)
+			}
+			_, err = rp.VerifyRegistration(att.ClientDataJSON, att.AttestationObject, challenge)
+			assert.Equal(t, errors.Is(err, webauthn.ErrInvalidResponse), true)
+		})
+	}
+
+	t.Run("Assertion as registration", func(t *testing.T) {
+		a := webauthntest.New(rp.Origin)
+		register(t, rp, a)
+		challenge, _ := webauthn.NewChallenge()
+		as, err := a.Get(rp.RequestOptions(challenge))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = rp.VerifyRegistration(as.ClientDataJSON, as.AuthenticatorData, challenge)
+		assert.Equal(t, errors.Is(err, webauthn.ErrInvalidResponse), true)
+	})
+
+	t.Run("Truncated attestation", func(t *testing.T) {
+		a := webauthntest.New(rp.Origin)
+		challenge, _ := webauthn.NewChallenge()
+		att, err := a.Create(rp.CreationOptions(challenge, []byte("1"), "alice@example.com", "Alice", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for n := 0; n < len(att.AttestationObject); n++ {
+			_, err = rp.VerifyRegistration(att.ClientDataJSON, att.AttestationObject[:n], challenge)
+			if !errors.Is(err, webauthn.ErrInvalidResponse) {
+				t.Fatalf("truncated to %d bytes: got %v", n, err)
+			}
+		}
+	})
+
+	t.Run("Excluded credential", func(t *testing.T) {
+		a := webauthntest.New(rp.Origin)
+		cred := register(t, rp, a)
+		challenge, _ := webauthn.NewChallenge()
+		_, err := a.Create(rp.CreationOptions(challenge, []byte("1"), "alice@example.com", "Alice", [][]byte{cred.ID}))
+		assert.Equal(t, err != nil, true)
+	})
+}
+
+func TestAssertion(t *testing.T) {
+	rp, err := webauthn.NewRelyingParty("Snippetbox", "https://snipit.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := webauthntest.New(rp.Origin)
+	cred := register(t, rp, a)
+
+	login := func(t *testing.T) (*webauthntest.Assertion, []byte) {
+		t.Helper()
+		challenge, _ := webauthn.NewChallenge()
+		as, err := a.Get(rp.RequestOptions(challenge))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return as, challenge
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		as, challenge := login(t)
+		assert.Equal(t, string(as.CredentialID), string(cred.ID))
+		assert.Equal(t, string(as.UserHandle), "1")
+		count, err := rp.VerifyAssertion(as.ClientDataJSON, as.AuthenticatorData, as.Signature, challenge, cred)
+		assert.NilError(t, err)
+		assert.Equal(t, count, uint32(1))
+		cred.SignCount = count
+	})
+
+	t.Run("Wrong challenge", func(t *testing.T) {
+		as, _ := login(t)
+		other, _ := webauthn.NewChallenge()
+		_, err := rp.VerifyAssertion(as.ClientDataJSON, as.AuthenticatorData, as.Signature, other, cred)
+		assert.Equal(t, errors.Is(err, webauthn.ErrInvalidResponse), true)
+	})
+
+	t.Run("Tampered data", func(t *testing.T) {
+		as, challenge := login(t)
+		data := append([]byte{}, as.AuthenticatorData...)
+		data[len(data)-1]++
+		_, err := rp.VerifyAssertion(as.ClientDataJSON, data, as.Signature, challenge, cred)
+		assert.Equal(t, errors.Is(err, webauthn.ErrInvalidResponse), true)
+	})
+
+	t.Run("Another key", func(t *testing.T) {
+		other := register(t, rp, webauthntest.New(rp.Origin))
+		as, challenge := login(t)
+		_, err := rp.VerifyAssertion(as.ClientDataJSON, as.AuthenticatorData, as.Signature, challenge, other)
+		assert.Equal(t, errors.Is(err, webauthn.ErrInvalidResponse), true)
+	})
+
+	t.Run("Counter regression", func(t *testing.T) {
+		a.SetCounter(cred.ID, cred.SignCount-1)
+		as, challenge := login(t)
+		_, err := rp.VerifyAssertion(as.ClientDataJSON, as.AuthenticatorData, as.Signature, challenge, cred)
+		assert.Equal(t, errors.Is(err, webauthn.ErrSignCount), true)
+	})
+}
@@ -0,0 +1,233 @@
+// Package webauthntest provides a software authenticator that plays the
+// browser's part in WebAuthn ceremonies, so passkey flows can be tested
+// without a browser or a security key.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"snipit.bikraj.net/internal/webauthn"
+)
+
+var encoding = base64.RawURLEncoding
+
+// credential is a passkey held by the authenticator.
+type credential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+	counter    uint32
+}
+
+// Authenticator creates ES256 passkeys and signs in with them. Origin is
+// what it reports as the page's origin, as a browser would.
+type Authenticator struct {
+	Origin      string
+	credentials []*credential
+}
+
+// New returns an authenticator for pages served from origin.
+func New(origin string) *Authenticator {
+	return &Authenticator{Origin: origin}
+}
+
+// Attestation is the response to navigator.credentials.create.
+type Attestation struct {
+	CredentialID      []byte
+	ClientDataJSON    []byte
+	AttestationObject []byte
+}
+
+// Assertion is the response to navigator.credentials.get.
+type Assertion struct {
+	CredentialID      []byte
+	ClientDataJSON    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+	UserHandle        []byte
+}
+
+// Create makes a new passkey as the relying party's options ask.
+func (a *Authenticator) Create(o *webauthn.CreationOptions) (*Attestation, error) {
+	userHandle, err := encoding.DecodeString(o.User.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, ex := range o.ExcludeCredentials {
+		id, err := encoding.DecodeString(ex.ID)
+		if err != nil {
+			return nil, err
+		}
+		if a.find(o.RP.ID, id) != nil {
+			return nil, errors.New("webauthntest: credential already registered")
+		}
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	c := &credential{id: id, rpID: o.RP.ID, userHandle: userHandle, key: key}
+	a.credentials = append(a.credentials, c)
+
+	// Attested credential data: an all-zero AAGUID, the ID and the key.
+	attested := make([]byte, 16, 18+len(id))
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(id)))
+	attested = append(attested, id...)
+	attested = append(attested, encodeCOSEKey(&key.PublicKey)...)
+	authData := c.authData(0x40, attested)
+
+	object := encodeCBOR(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	return &Attestation{
+		CredentialID:      id,
+		ClientDataJSON:    a.clientData("webauthn.create", o.Challenge),
+		AttestationObject: object,
+	}, nil
+}
+
+// Get signs in with the most recently created passkey for the relying party.
+func (a *Authenticator) Get(o *webauthn.RequestOptions) (*Assertion, error) {
+	var c *credential
+	for _, cred := range a.credentials {
+		if cred.rpID == o.RPID {
+			c = cred
+		}
+	}
+	if c == nil {
+		return nil, errors.New("webauthntest: no credential for " + o.RPID)
+	}
+	c.counter++
+	clientData := a.clientData("webauthn.get", o.Challenge)
+	authData := c.authData(0, nil)
+	hash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), hash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, c.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	return &Assertion{
+		CredentialID:      c.id,
+		ClientDataJSON:    clientData,
+		AuthenticatorData: authData,
+		Signature:         sig,
+		UserHandle:        c.userHandle,
+	}, nil
+}
+
+// SetCounter sets the signature counter of a passkey, as if it had been
+// copied to another authenticator that used it since.
+func (a *Authenticator) SetCounter(credentialID []byte, counter uint32) {
+	for _, c := range a.credentials {
+		if string(c.id) == string(credentialID) {
+			c.counter = counter
+		}
+	}
+}
+
+func (a *Authenticator) find(rpID string, id []byte) *credential {
+	for _, c := range a.credentials {
+		if c.rpID == rpID && string(c.id) == string(id) {
+			return c
+		}
+	}
+	return nil
+}
+
+func (a *Authenticator) clientData(typ, challenge string) []byte {
+	b, _ := json.Marshal(map[string]any{
+		"type":        typ,
+		"challenge":   challenge,
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	return b
+}
+
+// authData lays out authenticator data with the user present and verified
+// flags set and any extra flags and attested credential data.
+func (c *credential) authData(flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(c.rpID))
+	b := append([]byte{}, rpIDHash[:]...)
+	b = append(b, flags|0x01|0x04)
+	b = binary.BigEndian.AppendUint32(b, c.counter)
+	return append(b, attested...)
+}
+
+func encodeCOSEKey(key *ecdsa.PublicKey) []byte {
+	x, y := make([]byte, 32), make([]byte, 32)
+	key.X.FillBytes(x)
+	key.Y.FillBytes(y)
+	return encodeCBOR(map[int64]any{1: int64(2), 3: int64(webauthn.AlgES256), -1: int64(1), -2: x, -3: y})
+}
+
+// encodeCBOR writes the few CBOR types the authenticator needs. Map keys
+// are sorted so the output is deterministic.
+func encodeCBOR(v any) []byte {
+	switch v := v.(type) {
+	case int64:
+		if v < 0 {
+			return cborHead(1, uint64(-1-v))
+		}
+		return cborHead(0, uint64(v))
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b := cborHead(5, uint64(len(v)))
+		for _, k := range keys {
+			b = append(b, encodeCBOR(k)...)
+			b = append(b, encodeCBOR(v[k])...)
+		}
+		return b
+	case map[int64]any:
+		keys := make([]int64, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+		b := cborHead(5, uint64(len(v)))
+		for _, k := range keys {
+			b = append(b, encodeCBOR(k)...)
+			b = append(b, encodeCBOR(v[k])...)
+		}
+		return b
+	}
+	panic(fmt.Sprintf("webauthntest: can't encode %T", v))
+}
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	}
+	return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, n)
+}
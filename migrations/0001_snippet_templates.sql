@@ -0,0 +1,19 @@
+-- Snippet ownership, language and visibility, plus reusable create-form
+-- templates. Templates with a NULL user_id are site-wide.
+ALTER TABLE snippets
+  ADD COLUMN user_id INTEGER AFTER id,
+  ADD COLUMN language VARCHAR(30) NOT NULL DEFAULT '' AFTER content,
+  ADD COLUMN visibility VARCHAR(10) NOT NULL DEFAULT 'public' AFTER language;
+
+CREATE TABLE snippet_templates (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+user_id INTEGER,
+name VARCHAR(100) NOT NULL,
+title_pattern VARCHAR(100) NOT NULL,
+language VARCHAR(30) NOT NULL DEFAULT '',
+content TEXT NOT NULL,
+expires INTEGER NOT NULL,
+visibility VARCHAR(10) NOT NULL DEFAULT 'public',
+created DATETIME NOT NULL
+);
+CREATE INDEX idx_snippet_templates_user_id ON snippet_templates(user_id);
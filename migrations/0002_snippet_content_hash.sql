@@ -0,0 +1,5 @@
+-- Hash of the normalised snippet content, used to spot duplicate pastes.
+-- Existing rows keep an empty hash and are never reported as duplicates.
+ALTER TABLE snippets ADD COLUMN content_hash CHAR(64) NOT NULL DEFAULT '' AFTER content;
+CREATE INDEX idx_snippets_user_content_hash ON snippets(user_id, content_hash);
+CREATE INDEX idx_snippets_content_hash ON snippets(content_hash);
@@ -0,0 +1,5 @@
+-- Large snippet contents are stored gzipped; content_encoding is 'gzip' for
+-- those rows and empty for plain text. MEDIUMBLOB also lifts the 64KB TEXT cap.
+ALTER TABLE snippets
+  MODIFY COLUMN content MEDIUMBLOB NOT NULL,
+  ADD COLUMN content_encoding VARCHAR(10) NOT NULL DEFAULT '' AFTER content;
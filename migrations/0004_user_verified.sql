@@ -0,0 +1,3 @@
+-- Email verification. Accounts that already exist are treated as verified.
+ALTER TABLE users ADD COLUMN verified BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE users SET verified = TRUE;
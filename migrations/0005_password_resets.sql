@@ -0,0 +1,8 @@
+-- Single-use password reset tokens. Only a SHA-256 of each token is stored.
+CREATE TABLE password_resets (
+token_hash CHAR(64) NOT NULL PRIMARY KEY,
+user_id INTEGER NOT NULL,
+created DATETIME NOT NULL,
+expires DATETIME NOT NULL
+);
+CREATE INDEX idx_password_resets_user_id ON password_resets(user_id);
@@ -0,0 +1,14 @@
+-- Optional TOTP two-factor authentication. A user has 2FA on when
+-- totp_secret is set; totp_last_step stops a code being used twice.
+ALTER TABLE users
+  ADD COLUMN totp_secret VARCHAR(64),
+  ADD COLUMN totp_last_step BIGINT;
+
+-- One-shot recovery codes, stored as SHA-256 hashes.
+CREATE TABLE recovery_codes (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+user_id INTEGER NOT NULL,
+code_hash CHAR(64) NOT NULL,
+created DATETIME NOT NULL
+);
+CREATE INDEX idx_recovery_codes_user_id ON recovery_codes(user_id);
@@ -0,0 +1,7 @@
+-- Failed login counters for -throttle-store=mysql, keyed by
+-- "account:<email>" or "ip:<address>".
+CREATE TABLE login_attempts (
+attempt_key VARCHAR(300) NOT NULL PRIMARY KEY,
+failures INTEGER NOT NULL,
+last_failure DATETIME(6) NOT NULL
+);
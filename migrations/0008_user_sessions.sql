@@ -0,0 +1,11 @@
+-- Metadata for each logged in browser, so users can review and revoke their
+-- sessions. Sessions that predate this table have no row and are logged out.
+CREATE TABLE user_sessions (
+id VARCHAR(43) NOT NULL PRIMARY KEY,
+user_id INTEGER NOT NULL,
+created DATETIME NOT NULL,
+last_seen DATETIME NOT NULL,
+ip VARCHAR(45) NOT NULL,
+user_agent VARCHAR(255) NOT NULL
+);
+CREATE INDEX idx_user_sessions_user_id ON user_sessions(user_id);
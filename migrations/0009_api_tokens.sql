@@ -0,0 +1,13 @@
+-- Personal API tokens. Only a SHA-256 hash of each token is kept.
+CREATE TABLE api_tokens (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+user_id INTEGER NOT NULL,
+name VARCHAR(100) NOT NULL,
+token_hash CHAR(64) NOT NULL,
+scopes VARCHAR(50) NOT NULL,
+created DATETIME NOT NULL,
+expires DATETIME NOT NULL,
+last_used DATETIME NULL
+);
+ALTER TABLE api_tokens ADD CONSTRAINT api_tokens_uc_token_hash UNIQUE (token_hash);
+CREATE INDEX idx_api_tokens_user_id ON api_tokens(user_id);
@@ -0,0 +1,17 @@
+-- Roles and account disabling for moderation, plus an audit trail of what
+-- staff did. Promote the first admin by hand:
+--   UPDATE users SET role = 'admin' WHERE email = '...';
+ALTER TABLE users
+  ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user',
+  ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE TABLE audit_log (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+actor_id INTEGER,
+action VARCHAR(50) NOT NULL,
+target_type VARCHAR(20) NOT NULL,
+target_id INTEGER NOT NULL,
+detail VARCHAR(255) NOT NULL DEFAULT '',
+ip VARCHAR(45) NOT NULL DEFAULT '',
+created DATETIME NOT NULL
+);
+CREATE INDEX idx_audit_log_created ON audit_log(created);
@@ -0,0 +1,32 @@
+-- Organizations own snippets shared between their members. The new
+-- "organization" visibility is longer than the old column allowed.
+ALTER TABLE snippets ADD COLUMN org_id INTEGER;
+CREATE INDEX idx_snippets_org_id ON snippets(org_id);
+ALTER TABLE snippets MODIFY visibility VARCHAR(20) NOT NULL DEFAULT 'public';
+ALTER TABLE snippet_templates MODIFY visibility VARCHAR(20) NOT NULL DEFAULT 'public';
+CREATE TABLE organizations (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+slug VARCHAR(50) NOT NULL,
+name VARCHAR(100) NOT NULL,
+created DATETIME NOT NULL
+);
+ALTER TABLE organizations ADD CONSTRAINT organizations_uc_slug UNIQUE (slug);
+CREATE TABLE org_members (
+org_id INTEGER NOT NULL,
+user_id INTEGER NOT NULL,
+role VARCHAR(20) NOT NULL,
+created DATETIME NOT NULL,
+PRIMARY KEY (org_id, user_id)
+);
+CREATE INDEX idx_org_members_user_id ON org_members(user_id);
+CREATE TABLE org_invitations (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+org_id INTEGER NOT NULL,
+email VARCHAR(255) NOT NULL,
+role VARCHAR(20) NOT NULL,
+token_hash CHAR(64) NOT NULL,
+invited_by INTEGER NOT NULL,
+created DATETIME NOT NULL,
+expires DATETIME NOT NULL
+);
+ALTER TABLE org_invitations ADD CONSTRAINT org_invitations_uc_token_hash UNIQUE (token_hash);
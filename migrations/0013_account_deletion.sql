@@ -0,0 +1,6 @@
+-- Deleted accounts are kept, locked, until purge_after so that a mistaken
+-- deletion can still be undone by hand; after that they are purged.
+ALTER TABLE users
+  ADD COLUMN deleted DATETIME,
+  ADD COLUMN purge_after DATETIME;
+CREATE INDEX idx_users_purge_after ON users(purge_after);
@@ -0,0 +1,3 @@
+-- bcrypt hashes are always 60 characters; argon2id hashes carry their
+-- parameters and are longer.
+ALTER TABLE users MODIFY hashed_password VARCHAR(255) NOT NULL;
@@ -0,0 +1,9 @@
+-- Public profiles live at /u/:username. Existing accounts get a placeholder
+-- username, which the validator keeps anyone else from choosing, until they
+-- pick their own under /account/profile.
+ALTER TABLE users
+  ADD COLUMN username VARCHAR(30),
+  ADD COLUMN bio VARCHAR(500) NOT NULL DEFAULT '';
+UPDATE users SET username = CONCAT('user', id);
+ALTER TABLE users MODIFY username VARCHAR(30) NOT NULL;
+ALTER TABLE users ADD CONSTRAINT users_uc_username UNIQUE (username);
@@ -0,0 +1,15 @@
+-- Long-lived "remember me" logins. The cookie holds a selector, used to
+-- find the row, and a validator, of which only a SHA-256 hash is kept. Each
+-- use replaces the token with a new one in the same family; the old row
+-- stays behind marked as rotated so that replaying it can be spotted.
+CREATE TABLE remember_tokens (
+selector CHAR(16) NOT NULL PRIMARY KEY,
+validator_hash CHAR(64) NOT NULL,
+family CHAR(16) NOT NULL,
+user_id INTEGER NOT NULL,
+created DATETIME NOT NULL,
+expires DATETIME NOT NULL,
+rotated DATETIME NULL
+);
+CREATE INDEX idx_remember_tokens_family ON remember_tokens(family);
+CREATE INDEX idx_remember_tokens_user_id ON remember_tokens(user_id);
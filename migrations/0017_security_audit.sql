@@ -0,0 +1,14 @@
+-- The audit log becomes a security log covering logins and account changes
+-- as well as moderation. The free-text detail column is folded into a JSON
+-- object, and rows can no longer be changed once written; old ones are
+-- removed by the retention job only.
+ALTER TABLE audit_log
+  ADD COLUMN details JSON NULL,
+  ADD COLUMN user_agent VARCHAR(255) NOT NULL DEFAULT '';
+UPDATE audit_log SET details = JSON_OBJECT('detail', detail) WHERE detail <> '';
+ALTER TABLE audit_log DROP COLUMN detail;
+CREATE INDEX idx_audit_log_actor_id ON audit_log(actor_id);
+CREATE INDEX idx_audit_log_target ON audit_log(target_type, target_id);
+CREATE INDEX idx_audit_log_ip ON audit_log(ip);
+CREATE TRIGGER audit_log_append_only BEFORE UPDATE ON audit_log FOR EACH ROW
+  SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
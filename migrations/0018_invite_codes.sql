@@ -0,0 +1,13 @@
+-- Invite codes for instances where signup is invite-only. Like API tokens,
+-- only a SHA-256 hash of each code is kept.
+CREATE TABLE invite_codes (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+code_hash CHAR(64) NOT NULL,
+note VARCHAR(100) NOT NULL,
+max_uses INTEGER NOT NULL,
+uses INTEGER NOT NULL DEFAULT 0,
+created_by INTEGER NULL,
+created DATETIME NOT NULL,
+expires DATETIME NOT NULL
+);
+ALTER TABLE invite_codes ADD CONSTRAINT invite_codes_uc_code_hash UNIQUE (code_hash);
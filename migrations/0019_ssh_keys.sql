@@ -0,0 +1,13 @@
+-- SSH public keys users log in to the paste server with. A key identifies
+-- its owner, so each one can only be registered once.
+CREATE TABLE ssh_keys (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+user_id INTEGER NOT NULL,
+name VARCHAR(100) NOT NULL,
+fingerprint VARCHAR(64) NOT NULL,
+public_key TEXT NOT NULL,
+created DATETIME NOT NULL,
+last_used DATETIME NULL
+);
+ALTER TABLE ssh_keys ADD CONSTRAINT ssh_keys_uc_fingerprint UNIQUE (fingerprint);
+CREATE INDEX idx_ssh_keys_user_id ON ssh_keys(user_id);
@@ -0,0 +1,15 @@
+-- WebAuthn passkeys users sign in with instead of a password. The public
+-- key is stored in its COSE encoding, and sign_count is the authenticator's
+-- signature counter from the last login, used to spot cloned credentials.
+CREATE TABLE passkeys (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+user_id INTEGER NOT NULL,
+name VARCHAR(100) NOT NULL,
+credential_id VARBINARY(1023) NOT NULL,
+public_key BLOB NOT NULL,
+sign_count INTEGER UNSIGNED NOT NULL DEFAULT 0,
+created DATETIME NOT NULL,
+last_used DATETIME NULL
+);
+ALTER TABLE passkeys ADD CONSTRAINT passkeys_uc_credential_id UNIQUE (credential_id);
+CREATE INDEX idx_passkeys_user_id ON passkeys(user_id);
@@ -0,0 +1,121 @@
+// Lists the operations in the OpenAPI document on the API docs page. The
+// document is the one source of truth; this only lays it out.
+(function () {
+	var main = document.getElementById("api-docs");
+	if (!main) {
+		return;
+	}
+
+	function el(tag, text, className) {
+		var e = document.createElement(tag);
+		if (text) {
+			e.textContent = text;
+		}
+		if (className) {
+			e.className = className;
+		}
+		return e;
+	}
+
+	// resolve follows a local $ref such as "#/components/responses/NotFound".
+	function resolve(spec, obj) {
+		if (!obj || !obj.$ref) {
+			return obj;
+		}
+		var node = spec;
+		var parts = obj.$ref.replace(/^#\//, "").split("/");
+		for (var i = 0; i < parts.length; i++) {
+			node = node[parts[i]];
+		}
+		return node;
+	}
+
+	function schemaName(obj) {
+		if (obj && obj.$ref) {
+			return obj.$ref.split("/").pop();
+		}
+		return obj && obj.type ? obj.type : "";
+	}
+
+	function renderOperation(spec, path, method, op, shared) {
+		var section = el("section", "", "operation");
+		section.appendChild(el("h3", method.toUpperCase() + " " + path));
+		if (op.summary) {
+			section.appendChild(el("p", op.summary));
+		}
+		if (op.description) {
+			section.appendChild(el("p", op.description));
+		}
+
+		var params = (shared || []).concat(op.parameters || []);
+		if (params.length > 0) {
+			section.appendChild(el("h4", "Parameters"));
+			var list = el("ul");
+			params.forEach(function (p) {
+				p = resolve(spec, p);
+				var text = p.name + " (" + p.in + ", " + schemaName(p.schema) + ")";
+				if (p.description) {
+					text += ": " + p.description;
+				}
+				list.appendChild(el("li", text));
+			});
+			section.appendChild(list);
+		}
+
+		if (op.requestBody) {
+			var body = resolve(spec, op.requestBody);
+			var media = body.content["application/json"];
+			section.appendChild(el("h4", "Request body"));
+			section.appendChild(el("p", schemaName(media.schema)));
+		}
+
+		section.appendChild(el("h4", "Responses"));
+		var table = el("table");
+		Object.keys(op.responses).forEach(function (status) {
+			var response = resolve(spec, op.responses[status]);
+			var row = el("tr");
+			row.appendChild(el("td", status));
+			var description = response.description;
+			var content = response.content && response.content["application/json"];
+			if (content) {
+				description += " (" + schemaName(content.schema) + ")";
+			}
+			row.appendChild(el("td", description));
+			table.appendChild(row);
+		});
+		section.appendChild(table);
+		return section;
+	}
+
+	function renderSchemas(spec) {
+		var section = el("section", "", "schemas");
+		section.appendChild(el("h3", "Schemas"));
+		Object.keys(spec.components.schemas).forEach(function (name) {
+			section.appendChild(el("h4", name));
+			section.appendChild(el("pre", JSON.stringify(spec.components.schemas[name], null, 2)));
+		});
+		return section;
+	}
+
+	fetch("/api/openapi.json")
+		.then(function (response) {
+			return response.json();
+		})
+		.then(function (spec) {
+			if (spec.info.description) {
+				main.appendChild(el("p", spec.info.description));
+			}
+			Object.keys(spec.paths).forEach(function (path) {
+				var item = spec.paths[path];
+				["get", "post", "put", "patch", "delete"].forEach(function (method) {
+					if (item[method]) {
+						main.appendChild(renderOperation(spec, path, method, item[method], item.parameters));
+					}
+				});
+			});
+			main.appendChild(renderSchemas(spec));
+		})
+		.catch(function () {
+			main.appendChild(el("p", "The OpenAPI document couldn't be loaded."));
+		});
+})();
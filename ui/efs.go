@@ -1,5 +1,5 @@
 package ui
 
 import "embed"
-//go:embed "html" "static"
+//go:embed "html" "static" "api"
 var Files embed.FS 
@@ -7,3 +7,79 @@ for (var i = 0; i < navLinks.length; i++) {
 	}
     }
 console.log("Inside Main.js")
+
+// Passkeys. The server sends WebAuthn options with binary values base64url
+// encoded, and expects the browser's response back the same way in the
+// hidden fields of the form.
+function base64urlToBuffer(s) {
+	var b = atob(s.replace(/-/g, "+").replace(/_/g, "/"));
+	var bytes = new Uint8Array(b.length);
+	for (var i = 0; i < b.length; i++) {
+		bytes[i] = b.charCodeAt(i);
+	}
+	return bytes.buffer;
+}
+
+function bufferToBase64url(buffer) {
+	var bytes = new Uint8Array(buffer);
+	var b = "";
+	for (var i = 0; i < bytes.length; i++) {
+		b += String.fromCharCode(bytes[i]);
+	}
+	return btoa(b).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+}
+
+function fetchPasskeyOptions(url) {
+	return fetch(url, {credentials: "same-origin"}).then(function (rs) {
+		if (!rs.ok) {
+			throw new Error("Fetching passkey options failed");
+		}
+		return rs.json();
+	});
+}
+
+var passkeyCreateForm = document.getElementById("passkey-create");
+if (passkeyCreateForm && window.PublicKeyCredential) {
+	passkeyCreateForm.addEventListener("submit", function (e) {
+		e.preventDefault();
+		fetchPasskeyOptions("/account/passkeys/options").then(function (options) {
+			options.challenge = base64urlToBuffer(options.challenge);
+			options.user.id = base64urlToBuffer(options.user.id);
+			options.excludeCredentials.forEach(function (c) {
+				c.id = base64urlToBuffer(c.id);
+			});
+			return navigator.credentials.create({publicKey: options});
+		}).then(function (credential) {
+			passkeyCreateForm.client_data_json.value = bufferToBase64url(credential.response.clientDataJSON);
+			passkeyCreateForm.attestation_object.value = bufferToBase64url(credential.response.attestationObject);
+			passkeyCreateForm.submit();
+		}).catch(function (err) {
+			console.log(err);
+		});
+	});
+}
+
+var passkeyLoginForm = document.getElementById("passkey-login");
+if (passkeyLoginForm) {
+	if (!window.PublicKeyCredential) {
+		passkeyLoginForm.hidden = true;
+	}
+	passkeyLoginForm.addEventListener("submit", function (e) {
+		e.preventDefault();
+		fetchPasskeyOptions("/user/login/passkey/options").then(function (options) {
+			options.challenge = base64urlToBuffer(options.challenge);
+			return navigator.credentials.get({publicKey: options});
+		}).then(function (credential) {
+			var remember = document.querySelector("input[type=checkbox][name=remember]");
+			passkeyLoginForm.credential_id.value = bufferToBase64url(credential.rawId);
+			passkeyLoginForm.client_data_json.value = bufferToBase64url(credential.response.clientDataJSON);
+			passkeyLoginForm.authenticator_data.value = bufferToBase64url(credential.response.authenticatorData);
+			passkeyLoginForm.signature.value = bufferToBase64url(credential.response.signature);
+			passkeyLoginForm.user_handle.value = bufferToBase64url(credential.response.userHandle || new ArrayBuffer(0));
+			passkeyLoginForm.remember.value = remember && remember.checked ? "true" : "false";
+			passkeyLoginForm.submit();
+		}).catch(function (err) {
+			console.log(err);
+		});
+	});
+}